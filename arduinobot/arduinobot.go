@@ -1,42 +1,210 @@
 package arduinobot
 
 import (
+	"context"
 	"fmt"
+	"image"
 	"io"
 	"log"
-	"math"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"go.bug.st/serial"
-	"go.bug.st/serial/enumerator"
+
+	"arduino-go-bot/arduinobot/keys"
+	"arduino-go-bot/arduinobot/trace"
+	"arduino-go-bot/arduinobot/wire"
 )
 
 // Config содержит все настройки для подключения к Arduino.
 type Config struct {
+	// Port — имя порта (COM5, /dev/ttyACM0) или tcp://host:port платы,
+	// которую отдает по сети cmd/arduinobridge. Если задано, остальные
+	// критерии выбора платы не используются.
+	Port string
+	// BridgeKey — общий ключ моста для Port вида tcp://host:port.
+	BridgeKey string
+	// SerialNumber — серийный номер USB, чтобы выбрать одну из нескольких плат.
+	// Если под критерии подходят несколько плат, подключение не выбирает
+	// сама и возвращает ErrAmbiguousDevice.
+	SerialNumber string
+	// Devices — подходящие пары VID/PID. VID и PID добавляются к ним;
+	// если не задано ничего, используются DefaultDevices.
+	Devices     []USBID
 	VID         string
 	PID         string
 	BaudRate    int
 	ReadTimeout time.Duration
+	// Protocol — версия протокола; ProtocolAuto пробует v2 и откатывается на v1.
+	Protocol Protocol
+	// BootTimeout — сколько ждать ответа на рукопожатие, пока плата загружается
+	// после открытия порта. Для NewController ноль означает 2 секунды.
+	BootTimeout time.Duration
+	// Timeouts — сколько ждать подтверждения каждого класса команд.
+	Timeouts Timeouts
+	// ReconnectWait — сколько команда под супервизором ждет переподключения,
+	// прежде чем вернуть ErrPortClosed. Ноль — не ждать.
+	ReconnectWait time.Duration
+	// PollInterval — как часто супервизор проверяет список портов.
+	// Ноль означает 1 секунду.
+	PollInterval time.Duration
+	// Desktop — виртуальный рабочий стол хоста в пикселях; у нескольких
+	// мониторов Min может быть отрицательным. Пустой — спросить у системы.
+	Desktop image.Rectangle
+	// Curve — поправка на ускорение указателя, снятая Calibrate.
+	Curve Curve
+	// CursorSource — откуда MouseMove и Calibrate узнают положение курсора.
+	// По умолчанию SystemCursor.
+	CursorSource CursorSource
+	// Tolerance — допустимый промах MouseMove в пикселях. Ноль — не проверять,
+	// куда попал курсор. MaxCorrections — сколько раз поправлять промах,
+	// ноль означает 5.
+	Tolerance      int
+	MaxCorrections int
+	// Heartbeat — как долго соединение может молчать между командами:
+	// плату, от которой столько не было ответов, проверяет PingCtx, и
+	// соединение без ответа разрывается. Ноль — не проверять.
+	Heartbeat time.Duration
+	// Trace, если задан, получает все байты, записанные в порт и прочитанные
+	// из него, при каждом подключении. Закрывает его вызывающий после Close.
+	Trace *trace.Recorder
+}
+
+// Timeouts задает время ожидания подтверждения по классам команд.
+// Нулевое поле означает 700 мс.
+type Timeouts struct {
+	Settings time.Duration // SetDelay*, SetOffsetMouseMove, SetRandomDelay*
+	Key      time.Duration // Key, KeyDown, KeyUp
+	Text     time.Duration // Text
+	Mouse    time.Duration // MouseClick, MouseDown, MouseUp, MouseWheel
+	Move     time.Duration // MouseMove, MouseMoveAbs, MouseMoveBy
+}
+
+// forOp (неэкспортируемая) возвращает таймаут для операции op.
+func (t Timeouts) forOp(op wire.Op) time.Duration {
+	var d time.Duration
+	switch ClassOf(op) {
+	case ClassKey:
+		d = t.Key
+	case ClassText:
+		d = t.Text
+	case ClassMouse:
+		d = t.Mouse
+	case ClassMove:
+		d = t.Move
+	case ClassSettings:
+		d = t.Settings
+	}
+	if d <= 0 {
+		return commandTimeout
+	}
+	return d
 }
 
-// Controller управляет соединением и отправкой команд.
+// Transport — канал, через который Controller общается с платой.
+// Ему удовлетворяют serial.Port и эмулятор из пакета emulator.
+type Transport interface {
+	io.ReadWriteCloser
+	ResetInputBuffer() error
+}
+
+// Controller управляет соединением и отправкой команд. Под супервизором
+// контроллер — постоянный дескриптор: соединения под ним меняются при
+// переподключении, а вызывающие продолжают пользоваться тем же *Controller.
 type Controller struct {
-	config Config
-	port   serial.Port
-	mu     sync.Mutex
+	config  Config
+	sup     *Supervisor
+	metrics *metrics
+
+	quit chan struct{} // закрывается в shutdown
+
+	cmu      sync.Mutex
+	link     *link
+	changed  chan struct{} // закрывается при каждой смене соединения
+	closed   bool
+	settings map[wire.Op]int // последние значения SetDelay* и т.п.
+
+	keysDown    map[keys.Key]struct{}
+	buttonsDown map[int]struct{}
 }
 
 // NewController находит Arduino и создает готовый к работе контроллер.
 func NewController(config Config) (*Controller, error) {
-	portName, err := findArduinoPort(config.VID, config.PID)
+	if err := config.Curve.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid mouse curve: %w", err)
+	}
+	portName, err := findArduinoPort(config)
 	if err != nil {
 		return nil, err
 	}
-	log.Printf("Arduino found on port: %s", portName)
 
+	c := newController(config)
+	l, err := openPort(config, portName, c.metrics)
+	if err != nil {
+		return nil, err
+	}
+	c.attach(l)
+	c.startHeartbeat()
+	return c, nil
+}
+
+// NewControllerWithTransport создает контроллер поверх уже открытого транспорта.
+// Поиск порта не выполняется, рукопожатие делается одной попыткой
+// или в течение config.BootTimeout, если он задан. Контроллер владеет
+// транспортом и закрывает его в Close или при ошибке конфигурации и рукопожатия.
+func NewControllerWithTransport(config Config, transport Transport) (*Controller, error) {
+	if transport == nil {
+		return nil, fmt.Errorf("transport is nil")
+	}
+	if err := config.Curve.Validate(); err != nil {
+		transport.Close()
+		return nil, fmt.Errorf("invalid mouse curve: %w", err)
+	}
+	c := newController(config)
+	l, err := connect(config, transport, "transport", config.BootTimeout, c.metrics)
+	if err != nil {
+		return nil, err
+	}
+	c.attach(l)
+	c.startHeartbeat()
+	return c, nil
+}
+
+func newController(config Config) *Controller {
+	return &Controller{
+		config:   config,
+		metrics:  newMetrics(),
+		quit:     make(chan struct{}),
+		changed:  make(chan struct{}),
+		settings: make(map[wire.Op]int),
+
+		keysDown:    make(map[keys.Key]struct{}),
+		buttonsDown: make(map[int]struct{}),
+	}
+}
+
+// openPort (неэкспортируемая) открывает порт portName — последовательный
+// или мост tcp://host:port — и выполняет рукопожатие.
+func openPort(config Config, portName string, m *metrics) (*link, error) {
+	if addr, ok := strings.CutPrefix(portName, bridgeScheme); ok {
+		return openBridge(config, addr, m)
+	}
+	return openSerial(config, portName, m)
+}
+
+// openSerial (неэкспортируемая) открывает последовательный порт и выполняет рукопожатие.
+func openSerial(config Config, portName string, m *metrics) (*link, error) {
+	port, err := openSerialPort(config, portName)
+	if err != nil {
+		return nil, err
+	}
+	return connect(config, port, portName, bootWindow(config), m)
+}
+
+// openSerialPort (неэкспортируемая) открывает последовательный порт
+// с настройками из config.
+func openSerialPort(config Config, portName string) (serial.Port, error) {
 	mode := &serial.Mode{
 		BaudRate: config.BaudRate,
 	}
@@ -47,123 +215,295 @@ func NewController(config Config) (*Controller, error) {
 	}
 
 	if err := port.SetReadTimeout(config.ReadTimeout); err != nil {
+		port.Close()
 		return nil, fmt.Errorf("failed to set timeout for reading: %w", err)
 	}
-
-	time.Sleep(2 * time.Second)
-
-	return &Controller{
-		config: config,
-		port:   port,
-	}, nil
+	return port, nil
 }
 
-// findArduinoPort (неэкспортируемая) ищет COM-порт по VID и PID.
-func findArduinoPort(vid, pid string) (string, error) {
-	ports, err := enumerator.GetDetailedPortsList()
-	if err != nil {
-		return "", err
+// bootWindow (неэкспортируемая) — сколько ждать загрузки только что
+// открытой платы.
+func bootWindow(config Config) time.Duration {
+	if config.BootTimeout > 0 {
+		return config.BootTimeout
 	}
-	for _, port := range ports {
-		if port.IsUSB && strings.EqualFold(port.VID, vid) && strings.EqualFold(port.PID, pid) {
-			return port.Name, nil
+	return defaultBootWindow
+}
+
+// SerialDialer возвращает Dialer, который при каждом вызове находит плату
+// по config так же, как NewController, и открывает ее порт. Рукопожатие
+// Dialer не выполняет: так порт можно отдать по сети через мост.
+func SerialDialer(config Config) Dialer {
+	return func() (Transport, string, error) {
+		portName, err := findArduinoPort(config)
+		if err != nil {
+			return nil, "", err
+		}
+		port, err := openSerialPort(config, portName)
+		if err != nil {
+			return nil, "", err
 		}
+		return port, portName, nil
 	}
-	return "", fmt.Errorf("device with VID=%s and PID=%s not found", vid, pid)
 }
 
-// Close корректно закрывает соединение с портом.
+// Close отпускает удерживаемые клавиши и кнопки и закрывает соединение
+// с портом. Контроллер под супервизором закрывается вместе с супервизором.
 func (c *Controller) Close() {
-	if c.port != nil {
-		c.port.Close()
+	if c.sup != nil {
+		c.sup.Close()
+		return
+	}
+	c.shutdown()
+}
+
+// shutdown (неэкспортируемая) отпускает удерживаемое, закрывает текущее
+// соединение и будит ожидающих.
+func (c *Controller) shutdown() {
+	c.cmu.Lock()
+	if c.closed {
+		c.cmu.Unlock()
+		return
+	}
+	l := c.link
+	c.link, c.closed = nil, true
+	close(c.changed)
+	close(c.quit)
+	c.cmu.Unlock()
+	if l != nil {
+		if l.failure() == nil {
+			c.releaseOn(l)
+		}
+		l.close()
 		log.Println("Connection to port closed.")
 	}
 }
 
-// sendAndReceive (неэкспортируемая) отправляет команду и ожидает ответа "ready".
-func (c *Controller) sendAndReceive(cmd string) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// attach (неэкспортируемая) делает l текущим соединением.
+func (c *Controller) attach(l *link) {
+	c.metrics.connected()
+	c.cmu.Lock()
+	defer c.cmu.Unlock()
+	c.link = l
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
 
-	if err := c.port.ResetInputBuffer(); err != nil {
-		return fmt.Errorf("failed to clear input buffer: %w", err)
+// detach (неэкспортируемая) убирает l, если оно все еще текущее.
+func (c *Controller) detach(l *link) {
+	c.cmu.Lock()
+	defer c.cmu.Unlock()
+	if c.link != l || c.closed {
+		return
 	}
+	c.link = nil
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
 
-	_, err := c.port.Write([]byte(cmd))
-	if err != nil {
-		return fmt.Errorf("error sending command '%s': %w", cmd, err)
-	}
-	log.Printf("Command sent: %s", cmd)
-
-	expectedReply := "ready"
-	replyBuf := make([]byte, len(expectedReply))
-	done := make(chan error, 1)
-	go func() {
-		_, err := io.ReadFull(c.port, replyBuf)
-		if err == nil && string(replyBuf) == expectedReply {
-			done <- nil
-		} else {
-			done <- fmt.Errorf("no ready/error")
+// current (неэкспортируемая) возвращает рабочее соединение. Под супервизором
+// команда, пришедшая во время разрыва, ждет переподключения не дольше
+// Config.ReconnectWait; без супервизора или при нулевом ожидании сразу
+// получает ErrPortClosed.
+func (c *Controller) current(ctx context.Context) (*link, error) {
+	var timeout <-chan time.Time
+	for {
+		c.cmu.Lock()
+		l, changed, closed := c.link, c.changed, c.closed
+		c.cmu.Unlock()
+		if closed {
+			return nil, ErrPortClosed
 		}
-	}()
-	select {
-	case err := <-done:
-		if err != nil {
-			log.Printf("[Arduino TIMEOUT ERROR] %s", err)
+		if l != nil && l.failure() == nil {
+			return l, nil
+		}
+		if c.sup == nil || c.config.ReconnectWait <= 0 {
+			if l != nil {
+				return nil, l.failure()
+			}
+			return nil, fmt.Errorf("%w: arduino is disconnected", ErrPortClosed)
 		}
+		if timeout == nil {
+			t := time.NewTimer(c.config.ReconnectWait)
+			defer t.Stop()
+			timeout = t.C
+		}
+		select {
+		case <-changed:
+		case <-timeout:
+			return nil, fmt.Errorf("%w: still disconnected after %s", ErrPortClosed, c.config.ReconnectWait)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Reconnect разрывает текущее соединение, чтобы супервизор открыл порт заново.
+// Без супервизора возвращает ошибку.
+func (c *Controller) Reconnect() error {
+	if c.sup == nil {
+		return fmt.Errorf("controller is not supervised")
+	}
+	c.cmu.Lock()
+	l := c.link
+	c.cmu.Unlock()
+	if l != nil {
+		l.close()
+	}
+	return nil
+}
+
+// send (неэкспортируемая) отправляет команду через текущее соединение.
+// Значения настроек запоминаются, чтобы повторить их после переподключения.
+func (c *Controller) send(ctx context.Context, cmd wire.Command) error {
+	l, err := c.current(ctx)
+	if err != nil {
 		return err
-	case <-time.After(700 * time.Millisecond):
-		log.Printf("[Arduino TIMEOUT ERROR] timeout waiting for 'ready' on cmd '%s'", cmd)
-		return fmt.Errorf("timeout waiting for Arduino ready")
 	}
+	c.track(cmd)
+	if err := l.send(ctx, cmd, c.config.Timeouts.forOp(cmd.Op)); err != nil {
+		return err
+	}
+	c.untrack(cmd)
+	if isSetting(cmd.Op) {
+		c.cmu.Lock()
+		c.settings[cmd.Op] = cmd.Arg
+		c.cmu.Unlock()
+	}
+	return nil
 }
 
+// restoreSettings (неэкспортируемая) повторяет на новом соединении
+// настройки, отправленные на прошлое: после переподключения плата могла
+// перезагрузиться и забыть их.
+func (c *Controller) restoreSettings(l *link) {
+	c.cmu.Lock()
+	cmds := make([]wire.Command, 0, len(c.settings))
+	for op, arg := range c.settings {
+		cmds = append(cmds, wire.Command{Op: op, Arg: arg})
+	}
+	c.cmu.Unlock()
+	for _, cmd := range cmds {
+		if err := l.send(context.Background(), cmd, c.config.Timeouts.forOp(cmd.Op)); err != nil {
+			log.Printf("[Arduino] failed to restore %s after reconnect: %v", cmd, err)
+		}
+	}
+}
+
+func isSetting(op wire.Op) bool { return op <= wire.OpSetRandomDelayMouse }
+
 // --- Реализация API ---
+//
+// Каждый метод XxxCtx прерывает ожидание подтверждения, когда ctx отменен,
+// и возвращает ctx.Err(); метод без суффикса Ctx ждет не дольше таймаута
+// своего класса команд из Config.Timeouts.
 
-func (c *Controller) SetDelayKey(ms int) error   { return c.sendAndReceive("00" + strconv.Itoa(ms)) }
-func (c *Controller) SetDelayMouse(ms int) error { return c.sendAndReceive("01" + strconv.Itoa(ms)) }
+func (c *Controller) SetDelayKey(ms int) error { return c.SetDelayKeyCtx(context.Background(), ms) }
+func (c *Controller) SetDelayMouse(ms int) error {
+	return c.SetDelayMouseCtx(context.Background(), ms)
+}
 func (c *Controller) SetDelayMouseMove(ms int) error {
-	return c.sendAndReceive("02" + strconv.Itoa(ms))
+	return c.SetDelayMouseMoveCtx(context.Background(), ms)
 }
 func (c *Controller) SetOffsetMouseMove(step int) error {
-	return c.sendAndReceive("03" + strconv.Itoa(step))
+	return c.SetOffsetMouseMoveCtx(context.Background(), step)
 }
 func (c *Controller) SetRandomDelayKey(rand int) error {
-	return c.sendAndReceive("04" + strconv.Itoa(rand))
+	return c.SetRandomDelayKeyCtx(context.Background(), rand)
 }
 func (c *Controller) SetRandomDelayMouse(rand int) error {
-	return c.sendAndReceive("05" + strconv.Itoa(rand))
+	return c.SetRandomDelayMouseCtx(context.Background(), rand)
+}
+func (c *Controller) Key(code keys.Key) error     { return c.KeyCtx(context.Background(), code) }
+func (c *Controller) Text(text string) error      { return c.TextCtx(context.Background(), text) }
+func (c *Controller) KeyDown(code keys.Key) error { return c.KeyDownCtx(context.Background(), code) }
+func (c *Controller) KeyUp(code keys.Key) error   { return c.KeyUpCtx(context.Background(), code) }
+func (c *Controller) Chord(chord keys.Chord) error {
+	return c.ChordCtx(context.Background(), chord)
 }
-func (c *Controller) Key(code int) error     { return c.sendAndReceive("1" + strconv.Itoa(code)) }
-func (c *Controller) Text(text string) error { return c.sendAndReceive("2" + text) }
-func (c *Controller) KeyDown(code int) error { return c.sendAndReceive("3" + strconv.Itoa(code)) }
-func (c *Controller) KeyUp(code int) error   { return c.sendAndReceive("4" + strconv.Itoa(code)) }
-
 func (c *Controller) MouseMove(targetX, targetY int) error {
-	currentX, currentY, err := getMousePosition()
-	if err != nil {
-		return fmt.Errorf("failed to get current mouse position: %w", err)
+	return c.MouseMoveCtx(context.Background(), targetX, targetY)
+}
+func (c *Controller) MouseMoveAbs(x, y int) error {
+	return c.MouseMoveAbsCtx(context.Background(), x, y)
+}
+func (c *Controller) MouseMoveBy(dx, dy int) error {
+	return c.MouseMoveByCtx(context.Background(), dx, dy)
+}
+func (c *Controller) MouseClick(button int) error {
+	return c.MouseClickCtx(context.Background(), button)
+}
+func (c *Controller) MouseDown(button int) error {
+	return c.MouseDownCtx(context.Background(), button)
+}
+func (c *Controller) MouseUp(button int) error { return c.MouseUpCtx(context.Background(), button) }
+func (c *Controller) MouseWheel(amount int) error {
+	return c.MouseWheelCtx(context.Background(), amount)
+}
+
+func (c *Controller) SetDelayKeyCtx(ctx context.Context, ms int) error {
+	return c.send(ctx, wire.Command{Op: wire.OpSetDelayKey, Arg: ms})
+}
+func (c *Controller) SetDelayMouseCtx(ctx context.Context, ms int) error {
+	return c.send(ctx, wire.Command{Op: wire.OpSetDelayMouse, Arg: ms})
+}
+func (c *Controller) SetDelayMouseMoveCtx(ctx context.Context, ms int) error {
+	return c.send(ctx, wire.Command{Op: wire.OpSetDelayMouseMove, Arg: ms})
+}
+func (c *Controller) SetOffsetMouseMoveCtx(ctx context.Context, step int) error {
+	return c.send(ctx, wire.Command{Op: wire.OpSetOffsetMouseMove, Arg: step})
+}
+func (c *Controller) SetRandomDelayKeyCtx(ctx context.Context, rand int) error {
+	return c.send(ctx, wire.Command{Op: wire.OpSetRandomDelayKey, Arg: rand})
+}
+func (c *Controller) SetRandomDelayMouseCtx(ctx context.Context, rand int) error {
+	return c.send(ctx, wire.Command{Op: wire.OpSetRandomDelayMouse, Arg: rand})
+}
+func (c *Controller) KeyCtx(ctx context.Context, code keys.Key) error {
+	return c.send(ctx, wire.Command{Op: wire.OpKey, Arg: int(code)})
+}
+func (c *Controller) TextCtx(ctx context.Context, text string) error {
+	return c.send(ctx, wire.Command{Op: wire.OpText, Text: text})
+}
+func (c *Controller) KeyDownCtx(ctx context.Context, code keys.Key) error {
+	return c.send(ctx, wire.Command{Op: wire.OpKeyDown, Arg: int(code)})
+}
+func (c *Controller) KeyUpCtx(ctx context.Context, code keys.Key) error {
+	return c.send(ctx, wire.Command{Op: wire.OpKeyUp, Arg: int(code)})
+}
+
+// ChordCtx нажимает модификаторы по порядку, нажимает и отпускает основную
+// клавишу и отпускает модификаторы в обратном порядке. Уже нажатые
+// модификаторы отпускаются и при ошибке, и при отмене ctx; тот, на котором
+// случилась ошибка, тоже: команда могла дойти до платы.
+func (c *Controller) ChordCtx(ctx context.Context, chord keys.Chord) (err error) {
+	for i, m := range chord.Modifiers {
+		if err = c.KeyDownCtx(ctx, m); err != nil {
+			chord.Modifiers = chord.Modifiers[:i+1]
+			break
+		}
 	}
-	deltaX := targetX - currentX
-	deltaY := targetY - currentY
-	znakX := "+"
-	if deltaX < 0 {
-		znakX = "-"
+	if err == nil && chord.Key != 0 {
+		err = c.KeyCtx(ctx, chord.Key)
 	}
-	znakY := "+"
-	if deltaY < 0 {
-		znakY = "-"
+	release := context.WithoutCancel(ctx)
+	for i := len(chord.Modifiers) - 1; i >= 0; i-- {
+		if upErr := c.KeyUpCtx(release, chord.Modifiers[i]); upErr != nil && err == nil {
+			err = upErr
+		}
 	}
-	coordinate := int(math.Abs(float64(deltaX)))*65535 + int(math.Abs(float64(deltaY)))
-	cmd := fmt.Sprintf("5%s%s%d", znakX, znakY, coordinate)
-	return c.sendAndReceive(cmd)
+	return err
 }
 
-func (c *Controller) MouseClick(button int) error {
-	return c.sendAndReceive("6" + strconv.Itoa(button))
+func (c *Controller) MouseClickCtx(ctx context.Context, button int) error {
+	return c.send(ctx, wire.Command{Op: wire.OpMouseClick, Arg: button})
 }
-func (c *Controller) MouseDown(button int) error { return c.sendAndReceive("7" + strconv.Itoa(button)) }
-func (c *Controller) MouseUp(button int) error   { return c.sendAndReceive("8" + strconv.Itoa(button)) }
-func (c *Controller) MouseWheel(amount int) error {
-	return c.sendAndReceive("9" + strconv.Itoa(amount))
+func (c *Controller) MouseDownCtx(ctx context.Context, button int) error {
+	return c.send(ctx, wire.Command{Op: wire.OpMouseDown, Arg: button})
+}
+func (c *Controller) MouseUpCtx(ctx context.Context, button int) error {
+	return c.send(ctx, wire.Command{Op: wire.OpMouseUp, Arg: button})
+}
+func (c *Controller) MouseWheelCtx(ctx context.Context, amount int) error {
+	return c.send(ctx, wire.Command{Op: wire.OpMouseWheel, Arg: amount})
 }
@@ -0,0 +1,82 @@
+package arduinobot
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"arduino-go-bot/arduinobot/emulator"
+	"arduino-go-bot/arduinobot/keys"
+	"arduino-go-bot/arduinobot/wire"
+)
+
+// commandLog (неэкспортируемая) возвращает выполненные эмулятором команды строками.
+func commandLog(emu *emulator.Emulator) []string {
+	var out []string
+	for _, cmd := range emu.Commands() {
+		out = append(out, cmd.String())
+	}
+	return out
+}
+
+// keyCmd (неэкспортируемая) — строка команды op с клавишей k, как в commandLog.
+func keyCmd(op wire.Op, k keys.Key) string {
+	return wire.Command{Op: op, Arg: int(k)}.String()
+}
+
+func TestChord(t *testing.T) {
+	chord := keys.MustParseChord("ctrl+shift+F5")
+	pressed := []string{keyCmd(wire.OpKeyDown, keys.LeftCtrl), keyCmd(wire.OpKeyDown, keys.LeftShift)}
+	released := []string{keyCmd(wire.OpKeyUp, keys.LeftShift), keyCmd(wire.OpKeyUp, keys.LeftCtrl)}
+
+	for _, proto := range []Protocol{ProtocolV1, ProtocolV2} {
+		t.Run(proto.String(), func(t *testing.T) {
+			c, emu := newEmulatedController(t, emulator.Config{Legacy: proto == ProtocolV1}, proto)
+			if err := c.ChordCtx(context.Background(), chord); err != nil {
+				t.Fatal(err)
+			}
+			want := slices.Concat(pressed, []string{keyCmd(wire.OpKey, keys.F5)}, released)
+			if got := commandLog(emu); !slices.Equal(got, want) {
+				t.Errorf("commands %q, want %q", got, want)
+			}
+			if h := c.Held(); !h.Empty() {
+				t.Errorf("still held after the chord: %+v", h)
+			}
+		})
+	}
+
+	t.Run("key fails", func(t *testing.T) {
+		c, emu := newEmulatedController(t, emulator.Config{Ops: without(wire.OpKey)}, ProtocolV2)
+		err := c.ChordCtx(context.Background(), chord)
+		if !errors.Is(err, ErrUnsupported) {
+			t.Fatalf("ChordCtx: %v, want ErrUnsupported", err)
+		}
+		if got, want := commandLog(emu), slices.Concat(pressed, released); !slices.Equal(got, want) {
+			t.Errorf("commands %q, want %q", got, want)
+		}
+		if h := c.Held(); !h.Empty() {
+			t.Errorf("still held after the failed chord: %+v", h)
+		}
+	})
+
+	t.Run("cancelled between modifiers", func(t *testing.T) {
+		const delay = 200 * time.Millisecond
+		c, emu := newEmulatedController(t, emulator.Config{ReplyDelay: delay}, ProtocolV2)
+		chord := keys.MustParseChord("ctrl+shift+alt+F5")
+		// Первый модификатор подтверждается, второй отменяется в полете.
+		ctx, cancel := context.WithTimeout(context.Background(), delay+delay/2)
+		defer cancel()
+		err := c.ChordCtx(ctx, chord)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("ChordCtx: %v, want context.DeadlineExceeded", err)
+		}
+		if got, want := commandLog(emu), slices.Concat(pressed, released); !slices.Equal(got, want) {
+			t.Errorf("commands %q, want %q", got, want)
+		}
+		if h := c.Held(); !h.Empty() {
+			t.Errorf("still held after the cancelled chord: %+v", h)
+		}
+	})
+}
@@ -0,0 +1,165 @@
+package bridge
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"arduino-go-bot/arduinobot/emulator"
+)
+
+// listen (неэкспортируемая) открывает слушающий сокет на localhost.
+func listen(t *testing.T) net.Listener {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	return ln
+}
+
+// startServer (неэкспортируемая) запускает мост к эмулятору и считает,
+// сколько раз открывался порт.
+func startServer(t *testing.T, key string, config emulator.Config) (addr string, emu *emulator.Emulator, opens *atomic.Int32) {
+	t.Helper()
+	emu = emulator.NewWithConfig(config)
+	opens = new(atomic.Int32)
+	s := &Server{
+		Key: []byte(key),
+		Open: func() (Port, string, error) {
+			opens.Add(1)
+			return emu, "emulator", nil
+		},
+		Timeout: time.Second,
+	}
+	ln := listen(t)
+	go s.Serve(ln)
+	t.Cleanup(func() { s.Close() })
+	return ln.Addr().String(), emu, opens
+}
+
+// expectClosed (неэкспортируемая) проверяет, что сервер закрыл conn,
+// ничего больше не прислав.
+func expectClosed(t *testing.T, conn net.Conn) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if n, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("server answered a bad handshake: %d bytes, %v", n, err)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	addr, _, opens := startServer(t, "secret", emulator.Config{})
+
+	c, err := Dial(addr, Config{Key: []byte("secret"), Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("Dial with the right key: %v", err)
+	}
+	c.Close()
+
+	if _, err := Dial(addr, Config{Key: []byte("guess"), Timeout: time.Second}); !errors.Is(err, ErrAuth) {
+		t.Errorf("Dial with a wrong key: %v, want ErrAuth", err)
+	}
+	if _, err := Dial(addr, Config{Timeout: time.Second}); !errors.Is(err, ErrAuth) {
+		t.Errorf("Dial without a key: %v, want ErrAuth", err)
+	}
+	// Порт открыл только клиент с ключом.
+	time.Sleep(50 * time.Millisecond)
+	if n := opens.Load(); n != 1 {
+		t.Errorf("port opened %d times, want 1", n)
+	}
+}
+
+func TestAuthRejectsReplay(t *testing.T) {
+	key := []byte("secret")
+	addr, _, opens := startServer(t, string(key), emulator.Config{})
+
+	// Подслушанное рукопожатие настоящего клиента.
+	first, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	hello := make([]byte, len(magic)+nonceLen)
+	if _, err := io.ReadFull(first, hello); err != nil {
+		t.Fatal(err)
+	}
+	sn := hello[len(magic):]
+	cn := bytes.Repeat([]byte{7}, nonceLen)
+	reply := append(append([]byte(nil), cn...), mac(key, "client", sn, cn)...)
+	if _, err := first.Write(reply); err != nil {
+		t.Fatal(err)
+	}
+	proof := make([]byte, macLen)
+	if _, err := io.ReadFull(first, proof); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(proof, mac(key, "server", sn, cn)) {
+		t.Fatal("server proof does not match the key")
+	}
+
+	// Повтор того же ответа: у сервера уже другой nonce.
+	second, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	again := make([]byte, len(magic)+nonceLen)
+	if _, err := io.ReadFull(second, again); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(again[len(magic):], sn) {
+		t.Fatal("server reused its nonce")
+	}
+	if _, err := second.Write(reply); err != nil {
+		t.Fatal(err)
+	}
+	expectClosed(t, second)
+
+	// Подделанная подпись.
+	third, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer third.Close()
+	if _, err := io.ReadFull(third, again); err != nil {
+		t.Fatal(err)
+	}
+	forged := append(append([]byte(nil), cn...), make([]byte, macLen)...)
+	if _, err := third.Write(forged); err != nil {
+		t.Fatal(err)
+	}
+	expectClosed(t, third)
+
+	if n := opens.Load(); n != 1 {
+		t.Errorf("port opened %d times, want 1", n)
+	}
+}
+
+func TestClientRejectsServerWithoutKey(t *testing.T) {
+	ln := listen(t)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// Сервер с чужим ключом подписывает ответ, не проверив клиента.
+		sn := bytes.Repeat([]byte{1}, nonceLen)
+		conn.Write(append([]byte(magic), sn...))
+		reply := make([]byte, nonceLen+macLen)
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return
+		}
+		conn.Write(mac([]byte("other"), "server", sn, reply[:nonceLen]))
+		io.Copy(io.Discard, conn)
+	}()
+	if _, err := Dial(ln.Addr().String(), Config{Key: []byte("secret"), Timeout: time.Second}); !errors.Is(err, ErrAuth) {
+		t.Errorf("Dial to a server without the key: %v, want ErrAuth", err)
+	}
+}
@@ -0,0 +1,159 @@
+// Package bridge передает обмен с платой по TCP: Server на машине с платой
+// отдает ее последовательный порт по сети, а Conn на другой машине служит
+// arduinobot.Transport, как будто порт подключен к ней. Controller поверх
+// Conn ведет с прошивкой тот же разговор, что и по USB, поэтому рукопожатие,
+// протоколы v1 и v2, трассировка и статистика работают без изменений.
+//
+// Клиент и сервер доказывают друг другу знание общего ключа: каждый присылает
+// случайный nonce и HMAC-SHA256 от обоих nonce. Сам ключ по сети не ходит,
+// но трафик не шифруется; через недоверенную сеть мост стоит пускать по SSH
+// или VPN.
+//
+// После рукопожатия обе стороны обмениваются сообщениями:
+//
+//	тип (1 байт) | длина (uint16 LE) | данные
+//
+// msgData несет байты порта в обе стороны. msgReset просит сервер очистить
+// входной буфер порта, msgResetAck отмечает в потоке место, после которого
+// байты от платы свежие. msgPing и msgPong меряют задержку сети, msgClose
+// сообщает клиенту причину, по которой сервер закрывает соединение.
+package bridge
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+const magic = "ABBRIDGE1"
+
+const (
+	msgData byte = iota + 1
+	msgReset
+	msgResetAck
+	msgPing
+	msgPong
+	msgClose
+)
+
+// maxMessage — наибольшая длина данных одного сообщения.
+const maxMessage = 1<<16 - 1
+
+const (
+	nonceLen = 16
+	macLen   = sha256.Size
+)
+
+// defaultTimeout — сколько ждать рукопожатия и подтверждения сброса буфера.
+const defaultTimeout = 5 * time.Second
+
+// ErrAuth — другая сторона не знает общего ключа.
+var ErrAuth = errors.New("bridge: authentication failed")
+
+// Port — последовательный порт платы на стороне сервера. Ему удовлетворяют
+// serial.Port и arduinobot.Transport.
+type Port interface {
+	io.ReadWriteCloser
+	ResetInputBuffer() error
+}
+
+// mac (неэкспортируемая) подписывает оба nonce ключом key от имени стороны role.
+func mac(key []byte, role string, server, client []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(role))
+	h.Write(server)
+	h.Write(client)
+	return h.Sum(nil)
+}
+
+func nonce() ([]byte, error) {
+	b := make([]byte, nonceLen)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("bridge: %w", err)
+	}
+	return b, nil
+}
+
+// serverAuth (неэкспортируемая) проводит рукопожатие со стороны сервера:
+// шлет magic и свой nonce, проверяет ответ клиента и подписывает свой.
+func serverAuth(conn net.Conn, key []byte, timeout time.Duration) error {
+	conn.SetDeadline(time.Now().Add(timeout))
+	defer conn.SetDeadline(time.Time{})
+	sn, err := nonce()
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(append([]byte(magic), sn...)); err != nil {
+		return err
+	}
+	reply := make([]byte, nonceLen+macLen)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	cn := reply[:nonceLen]
+	if !hmac.Equal(reply[nonceLen:], mac(key, "client", sn, cn)) {
+		return ErrAuth
+	}
+	_, err = conn.Write(mac(key, "server", sn, cn))
+	return err
+}
+
+// clientAuth (неэкспортируемая) — та же процедура со стороны клиента.
+func clientAuth(conn net.Conn, key []byte, timeout time.Duration) error {
+	conn.SetDeadline(time.Now().Add(timeout))
+	defer conn.SetDeadline(time.Time{})
+	hello := make([]byte, len(magic)+nonceLen)
+	if _, err := io.ReadFull(conn, hello); err != nil {
+		return fmt.Errorf("bridge: handshake: %w", err)
+	}
+	if string(hello[:len(magic)]) != magic {
+		return fmt.Errorf("bridge: %s is not an arduino bridge", conn.RemoteAddr())
+	}
+	sn := hello[len(magic):]
+	cn, err := nonce()
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(append(cn, mac(key, "client", sn, cn)...)); err != nil {
+		return fmt.Errorf("bridge: handshake: %w", err)
+	}
+	proof := make([]byte, macLen)
+	if _, err := io.ReadFull(conn, proof); err != nil {
+		// Сервер молча закрывает соединение с клиентом, не знающим ключа.
+		return ErrAuth
+	}
+	if !hmac.Equal(proof, mac(key, "server", sn, cn)) {
+		return ErrAuth
+	}
+	return nil
+}
+
+// writeMessage (неэкспортируемая) пишет одно сообщение; данные длиннее
+// maxMessage — ошибка вызывающего.
+func writeMessage(w io.Writer, typ byte, p []byte) error {
+	b := make([]byte, 3+len(p))
+	b[0] = typ
+	binary.LittleEndian.PutUint16(b[1:], uint16(len(p)))
+	copy(b[3:], p)
+	_, err := w.Write(b)
+	return err
+}
+
+// readMessage (неэкспортируемая) читает одно сообщение.
+func readMessage(r io.Reader) (byte, []byte, error) {
+	var hdr [3]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	p := make([]byte, binary.LittleEndian.Uint16(hdr[1:]))
+	if _, err := io.ReadFull(r, p); err != nil {
+		return 0, nil, err
+	}
+	return hdr[0], p, nil
+}
@@ -0,0 +1,110 @@
+package bridge_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"arduino-go-bot/arduinobot"
+	"arduino-go-bot/arduinobot/bridge"
+	"arduino-go-bot/arduinobot/emulator"
+	"arduino-go-bot/arduinobot/keys"
+	"arduino-go-bot/arduinobot/wire"
+)
+
+func TestControllerOverBridge(t *testing.T) {
+	tests := []struct {
+		name   string
+		config emulator.Config
+		proto  arduinobot.Protocol
+	}{
+		{"v1", emulator.Config{Legacy: true}, arduinobot.ProtocolV1},
+		{"v2", emulator.Config{}, arduinobot.ProtocolV2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			emu := emulator.NewWithConfig(tt.config)
+			s := &bridge.Server{
+				Key:  []byte("secret"),
+				Open: func() (bridge.Port, string, error) { return emu, "emulator", nil },
+			}
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			go s.Serve(ln)
+			t.Cleanup(func() {
+				ln.Close()
+				s.Close()
+			})
+
+			c, err := arduinobot.NewController(arduinobot.Config{
+				Port:        "tcp://" + ln.Addr().String(),
+				BridgeKey:   "secret",
+				Protocol:    tt.proto,
+				BootTimeout: time.Second,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			if got := c.Info().Protocol; got != tt.proto {
+				t.Errorf("negotiated %s over the bridge, want %s", got, tt.proto)
+			}
+
+			if err := c.SetDelayKey(30); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Key(keys.Enter); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.MouseClick(1); err != nil {
+				t.Fatal(err)
+			}
+			want := []wire.Command{
+				{Op: wire.OpSetDelayKey, Arg: 30},
+				{Op: wire.OpKey, Arg: int(keys.Enter)},
+				{Op: wire.OpMouseClick, Arg: 1},
+			}
+			var got []wire.Command
+			for _, cmd := range emu.Commands() {
+				if cmd.Op != wire.OpHello {
+					got = append(got, cmd)
+				}
+			}
+			if len(got) != len(want) {
+				t.Fatalf("board received %v, want %v", got, want)
+			}
+			for i := range want {
+				if got[i].Op != want[i].Op || got[i].Arg != want[i].Arg {
+					t.Errorf("command %d = %s, want %s", i, got[i], want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestControllerWrongBridgeKey(t *testing.T) {
+	s := &bridge.Server{
+		Key: []byte("secret"),
+		Open: func() (bridge.Port, string, error) {
+			t.Error("port opened for a client without the key")
+			return emulator.New(), "emulator", nil
+		},
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(ln)
+	defer ln.Close()
+
+	_, err = arduinobot.NewController(arduinobot.Config{
+		Port:      "tcp://" + ln.Addr().String(),
+		BridgeKey: "guess",
+	})
+	if !errors.Is(err, bridge.ErrAuth) {
+		t.Fatalf("NewController with a wrong bridge key: %v, want ErrAuth", err)
+	}
+}
@@ -0,0 +1,256 @@
+package bridge
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// missedPings — сколько интервалов пинга можно не получать ответа, прежде
+// чем Conn сочтет соединение мертвым.
+const missedPings = 3
+
+// Config настраивает Conn.
+type Config struct {
+	// Key — общий ключ, тот же, что у сервера.
+	Key []byte
+	// Timeout — сколько ждать подключения, рукопожатия и подтверждения
+	// ResetInputBuffer. Ноль — 5 секунд.
+	Timeout time.Duration
+	// PingInterval — как часто мерить задержку до сервера. Соединение,
+	// на котором сервер не ответил на пинги за несколько интервалов,
+	// закрывается с ошибкой. Ноль — не пинговать.
+	PingInterval time.Duration
+	// OnRTT, если задан, получает каждую измеренную задержку.
+	OnRTT func(time.Duration)
+}
+
+// Conn — порт платы за мостом. Удовлетворяет arduinobot.Transport.
+type Conn struct {
+	config Config
+	conn   net.Conn
+
+	wmu sync.Mutex // сериализует запись сообщений
+
+	mu        sync.Mutex
+	cond      *sync.Cond
+	buf       []byte
+	err       error
+	resetID   uint32
+	resetDone chan struct{} // закрывается, когда пришел msgResetAck на resetID
+	pingSeq   uint64
+	pingAt    time.Time
+	rtt       time.Duration
+	pong      time.Time
+	done      chan struct{}
+}
+
+// Dial подключается к серверу моста по адресу addr (host:port).
+func Dial(addr string, config Config) (*Conn, error) {
+	if config.Timeout <= 0 {
+		config.Timeout = defaultTimeout
+	}
+	conn, err := net.DialTimeout("tcp", addr, config.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("bridge: %w", err)
+	}
+	if err := clientAuth(conn, config.Key, config.Timeout); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c := &Conn{config: config, conn: conn, pong: time.Now(), done: make(chan struct{})}
+	c.cond = sync.NewCond(&c.mu)
+	go c.readLoop()
+	if config.PingInterval > 0 {
+		go c.pingLoop()
+	}
+	return c, nil
+}
+
+// Read возвращает байты от платы, ожидая их, пока соединение живо.
+func (c *Conn) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.buf) == 0 && c.err == nil {
+		c.cond.Wait()
+	}
+	if len(c.buf) == 0 {
+		return 0, c.err
+	}
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+// Write передает байты плате. Каждый вызов уходит в порт одной записью,
+// поэтому паузы между командами v1 сохраняются.
+func (c *Conn) Write(p []byte) (int, error) {
+	for sent := 0; sent < len(p); {
+		n := min(len(p)-sent, maxMessage)
+		if err := c.send(msgData, p[sent:sent+n]); err != nil {
+			return sent, err
+		}
+		sent += n
+	}
+	return len(p), nil
+}
+
+// ResetInputBuffer очищает входной буфер порта на сервере и отбрасывает все,
+// что от него пришло до очистки.
+func (c *Conn) ResetInputBuffer() error {
+	c.mu.Lock()
+	if c.err != nil {
+		defer c.mu.Unlock()
+		return c.err
+	}
+	c.resetID++
+	id := c.resetID
+	done := make(chan struct{})
+	c.buf, c.resetDone = nil, done
+	c.mu.Unlock()
+
+	var p [4]byte
+	binary.LittleEndian.PutUint32(p[:], id)
+	if err := c.send(msgReset, p[:]); err != nil {
+		return err
+	}
+	select {
+	case <-done:
+		return nil
+	case <-c.done:
+		return c.failure()
+	case <-time.After(c.config.Timeout):
+		c.mu.Lock()
+		if c.resetDone == done {
+			c.resetDone = nil
+		}
+		c.mu.Unlock()
+		return fmt.Errorf("bridge: no reply to input buffer reset after %s", c.config.Timeout)
+	}
+}
+
+// RTT возвращает последнюю измеренную задержку до сервера и обратно;
+// ноль, пока пингов не было.
+func (c *Conn) RTT() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rtt
+}
+
+// Close закрывает соединение; ожидающий Read возвращает net.ErrClosed.
+func (c *Conn) Close() error {
+	c.fail(net.ErrClosed)
+	return c.conn.Close()
+}
+
+func (c *Conn) send(typ byte, p []byte) error {
+	if err := c.failure(); err != nil {
+		return err
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if err := writeMessage(c.conn, typ, p); err != nil {
+		err = fmt.Errorf("bridge: %w", err)
+		c.fail(err)
+		return err
+	}
+	return nil
+}
+
+func (c *Conn) failure() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// fail (неэкспортируемая) запоминает первую причину разрыва и будит
+// ожидающих.
+func (c *Conn) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	close(c.done)
+	c.cond.Broadcast()
+}
+
+func (c *Conn) readLoop() {
+	r := bufio.NewReader(c.conn)
+	for {
+		typ, p, err := readMessage(r)
+		if err != nil {
+			c.fail(fmt.Errorf("bridge: %w", err))
+			c.conn.Close()
+			return
+		}
+		switch typ {
+		case msgData:
+			c.mu.Lock()
+			// До подтверждения сброса идут байты, пришедшие в порт раньше него.
+			if c.resetDone == nil {
+				c.buf = append(c.buf, p...)
+				c.cond.Broadcast()
+			}
+			c.mu.Unlock()
+		case msgResetAck:
+			c.mu.Lock()
+			if c.resetDone != nil && len(p) == 4 && binary.LittleEndian.Uint32(p) == c.resetID {
+				close(c.resetDone)
+				c.resetDone = nil
+			}
+			c.mu.Unlock()
+		case msgPong:
+			c.mu.Lock()
+			c.pong = time.Now()
+			// Ответ на пинг, после которого ушел следующий, не измеряется.
+			ok := len(p) == 8 && binary.LittleEndian.Uint64(p) == c.pingSeq
+			if ok {
+				c.rtt = time.Since(c.pingAt)
+			}
+			rtt := c.rtt
+			c.mu.Unlock()
+			if ok && c.config.OnRTT != nil {
+				c.config.OnRTT(rtt)
+			}
+		case msgClose:
+			c.fail(fmt.Errorf("bridge: closed by server: %s", p))
+			c.conn.Close()
+			return
+		}
+	}
+}
+
+func (c *Conn) pingLoop() {
+	interval := c.config.PingInterval
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+		c.mu.Lock()
+		silent := time.Since(c.pong)
+		c.pingSeq++
+		c.pingAt = time.Now()
+		seq := c.pingSeq
+		c.mu.Unlock()
+		if silent > missedPings*interval+c.config.Timeout {
+			c.fail(errors.New("bridge: server stopped answering pings"))
+			c.conn.Close()
+			return
+		}
+		var p [8]byte
+		binary.LittleEndian.PutUint64(p[:], seq)
+		if c.send(msgPing, p[:]) != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package bridge
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// Server отдает порт платы клиентам моста. Клиент в каждый момент один:
+// новый клиент, прошедший рукопожатие, вытесняет прежнего — так переподключение
+// после обрыва сети не ждет, пока сервер заметит полуоткрытое соединение.
+// Порт открывается при первом подключении и остается открытым между
+// клиентами; после ошибки порта он открывается заново при следующем.
+type Server struct {
+	// Key — общий ключ моста.
+	Key []byte
+	// Open открывает порт платы и возвращает его имя для журнала.
+	Open func() (Port, string, error)
+	// Timeout — сколько ждать рукопожатия клиента и того, что он примет
+	// очередное сообщение. Ноль — 5 секунд.
+	Timeout time.Duration
+
+	mu      sync.Mutex
+	port    Port
+	name    string
+	current *session
+	// fwd упорядочивает пересылку байт порта и подтверждение сброса буфера.
+	fwd sync.Mutex
+}
+
+// session — одно подключение клиента.
+type session struct {
+	conn net.Conn
+	// timeout — сколько ждать, пока клиент примет очередное сообщение.
+	timeout time.Duration
+	wmu     sync.Mutex
+}
+
+// send (неэкспортируемая) пишет сообщение клиенту. Клиент, который перестал
+// читать, не задерживает пересылку дольше timeout: после ошибки записи
+// соединение закрывается.
+func (s *session) send(typ byte, p []byte) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	s.conn.SetWriteDeadline(time.Now().Add(s.timeout))
+	err := writeMessage(s.conn, typ, p)
+	if err != nil {
+		s.conn.Close()
+	}
+	return err
+}
+
+// closeWith (неэкспортируемая) сообщает клиенту причину и закрывает соединение.
+// Если в соединение уже кто-то пишет, причина не отправляется: закрытие не
+// ждет клиента, который перестал читать, и заодно прерывает ту запись.
+func (s *session) closeWith(reason string) {
+	if s.wmu.TryLock() {
+		s.conn.SetWriteDeadline(time.Now().Add(s.timeout))
+		writeMessage(s.conn, msgClose, []byte(reason))
+		s.wmu.Unlock()
+	}
+	s.conn.Close()
+}
+
+// Serve принимает клиентов с ln, пока ln не закроют, и возвращает ошибку
+// Accept. Порт при этом остается открытым; его закрывает Close.
+func (s *Server) Serve(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+// Close отключает клиента и закрывает порт.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	sess, port := s.current, s.port
+	s.current, s.port = nil, nil
+	s.mu.Unlock()
+	if sess != nil {
+		sess.closeWith("bridge is shutting down")
+	}
+	if port != nil {
+		return port.Close()
+	}
+	return nil
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	if err := serverAuth(conn, s.Key, timeout); err != nil {
+		log.Printf("[bridge] %s rejected: %v", conn.RemoteAddr(), err)
+		return
+	}
+	sess := &session{conn: conn, timeout: timeout}
+	port, err := s.attach(sess)
+	if err != nil {
+		log.Printf("[bridge] %s: %v", conn.RemoteAddr(), err)
+		sess.closeWith(err.Error())
+		return
+	}
+	defer s.detach(sess)
+
+	r := bufio.NewReader(conn)
+	for {
+		typ, p, err := readMessage(r)
+		if err != nil {
+			log.Printf("[bridge] %s disconnected: %v", conn.RemoteAddr(), err)
+			return
+		}
+		switch typ {
+		case msgData:
+			if _, err := port.Write(p); err != nil {
+				s.portFailed(port, err)
+				return
+			}
+		case msgReset:
+			s.fwd.Lock()
+			err := port.ResetInputBuffer()
+			if err == nil {
+				err = sess.send(msgResetAck, p)
+			}
+			s.fwd.Unlock()
+			if err != nil {
+				s.portFailed(port, err)
+				return
+			}
+		case msgPing:
+			sess.send(msgPong, p)
+		}
+	}
+}
+
+// attach (неэкспортируемая) делает sess текущим клиентом, открывая порт,
+// если он еще не открыт. Прежний клиент отключается.
+func (s *Server) attach(sess *session) (Port, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old := s.current; old != nil {
+		log.Printf("[bridge] %s replaced by %s", old.conn.RemoteAddr(), sess.conn.RemoteAddr())
+		go old.closeWith("replaced by another client")
+	}
+	s.current = sess
+	if s.port != nil {
+		log.Printf("[bridge] %s connected to %s", sess.conn.RemoteAddr(), s.name)
+		return s.port, nil
+	}
+	port, name, err := s.Open()
+	if err != nil {
+		s.current = nil
+		return nil, fmt.Errorf("failed to open the board: %w", err)
+	}
+	s.port, s.name = port, name
+	log.Printf("[bridge] %s connected, opened %s", sess.conn.RemoteAddr(), name)
+	go s.readPort(port)
+	return port, nil
+}
+
+func (s *Server) detach(sess *session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current == sess {
+		s.current = nil
+	}
+}
+
+// readPort (неэкспортируемая) пересылает байты порта текущему клиенту.
+// Без клиента байты теряются, как теряются в порту, который никто не читает.
+func (s *Server) readPort(port Port) {
+	buf := make([]byte, 256)
+	for {
+		n, err := port.Read(buf)
+		if n > 0 {
+			s.fwd.Lock()
+			s.mu.Lock()
+			sess := s.current
+			s.mu.Unlock()
+			if sess != nil {
+				if err := sess.send(msgData, buf[:n]); err != nil {
+					log.Printf("[bridge] %s dropped: %v", sess.conn.RemoteAddr(), err)
+				}
+			}
+			s.fwd.Unlock()
+		}
+		if err != nil {
+			s.portFailed(port, err)
+			return
+		}
+		// Чтение с таймаутом порта возвращает 0 байт без ошибки.
+		if n == 0 && s.closed(port) {
+			return
+		}
+	}
+}
+
+func (s *Server) closed(port Port) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.port != port
+}
+
+// portFailed (неэкспортируемая) закрывает сломавшийся порт и отключает
+// клиента: тот переподключится, и порт откроется заново.
+func (s *Server) portFailed(port Port, err error) {
+	s.mu.Lock()
+	if s.port != port {
+		s.mu.Unlock()
+		return
+	}
+	sess, name := s.current, s.name
+	s.port, s.current = nil, nil
+	s.mu.Unlock()
+	log.Printf("[bridge] %s failed: %v", name, err)
+	port.Close()
+	if sess != nil {
+		sess.closeWith(fmt.Sprintf("port %s failed: %v", name, err))
+	}
+}
@@ -0,0 +1,107 @@
+package bridge
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// floodPort (неэкспортируемая) — порт платы, который без остановки шлет байты.
+type floodPort struct {
+	once   sync.Once
+	closed chan struct{}
+}
+
+func newFloodPort() *floodPort { return &floodPort{closed: make(chan struct{})} }
+
+func (p *floodPort) Read(b []byte) (int, error) {
+	select {
+	case <-p.closed:
+		return 0, io.EOF
+	default:
+	}
+	return copy(b, bytes.Repeat([]byte("x"), len(b))), nil
+}
+
+func (p *floodPort) Write(b []byte) (int, error) { return len(b), nil }
+func (p *floodPort) ResetInputBuffer() error     { return nil }
+
+func (p *floodPort) Close() error {
+	p.once.Do(func() { close(p.closed) })
+	return nil
+}
+
+// rawClient (неэкспортируемая) проходит рукопожатие и дальше ничего не читает.
+func rawClient(t *testing.T, addr string, key []byte) net.Conn {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if err := clientAuth(conn, key, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestClientThatStopsReading(t *testing.T) {
+	key := []byte("secret")
+	s := &Server{
+		Key:     key,
+		Open:    func() (Port, string, error) { return newFloodPort(), "flood", nil },
+		Timeout: 500 * time.Millisecond,
+	}
+	ln := listen(t)
+	go s.Serve(ln)
+	addr := ln.Addr().String()
+
+	// Прежний клиент не читает: буферы сокета заполняются, и пересылка
+	// упирается в запись ему.
+	rawClient(t, addr, key)
+	time.Sleep(300 * time.Millisecond)
+
+	// Новый клиент вытесняет его и получает байты платы, не дожидаясь,
+	// пока прежний освободит пересылку.
+	c, err := Dial(addr, Config{Key: key, Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	got := make(chan error, 1)
+	go func() {
+		_, err := io.ReadFull(c, make([]byte, 4096))
+		got <- err
+	}()
+	select {
+	case err := <-got:
+		if err != nil {
+			t.Fatalf("new client: %v", err)
+		}
+	case <-time.After(250 * time.Millisecond):
+		t.Fatal("new client got no data while the old one was not reading")
+	}
+
+	// Клиент, который перестал читать, и без замены отключается через Timeout.
+	c.Close()
+	stuck := rawClient(t, addr, key)
+	time.Sleep(2 * s.Timeout)
+	stuck.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.Copy(io.Discard, stuck); err != nil {
+		t.Errorf("stalled client was not disconnected: %v", err)
+	}
+
+	closed := make(chan error, 1)
+	go func() { closed <- s.Close() }()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Errorf("Close: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Close blocked")
+	}
+}
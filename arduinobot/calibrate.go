@@ -0,0 +1,281 @@
+package arduinobot
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"arduino-go-bot/arduinobot/wire"
+	"arduino-go-bot/platform"
+)
+
+// CursorSource сообщает, где сейчас курсор на рабочем столе.
+type CursorSource interface {
+	CursorPosition() (image.Point, error)
+}
+
+// SystemCursor читает положение курсора у операционной системы.
+var SystemCursor CursorSource = platform.Current
+
+const (
+	// cursorSettle — сколько ждать, пока система применит отправленные отчеты.
+	cursorSettle = 30 * time.Millisecond
+	// defaultMaxCorrections — сколько поправочных сдвигов делает MouseMove
+	// при заданном Config.Tolerance.
+	defaultMaxCorrections = 5
+	// calibrationTravel — примерный путь в отсчетах HID для одного замера.
+	calibrationTravel = 200
+)
+
+// calibrationCounts — размеры отчетов, на которых Calibrate снимает кривую.
+var calibrationCounts = []int{1, 2, 3, 5, 8, 12, 20, 32, 50, 80, wire.MaxStep}
+
+// CurvePoint — сколько пикселей проходит курсор за один HID-отчет
+// со смещением Counts по оси.
+type CurvePoint struct {
+	Counts int     `json:"counts"`
+	Pixels float64 `json:"pixels"`
+}
+
+// Curve — поправочная кривая ускорения указателя: точки по возрастанию
+// Counts, между ними — линейная интерполяция. Скорость указателя Windows
+// и «повышенная точность» масштабируют каждый отчет в зависимости от его
+// размера, поэтому один отсчет HID не равен одному пикселю. Пустая кривая
+// означает, что равен.
+type Curve []CurvePoint
+
+// Validate проверяет, что точки кривой идут по строго возрастающему Counts
+// в пределах 1..wire.MaxStep, путь Pixels с ростом Counts не убывает, а у
+// последней точки он положителен. Пустая кривая допустима.
+func (cv Curve) Validate() error {
+	prev := CurvePoint{}
+	for i, p := range cv {
+		if p.Counts <= prev.Counts || p.Counts > wire.MaxStep {
+			return fmt.Errorf("curve point %d: counts %d must be above %d and at most %d", i, p.Counts, prev.Counts, wire.MaxStep)
+		}
+		if p.Pixels < prev.Pixels || math.IsNaN(p.Pixels) || math.IsInf(p.Pixels, 0) {
+			return fmt.Errorf("curve point %d: pixels %g must not be below %g", i, p.Pixels, prev.Pixels)
+		}
+		prev = p
+	}
+	if len(cv) > 0 && prev.Pixels <= 0 {
+		return fmt.Errorf("curve never moves the cursor: %g pixels at %d counts", prev.Pixels, prev.Counts)
+	}
+	return nil
+}
+
+// Pixels возвращает путь курсора в пикселях за отчет в counts отсчетов.
+func (cv Curve) Pixels(counts int) float64 {
+	if counts < 0 {
+		return -cv.Pixels(-counts)
+	}
+	prev := CurvePoint{}
+	for _, p := range cv {
+		if counts <= p.Counts {
+			if p.Counts == prev.Counts {
+				return p.Pixels
+			}
+			t := float64(counts-prev.Counts) / float64(p.Counts-prev.Counts)
+			return prev.Pixels + t*(p.Pixels-prev.Pixels)
+		}
+		prev = p
+	}
+	if len(cv) == 0 || prev.Counts == 0 {
+		return float64(counts)
+	}
+	// За последней точкой — с ее средним усилением.
+	return float64(counts) * prev.Pixels / float64(prev.Counts)
+}
+
+// Counts — обратное к Pixels: размер отчета (0..wire.MaxStep), путь
+// которого ближе всего к pixels.
+func (cv Curve) Counts(pixels float64) int {
+	if pixels < 0 {
+		return -cv.Counts(-pixels)
+	}
+	c := sort.Search(wire.MaxStep+1, func(c int) bool { return cv.Pixels(c) >= pixels })
+	if c > wire.MaxStep {
+		return wire.MaxStep
+	}
+	if c > 0 && pixels-cv.Pixels(c-1) < cv.Pixels(c)-pixels {
+		c--
+	}
+	return c
+}
+
+// plan (неэкспортируемая) раскладывает путь d пикселей по одной оси на
+// размеры отчетов: сначала самые крупные, затем остаток.
+func (cv Curve) plan(d int) []int {
+	sign := 1
+	if d < 0 {
+		sign, d = -1, -d
+	}
+	step := cv.Pixels(wire.MaxStep)
+	if step <= 0 {
+		return nil
+	}
+	n := int(float64(d) / step)
+	out := make([]int, n, n+2)
+	for i := range out {
+		out[i] = sign * wire.MaxStep
+	}
+	for rest := float64(d) - float64(n)*step; rest >= 0.5; {
+		c := cv.Counts(rest)
+		if c == 0 {
+			break
+		}
+		out = append(out, sign*c)
+		rest -= cv.Pixels(c)
+	}
+	return out
+}
+
+// planSteps (неэкспортируемая) — шаги HID для сдвига на dx,dy пикселей.
+// Без кривой совпадает с wire.PlanSteps.
+func (cv Curve) planSteps(dx, dy int) []wire.Step {
+	if len(cv) == 0 {
+		return wire.PlanSteps(dx, dy)
+	}
+	xs, ys := cv.plan(dx), cv.plan(dy)
+	steps := make([]wire.Step, max(len(xs), len(ys)))
+	for i := range steps {
+		if i < len(xs) {
+			steps[i].DX = int8(xs[i])
+		}
+		if i < len(ys) {
+			steps[i].DY = int8(ys[i])
+		}
+	}
+	return steps
+}
+
+// scale (неэкспортируемая) переводит пиксели в отсчеты по усилению самых
+// крупных отчетов — для прошивки v1, которая сама режет сдвиг на отчеты.
+func (cv Curve) scale(d int) int {
+	if len(cv) == 0 {
+		return d
+	}
+	return int(math.Round(float64(d) * wire.MaxStep / cv.Pixels(wire.MaxStep)))
+}
+
+// Calibrate снимает поправочную кривую: для каждого размера отчета сдвигает
+// курсор вправо и обратно и измеряет по src, сколько пикселей он прошел.
+// Пустой src означает Config.CursorSource. Курсор заранее ставится в центр
+// рабочего стола, если прошивка умеет абсолютное позиционирование.
+// Результат сохраняется в Config.Curve и используется следующими сдвигами.
+// Отчеты заданного размера отправляются командой wire.OpMouseSteps, которая
+// есть только в протоколе v2; прошивка v1 сама режет сдвиг на отчеты, и
+// калибровка на ней возвращает ErrUnsupported.
+func (c *Controller) Calibrate(ctx context.Context, src CursorSource) (Curve, error) {
+	info := c.Info()
+	if !info.Supports(wire.OpMouseSteps) {
+		return nil, &UnsupportedError{Op: wire.OpMouseSteps, Firmware: info.Firmware}
+	}
+	if src == nil {
+		src = c.cursorSource()
+	}
+	if info.Supports(wire.OpMouseMoveAbs) {
+		if desktop, err := c.desktop(); err == nil {
+			center := desktop.Min.Add(desktop.Size().Div(2))
+			if err := c.MouseMoveAbsCtx(ctx, center.X, center.Y); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	curve := make(Curve, 0, len(calibrationCounts))
+	for _, counts := range calibrationCounts {
+		reps := max(2, calibrationTravel/counts)
+		// Край стола может остановить курсор в одну сторону, но не в обе:
+		// берется больший из двух путей.
+		var travelled int
+		for _, dir := range []int{1, -1} {
+			before, err := c.measure(ctx, src)
+			if err != nil {
+				return nil, err
+			}
+			steps := make([]wire.Step, reps)
+			for i := range steps {
+				steps[i] = wire.Step{DX: int8(dir * counts)}
+			}
+			if err := c.sendSteps(ctx, steps); err != nil {
+				return nil, err
+			}
+			after, err := c.measure(ctx, src)
+			if err != nil {
+				return nil, err
+			}
+			travelled = max(travelled, dir*(after.X-before.X))
+		}
+		if travelled <= 0 {
+			return nil, fmt.Errorf("cursor did not move on %d-count reports; check the cursor source", counts)
+		}
+		px := float64(travelled) / float64(reps)
+		if n := len(curve); n > 0 && px < curve[n-1].Pixels {
+			px = curve[n-1].Pixels // шум замера не должен делать кривую убывающей
+		}
+		curve = append(curve, CurvePoint{Counts: counts, Pixels: px})
+		log.Printf("[Arduino] calibration: %d counts -> %.2f px", counts, px)
+	}
+	c.cmu.Lock()
+	c.config.Curve = curve
+	c.cmu.Unlock()
+	return curve, nil
+}
+
+// measure (неэкспортируемая) ждет, пока система применит отчеты, и читает курсор.
+func (c *Controller) measure(ctx context.Context, src CursorSource) (image.Point, error) {
+	select {
+	case <-time.After(cursorSettle):
+	case <-ctx.Done():
+		return image.Point{}, ctx.Err()
+	}
+	p, err := src.CursorPosition()
+	if err != nil {
+		return image.Point{}, fmt.Errorf("failed to read cursor position: %w", err)
+	}
+	return p, nil
+}
+
+// settle (неэкспортируемая) поправляет курсор, пока он не окажется ближе
+// Config.Tolerance к target, но не больше Config.MaxCorrections раз.
+func (c *Controller) settle(ctx context.Context, target image.Point) error {
+	src := c.cursorSource()
+	tries := c.config.MaxCorrections
+	if tries <= 0 {
+		tries = defaultMaxCorrections
+	}
+	for i := 0; ; i++ {
+		pos, err := c.measure(ctx, src)
+		if err != nil {
+			return err
+		}
+		d := target.Sub(pos)
+		if max(d.X, -d.X) <= c.config.Tolerance && max(d.Y, -d.Y) <= c.config.Tolerance {
+			return nil
+		}
+		if i == tries {
+			return &OffTargetError{Want: target, Got: pos}
+		}
+		if err := c.MouseMoveByCtx(ctx, d.X, d.Y); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Controller) cursorSource() CursorSource {
+	if c.config.CursorSource != nil {
+		return c.config.CursorSource
+	}
+	return SystemCursor
+}
+
+func (c *Controller) curve() Curve {
+	c.cmu.Lock()
+	defer c.cmu.Unlock()
+	return c.config.Curve
+}
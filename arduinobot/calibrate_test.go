@@ -0,0 +1,83 @@
+package arduinobot
+
+import (
+	"context"
+	"errors"
+	"image"
+	"math"
+	"testing"
+
+	"arduino-go-bot/arduinobot/emulator"
+)
+
+func TestCurveValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		curve Curve
+		ok    bool
+	}{
+		{"empty", nil, true},
+		{"calibrated", Curve{{1, 0.5}, {8, 6}, {127, 300}}, true},
+		{"flat segment", Curve{{1, 1}, {2, 1}, {3, 4}}, true},
+		{"zero counts", Curve{{0, 0}, {5, 5}}, false},
+		{"repeated counts", Curve{{5, 5}, {5, 6}}, false},
+		{"decreasing counts", Curve{{10, 10}, {5, 12}}, false},
+		{"beyond MaxStep", Curve{{200, 300}}, false},
+		{"decreasing pixels", Curve{{1, 2}, {2, 1}}, false},
+		{"no movement", Curve{{1, 0}, {127, 0}}, false},
+		{"NaN", Curve{{1, math.NaN()}}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.curve.Validate(); (err == nil) != tt.ok {
+			t.Errorf("%s: Validate() = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestCalibrate(t *testing.T) {
+	// Указатель с ускорением: крупные отчеты проходят вдвое больше пикселей.
+	speed := func(counts int) int {
+		if max(counts, -counts) > 10 {
+			return 2 * counts
+		}
+		return counts
+	}
+	c, emu := newEmulatedController(t, emulator.Config{PointerSpeed: speed}, ProtocolV2)
+	curve, err := c.Calibrate(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := curve.Validate(); err != nil {
+		t.Fatalf("calibrated curve is invalid: %v", err)
+	}
+	for _, p := range curve {
+		if want := float64(speed(p.Counts)); p.Pixels != want {
+			t.Errorf("%d counts -> %g px, want %g", p.Counts, p.Pixels, want)
+		}
+	}
+	// С кривой относительный сдвиг попадает в цель несмотря на ускорение.
+	start := emu.Cursor()
+	if err := c.MouseMoveBy(-700, 260); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := emu.Cursor(), start.Add(image.Pt(-700, 260)); got != want {
+		t.Errorf("cursor = %v, want %v", got, want)
+	}
+}
+
+func TestCalibrateUnsupportedOnV1(t *testing.T) {
+	c, emu := newEmulatedController(t, emulator.Config{Legacy: true}, ProtocolV1)
+	if _, err := c.Calibrate(context.Background(), nil); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("Calibrate on v1 = %v, want ErrUnsupported", err)
+	}
+	if n := len(emu.Commands()); n != 0 {
+		t.Errorf("calibration sent %d commands to v1 firmware", n)
+	}
+}
+
+func TestNewControllerRejectsBadCurve(t *testing.T) {
+	_, err := NewControllerWithTransport(Config{Curve: Curve{{5, 5}, {3, 6}}}, emulator.New())
+	if err == nil {
+		t.Fatal("NewControllerWithTransport accepted a decreasing curve")
+	}
+}
@@ -0,0 +1,154 @@
+package arduinobot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"go.bug.st/serial/enumerator"
+)
+
+// USBID — пара идентификаторов USB-устройства в шестнадцатеричном виде.
+type USBID struct {
+	VID string `json:"vid"`
+	PID string `json:"pid"`
+}
+
+func (id USBID) String() string { return id.VID + ":" + id.PID }
+
+// DefaultDevices — платы с нативным USB HID, которые ищутся, если в Config
+// не задано ни одного VID/PID.
+var DefaultDevices = []USBID{
+	{VID: "2341", PID: "8036"}, // Arduino Leonardo
+	{VID: "2341", PID: "8037"}, // Arduino Micro
+	{VID: "1B4F", PID: "9206"}, // SparkFun Pro Micro
+}
+
+// Device — последовательный порт, найденный Discover, со сведениями о нем.
+type Device struct {
+	Port         string
+	VID          string
+	PID          string
+	SerialNumber string
+	Product      string
+	// Match — порт подходит под критерии Config, переданной в Discover.
+	Match bool
+}
+
+func (d Device) String() string {
+	if d.SerialNumber == "" {
+		return fmt.Sprintf("%s (%s:%s %s)", d.Port, d.VID, d.PID, d.Product)
+	}
+	return fmt.Sprintf("%s (%s:%s %s, serial %s)", d.Port, d.VID, d.PID, d.Product, d.SerialNumber)
+}
+
+// devices (неэкспортируемая) возвращает VID/PID, под которые подходит плата:
+// Config.Devices, затем Config.VID/PID, а если не задано ничего — DefaultDevices.
+func (c Config) devices() []USBID {
+	ids := append([]USBID(nil), c.Devices...)
+	if c.VID != "" || c.PID != "" {
+		ids = append(ids, USBID{VID: c.VID, PID: c.PID})
+	}
+	if len(ids) == 0 {
+		return DefaultDevices
+	}
+	return ids
+}
+
+// matches (неэкспортируемая) сообщает, подходит ли порт под критерии c.
+// Явно заданный Config.Port перекрывает все остальные критерии.
+func (c Config) matches(d Device) bool {
+	if c.Port != "" {
+		return strings.EqualFold(d.Port, c.Port)
+	}
+	if d.VID == "" {
+		return false // не USB
+	}
+	if c.SerialNumber != "" && !strings.EqualFold(d.SerialNumber, c.SerialNumber) {
+		return false
+	}
+	for _, id := range c.devices() {
+		if (id.VID == "" || strings.EqualFold(d.VID, id.VID)) &&
+			(id.PID == "" || strings.EqualFold(d.PID, id.PID)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Discover перечисляет все последовательные порты системы и отмечает те,
+// что подходят под config. Порты, которые подходят, идут первыми.
+func Discover(config Config) ([]Device, error) {
+	ports, err := enumerator.GetDetailedPortsList()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list serial ports: %w", err)
+	}
+	return classify(config, ports), nil
+}
+
+// classify (неэкспортируемая) превращает порты системы в Device и отмечает
+// подходящие под config, сохраняя порядок внутри подходящих и остальных.
+func classify(config Config, ports []*enumerator.PortDetails) []Device {
+	var matched, rest []Device
+	for _, p := range ports {
+		d := Device{Port: p.Name, SerialNumber: p.SerialNumber, Product: p.Product}
+		if p.IsUSB {
+			d.VID, d.PID = strings.ToUpper(p.VID), strings.ToUpper(p.PID)
+		}
+		d.Match = config.matches(d)
+		if d.Match {
+			matched = append(matched, d)
+		} else {
+			rest = append(rest, d)
+		}
+	}
+	return append(matched, rest...)
+}
+
+// findArduinoPort (неэкспортируемая) выбирает порт платы по критериям config.
+// Явно заданный Config.Port открывается без перечисления портов.
+func findArduinoPort(config Config) (string, error) {
+	if config.Port != "" {
+		return config.Port, nil
+	}
+	found, err := Discover(config)
+	if err != nil {
+		return "", err
+	}
+	return choosePort(config, found)
+}
+
+// choosePort (неэкспортируемая) выбирает единственное подходящее устройство
+// из найденных Discover. Если подходят несколько, какое из них открыть,
+// решает пользователь через Port или SerialNumber.
+func choosePort(config Config, found []Device) (string, error) {
+	var matched []Device
+	for _, d := range found {
+		if d.Match {
+			matched = append(matched, d)
+		}
+	}
+	switch len(matched) {
+	case 0:
+		return "", &DeviceNotFoundError{Devices: config.devices(), SerialNumber: config.SerialNumber}
+	case 1:
+		log.Printf("Arduino found: %s", matched[0])
+		return matched[0].Port, nil
+	}
+	return "", &AmbiguousDeviceError{Candidates: matched}
+}
+
+// portPresent (неэкспортируемая) проверяет, что порт все еще есть в системе.
+func portPresent(port string) bool {
+	ports, err := enumerator.GetDetailedPortsList()
+	if err != nil {
+		// Не удалось перечислить порты — судить об отключении не по чему.
+		return true
+	}
+	for _, p := range ports {
+		if strings.EqualFold(p.Name, port) {
+			return true
+		}
+	}
+	return false
+}
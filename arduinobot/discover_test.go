@@ -0,0 +1,106 @@
+package arduinobot
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"go.bug.st/serial/enumerator"
+)
+
+// ports — порты системы для TestDiscover: две платы Leonardo, клон с другим
+// PID в нижнем регистре, Micro и порт без USB.
+var ports = []*enumerator.PortDetails{
+	{Name: "/dev/ttyS0"},
+	{Name: "/dev/ttyACM0", IsUSB: true, VID: "2341", PID: "8036", SerialNumber: "AAA111", Product: "Leonardo"},
+	{Name: "/dev/ttyACM1", IsUSB: true, VID: "2341", PID: "8036", SerialNumber: "bbb222", Product: "Leonardo"},
+	{Name: "/dev/ttyACM2", IsUSB: true, VID: "1b4f", PID: "9206", SerialNumber: "CCC333", Product: "Pro Micro"},
+	{Name: "/dev/ttyACM3", IsUSB: true, VID: "2341", PID: "8037", Product: "Micro"},
+}
+
+func TestDiscover(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   []string // подходящие порты по порядку
+	}{
+		{"default devices", Config{}, []string{"/dev/ttyACM0", "/dev/ttyACM1", "/dev/ttyACM2", "/dev/ttyACM3"}},
+		{"explicit port", Config{Port: "/DEV/ttyacm1"}, []string{"/dev/ttyACM1"}},
+		{"explicit port wins over VID/PID", Config{Port: "/dev/ttyS0", Devices: []USBID{{VID: "2341", PID: "8036"}}}, []string{"/dev/ttyS0"}},
+		{"serial number", Config{SerialNumber: "BBB222"}, []string{"/dev/ttyACM1"}},
+		{"serial number and VID/PID", Config{SerialNumber: "ccc333", Devices: []USBID{{VID: "2341", PID: "8036"}}}, nil},
+		{"one pair", Config{Devices: []USBID{{VID: "2341", PID: "8036"}}}, []string{"/dev/ttyACM0", "/dev/ttyACM1"}},
+		{"pairs in any case", Config{Devices: []USBID{{VID: "1B4F", PID: "9206"}, {VID: "2341", PID: "8037"}}}, []string{"/dev/ttyACM2", "/dev/ttyACM3"}},
+		{"lower case pair", Config{Devices: []USBID{{VID: "1b4f", PID: "9206"}}}, []string{"/dev/ttyACM2"}},
+		{"VID only", Config{Devices: []USBID{{VID: "2341"}}}, []string{"/dev/ttyACM0", "/dev/ttyACM1", "/dev/ttyACM3"}},
+		{"legacy VID/PID", Config{VID: "2341", PID: "8037"}, []string{"/dev/ttyACM3"}},
+		{"legacy VID/PID with devices", Config{Devices: []USBID{{VID: "1B4F", PID: "9206"}}, VID: "2341", PID: "8037"}, []string{"/dev/ttyACM2", "/dev/ttyACM3"}},
+		{"nothing matches", Config{Devices: []USBID{{VID: "0000", PID: "0000"}}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found := classify(tt.config, ports)
+			if len(found) != len(ports) {
+				t.Fatalf("%d devices, want %d", len(found), len(ports))
+			}
+			var got []string
+			for i, d := range found {
+				if d.Match {
+					if i != len(got) {
+						t.Errorf("matching %s listed after a port that does not match", d.Port)
+					}
+					got = append(got, d.Port)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("matched %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// VID и PID приводятся к верхнему регистру, у порта без USB их нет.
+	for _, d := range classify(Config{}, ports) {
+		switch d.Port {
+		case "/dev/ttyACM2":
+			if d.VID != "1B4F" || d.PID != "9206" || d.SerialNumber != "CCC333" || d.Product != "Pro Micro" {
+				t.Errorf("device %+v", d)
+			}
+		case "/dev/ttyS0":
+			if d.VID != "" || d.Match {
+				t.Errorf("serial port without USB: %+v", d)
+			}
+		}
+	}
+}
+
+func TestChoosePort(t *testing.T) {
+	port, err := choosePort(Config{}, classify(Config{SerialNumber: "aaa111"}, ports))
+	if err != nil || port != "/dev/ttyACM0" {
+		t.Errorf("one candidate: %q, %v", port, err)
+	}
+
+	config := Config{Devices: []USBID{{VID: "2341", PID: "8036"}}}
+	_, err = choosePort(config, classify(config, ports))
+	var ambiguous *AmbiguousDeviceError
+	if !errors.Is(err, ErrAmbiguousDevice) || !errors.As(err, &ambiguous) {
+		t.Fatalf("several candidates: %v, want ErrAmbiguousDevice", err)
+	}
+	if len(ambiguous.Candidates) != 2 || ambiguous.Candidates[0].Port != "/dev/ttyACM0" || ambiguous.Candidates[1].Port != "/dev/ttyACM1" {
+		t.Errorf("candidates %v", ambiguous.Candidates)
+	}
+
+	config = Config{SerialNumber: "ZZZ", VID: "2341", PID: "8036"}
+	_, err = choosePort(config, classify(config, ports))
+	var notFound *DeviceNotFoundError
+	if !errors.Is(err, ErrDeviceNotFound) || !errors.As(err, &notFound) {
+		t.Fatalf("no candidates: %v, want ErrDeviceNotFound", err)
+	}
+	if notFound.SerialNumber != "ZZZ" || !slices.Equal(notFound.Devices, []USBID{{VID: "2341", PID: "8036"}}) {
+		t.Errorf("not found error %+v", notFound)
+	}
+
+	// Явный порт не требует перечисления.
+	if port, err := findArduinoPort(Config{Port: "COM7"}); err != nil || port != "COM7" {
+		t.Errorf("explicit port: %q, %v", port, err)
+	}
+}
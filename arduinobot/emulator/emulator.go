@@ -0,0 +1,299 @@
+// Package emulator реализует Arduino-прошивку бота в памяти процесса.
+// Эмулятор понимает тот же набор команд, что и плата, в обеих версиях
+// протокола и записывает каждую декодированную команду, чтобы тесты могли
+// проверять точные последовательности клавиш, мыши и колеса.
+package emulator
+
+import (
+	"image"
+	"io"
+	"sync"
+	"time"
+
+	"arduino-go-bot/arduinobot/wire"
+)
+
+// Command — одна декодированная команда.
+type Command = wire.Command
+
+// Config задает поведение эмулятора.
+type Config struct {
+	// Legacy — прошивка знает только протокол v1 и игнорирует запрос v2.
+	Legacy bool
+	// Firmware и BufferSize сообщаются хосту в ответ на OpHello.
+	// По умолчанию "emulator" и 64 байта.
+	Firmware   string
+	BufferSize int
+	// Ops — операции, которые прошивка v2 выполняет; на остальные она
+	// отвечает Nack с wire.NackUnknownOp. По умолчанию — все известные.
+	Ops []wire.Op
+	// ReplyDelay задерживает каждый ответ, Noise дописывается перед каждым
+	// ответом — так проверяется устойчивость хоста к медленной и шумной линии.
+	ReplyDelay time.Duration
+	Noise      []byte
+	// Desktop — виртуальный рабочий стол хоста в пикселях, Cursor — начальное
+	// положение курсора на нем. По умолчанию стол 1920x1080 с началом в 0,0
+	// и курсор в его левом верхнем углу.
+	Desktop image.Rectangle
+	Cursor  image.Point
+	// PointerSpeed имитирует ускорение указателя хоста: сколько пикселей
+	// проходит курсор за HID-отчет со смещением counts по оси. Относительные
+	// сдвиги режутся на отчеты по wire.MaxStep. По умолчанию отсчет равен пикселю.
+	PointerSpeed func(counts int) int
+}
+
+// DefaultOps — операции, которые эмулятор выполняет по умолчанию.
+var DefaultOps = append([]wire.Op{wire.OpHello, wire.OpPing, wire.OpMouseMoveAbs, wire.OpMouseSteps}, wire.LegacyOps...)
+
+// Emulator — эмулятор платы, удовлетворяющий arduinobot.Transport.
+// В режиме v1 каждый вызов Write считается одной командой, как и у прошивки,
+// которая читает команду целиком до паузы на линии. В режиме v2 входящие
+// байты разбираются как поток кадров.
+type Emulator struct {
+	config Config
+	ops    wire.OpSet
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	v2       bool
+	in       []byte
+	out      []byte
+	commands []Command
+	cursor   image.Point
+	closed   bool
+}
+
+// New создает эмулятор с поддержкой обеих версий протокола.
+func New() *Emulator {
+	return NewWithConfig(Config{})
+}
+
+// NewWithConfig создает эмулятор с заданной конфигурацией.
+func NewWithConfig(config Config) *Emulator {
+	if config.Firmware == "" {
+		config.Firmware = "emulator"
+	}
+	if config.BufferSize == 0 {
+		config.BufferSize = 64
+	}
+	if config.Ops == nil {
+		config.Ops = DefaultOps
+	}
+	if config.Desktop.Empty() {
+		config.Desktop = image.Rect(0, 0, 1920, 1080)
+	}
+	if config.Cursor == (image.Point{}) {
+		config.Cursor = config.Desktop.Min
+	}
+	e := &Emulator{config: config, ops: wire.NewOpSet(config.Ops...), cursor: config.Cursor}
+	e.cond = sync.NewCond(&e.mu)
+	return e
+}
+
+// Write принимает байты от хоста. Нераспознанные команды v1
+// не записываются и остаются без ответа, как на реальной плате.
+func (e *Emulator) Write(p []byte) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return 0, io.ErrClosedPipe
+	}
+	if e.v2 {
+		e.in = append(e.in, p...)
+		e.processFrames()
+	} else {
+		e.processASCII(string(p))
+	}
+	e.cond.Broadcast()
+	return len(p), nil
+}
+
+func (e *Emulator) processASCII(s string) {
+	if s == wire.Negotiate {
+		if !e.config.Legacy {
+			e.v2 = true
+			e.emit([]byte(wire.NegotiateReply))
+		}
+		return
+	}
+	cmd, err := wire.DecodeASCII(s)
+	if err != nil {
+		return
+	}
+	e.execute(cmd)
+	e.emit([]byte(wire.ReadyReply))
+}
+
+func (e *Emulator) processFrames() {
+	// Хост, не дождавшийся ответа на согласование, повторяет запрос.
+	if string(e.in) == wire.Negotiate {
+		e.in = e.in[:0]
+		e.emit([]byte(wire.NegotiateReply))
+		return
+	}
+	for len(e.in) > 0 {
+		f, n, err := wire.ParseFrame(e.in)
+		switch err {
+		case nil:
+			e.reply(e.handleFrame(f))
+		case wire.ErrChecksum:
+			e.reply(wire.Nack(f.Seq, wire.NackChecksum))
+		case wire.ErrIncomplete:
+			e.in = e.in[n:]
+			return
+		}
+		e.in = e.in[n:]
+	}
+}
+
+func (e *Emulator) handleFrame(f wire.Frame) wire.Frame {
+	if !e.ops.Has(f.Op) {
+		return wire.Nack(f.Seq, wire.NackUnknownOp)
+	}
+	cmd, err := wire.DecodePayload(f)
+	if err != nil {
+		return wire.Nack(f.Seq, wire.NackBadArgs)
+	}
+	if f.Op == wire.OpHello {
+		payload, err := wire.EncodeHello(wire.Hello{
+			Version:    2,
+			BufferSize: uint16(e.config.BufferSize),
+			Ops:        e.ops,
+			Firmware:   e.config.Firmware,
+		})
+		if err != nil {
+			return wire.Nack(f.Seq, wire.NackBusy)
+		}
+		return wire.Ack(f.Seq, payload)
+	}
+	if f.Op == wire.OpPing {
+		// Эхо не выполняется и в Commands не попадает.
+		return wire.Ack(f.Seq, append([]byte(nil), f.Payload...))
+	}
+	e.execute(cmd)
+	return wire.Ack(f.Seq, nil)
+}
+
+// execute (неэкспортируемая) записывает команду и двигает курсор хоста.
+func (e *Emulator) execute(cmd Command) {
+	e.commands = append(e.commands, cmd)
+	switch cmd.Op {
+	case wire.OpMouseMove:
+		for _, p := range wire.SplitMove(cmd.DX, cmd.DY, wire.MaxStep) {
+			e.moveCursor(p.X, p.Y)
+		}
+	case wire.OpMouseSteps:
+		for _, s := range cmd.Steps {
+			e.moveCursor(int(s.DX), int(s.DY))
+		}
+	case wire.OpMouseMoveAbs:
+		e.cursor = wire.FromAbs(e.config.Desktop, cmd.X, cmd.Y)
+	}
+}
+
+// moveCursor (неэкспортируемая) сдвигает курсор на один HID-отчет,
+// не выпуская его за край стола.
+func (e *Emulator) moveCursor(dx, dy int) {
+	if speed := e.config.PointerSpeed; speed != nil {
+		dx, dy = accelerate(speed, dx), accelerate(speed, dy)
+	}
+	d := e.config.Desktop
+	e.cursor.X = max(d.Min.X, min(e.cursor.X+dx, d.Max.X-1))
+	e.cursor.Y = max(d.Min.Y, min(e.cursor.Y+dy, d.Max.Y-1))
+}
+
+func (e *Emulator) reply(f wire.Frame) {
+	b, _ := wire.AppendFrame(nil, f)
+	e.emit(b)
+}
+
+// emit (неэкспортируемая) отдает ответ хосту с учетом ReplyDelay и Noise.
+// Вызывается под e.mu.
+func (e *Emulator) emit(b []byte) {
+	b = append(append([]byte(nil), e.config.Noise...), b...)
+	if e.config.ReplyDelay <= 0 {
+		e.out = append(e.out, b...)
+		return
+	}
+	time.AfterFunc(e.config.ReplyDelay, func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if !e.closed {
+			e.out = append(e.out, b...)
+			e.cond.Broadcast()
+		}
+	})
+}
+
+// Read отдает хосту накопленные ответы и блокируется, пока их нет.
+func (e *Emulator) Read(p []byte) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for len(e.out) == 0 && !e.closed {
+		e.cond.Wait()
+	}
+	if len(e.out) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, e.out)
+	e.out = e.out[n:]
+	return n, nil
+}
+
+// Close закрывает эмулятор и будит ожидающих читателей.
+func (e *Emulator) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.closed = true
+	e.cond.Broadcast()
+	return nil
+}
+
+// ResetInputBuffer отбрасывает ответы, которые хост еще не прочитал.
+func (e *Emulator) ResetInputBuffer() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.out = e.out[:0]
+	return nil
+}
+
+// Commands возвращает копию всех принятых команд в порядке поступления.
+func (e *Emulator) Commands() []Command {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]Command(nil), e.commands...)
+}
+
+func accelerate(speed func(int) int, counts int) int {
+	if counts < 0 {
+		return -speed(-counts)
+	}
+	return speed(counts)
+}
+
+// Cursor возвращает положение курсора хоста после принятых команд мыши.
+func (e *Emulator) Cursor() image.Point {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.cursor
+}
+
+// CursorPosition — Cursor в виде источника положения курсора
+// для arduinobot.Config.CursorSource и Calibrate.
+func (e *Emulator) CursorPosition() (image.Point, error) {
+	return e.Cursor(), nil
+}
+
+// Reset очищает историю команд.
+func (e *Emulator) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.commands = nil
+}
+
+// V2 сообщает, переключился ли эмулятор на протокол v2.
+func (e *Emulator) V2() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.v2
+}
@@ -0,0 +1,79 @@
+package emulator
+
+import (
+	"image"
+	"io"
+	"testing"
+
+	"arduino-go-bot/arduinobot/wire"
+)
+
+func TestASCIICommands(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Command
+	}{
+		{"0010", Command{Op: wire.OpSetDelayKey, Arg: 10}},
+		{"0120", Command{Op: wire.OpSetDelayMouse, Arg: 20}},
+		{"0230", Command{Op: wire.OpSetDelayMouseMove, Arg: 30}},
+		{"033", Command{Op: wire.OpSetOffsetMouseMove, Arg: 3}},
+		{"045", Command{Op: wire.OpSetRandomDelayKey, Arg: 5}},
+		{"056", Command{Op: wire.OpSetRandomDelayMouse, Arg: 6}},
+		{"197", Command{Op: wire.OpKey, Arg: 'a'}},
+		{"2hello, world", Command{Op: wire.OpText, Text: "hello, world"}},
+		{"3128", Command{Op: wire.OpKeyDown, Arg: 0x80}},
+		{"4128", Command{Op: wire.OpKeyUp, Arg: 0x80}},
+		{"5+-655370", Command{Op: wire.OpMouseMove, DX: 10, DY: -20}}, // 10*65535 + 20
+		{"5-+1966055", Command{Op: wire.OpMouseMove, DX: -30, DY: 5}}, // 30*65535 + 5
+		{"61", Command{Op: wire.OpMouseClick, Arg: 1}},
+		{"72", Command{Op: wire.OpMouseDown, Arg: 2}},
+		{"82", Command{Op: wire.OpMouseUp, Arg: 2}},
+		{"9-3", Command{Op: wire.OpMouseWheel, Arg: -3}},
+	}
+	e := NewWithConfig(Config{Legacy: true, Cursor: image.Pt(100, 100)})
+	ready := make([]byte, len(wire.ReadyReply))
+	for _, tt := range tests {
+		if _, err := e.Write([]byte(tt.in)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadFull(e, ready); err != nil || string(ready) != wire.ReadyReply {
+			t.Fatalf("%q: reply %q, %v", tt.in, ready, err)
+		}
+	}
+
+	// Непонятые команды не выполняются и остаются без ответа.
+	for _, bad := range []string{"x1", "1", "1abc", "5*+1", "5++-1", "06"} {
+		e.Write([]byte(bad))
+	}
+	e.Write([]byte("61"))
+	if _, err := io.ReadFull(e, ready); err != nil || string(ready) != wire.ReadyReply {
+		t.Fatalf("reply after bad commands %q, %v", ready, err)
+	}
+	tests = append(tests, struct {
+		in   string
+		want Command
+	}{"61", Command{Op: wire.OpMouseClick, Arg: 1}})
+
+	got := e.Commands()
+	if len(got) != len(tests) {
+		t.Fatalf("%d commands recorded, want %d: %v", len(got), len(tests), got)
+	}
+	for i, tt := range tests {
+		if got[i].String() != tt.want.String() {
+			t.Errorf("%q recorded as %v, want %v", tt.in, got[i], tt.want)
+		}
+	}
+	if c := e.Cursor(); c != image.Pt(80, 85) {
+		t.Errorf("cursor at %v, want (80,85)", c)
+	}
+
+	// Запрос v2 прошивка v1 молча игнорирует.
+	e.Write([]byte(wire.Negotiate))
+	if e.V2() {
+		t.Error("legacy emulator switched to v2")
+	}
+	e.Reset()
+	if n := len(e.Commands()); n != 0 {
+		t.Errorf("%d commands after Reset", n)
+	}
+}
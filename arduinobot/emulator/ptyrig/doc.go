@@ -0,0 +1,14 @@
+// Package ptyrig подключает эмулятор платы к настоящему последовательному
+// порту — псевдотерминалу Linux. Эмулятор работает на ведущей стороне пары,
+// а arduinobot.NewController открывает ведомую через go.bug.st/serial, так
+// что проверяется весь путь хоста: открытие порта, настройки termios,
+// таймауты чтения и сброс буфера.
+//
+// Rig умеет портить линию: резать ответы на куски, задерживать их,
+// добавлять шумовые байты и обрывать соединение посреди команды. Rig.Port —
+// постоянный путь к порту: после Replug он указывает на новую пару, как
+// порт платы, которую выдернули и вставили обратно.
+//
+// Пара псевдотерминала открывается через /dev/ptmx, поэтому вне Linux
+// пакет пуст.
+package ptyrig
@@ -0,0 +1,329 @@
+//go:build linux
+
+package ptyrig
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"arduino-go-bot/arduinobot/emulator"
+	"golang.org/x/sys/unix"
+)
+
+// commandGap — пауза на линии, которой прошивка v1 отделяет одну команду
+// от следующей: у протокола v1 нет разделителя.
+const commandGap = 10 * time.Millisecond
+
+// Faults — неисправности линии. Нулевое значение — исправная линия.
+type Faults struct {
+	// Chunk > 0 режет байты от платы на куски не длиннее Chunk,
+	// ChunkGap — пауза между кусками.
+	Chunk    int
+	ChunkGap time.Duration
+	// AckDelay задерживает каждый ответ платы.
+	AckDelay time.Duration
+	// Noise дописывается перед ответом платы с вероятностью NoiseRate (0..1).
+	Noise     []byte
+	NoiseRate float64
+	// DisconnectAfter > 0 обрывает соединение, как только от хоста придет
+	// столько байт после SetFaults. Часть команды до обрыва доходит до платы.
+	DisconnectAfter int
+}
+
+// Rig — эмулятор платы за псевдотерминалом.
+type Rig struct {
+	config emulator.Config
+	dir    string
+	port   string
+
+	mu       sync.Mutex
+	faults   Faults
+	fromHost int
+	rnd      *rand.Rand
+	plug     *plug
+	closed   bool
+}
+
+// plug — одно подключение: пара псевдотерминала и эмулятор за ней.
+type plug struct {
+	master *os.File
+	// slave держит ведомую сторону открытой, пока хост ее не открыл или
+	// переоткрывает, иначе чтение ведущей стороны возвращает EIO.
+	slave *os.File
+	emu   *emulator.Emulator
+	done  sync.WaitGroup
+	once  sync.Once
+}
+
+// New создает порт и подключает к нему эмулятор с конфигурацией config.
+func New(config emulator.Config) (*Rig, error) {
+	dir, err := os.MkdirTemp("", "ptyrig")
+	if err != nil {
+		return nil, err
+	}
+	r := &Rig{config: config, dir: dir, port: filepath.Join(dir, "ttyACM0"), rnd: rand.New(rand.NewSource(1))}
+	if err := r.Replug(); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return r, nil
+}
+
+// Port возвращает путь к порту для arduinobot.Config.Port.
+func (r *Rig) Port() string { return r.port }
+
+// Emulator возвращает эмулятор текущего подключения; после Replug — новый.
+func (r *Rig) Emulator() *emulator.Emulator {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.plug == nil {
+		return nil
+	}
+	return r.plug.emu
+}
+
+// SetFaults включает неисправности f вместо прежних и обнуляет счетчик
+// байт для Faults.DisconnectAfter.
+func (r *Rig) SetFaults(f Faults) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.faults = f
+	r.fromHost = 0
+}
+
+func (r *Rig) currentFaults() Faults {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.faults
+}
+
+// Disconnect обрывает соединение, как будто плату выдернули: хост получает
+// ошибку чтения, а путь Port перестает существовать.
+func (r *Rig) Disconnect() {
+	r.mu.Lock()
+	p := r.plug
+	r.mu.Unlock()
+	r.unplug(p)
+}
+
+// unplug отключает p, если он еще подключен.
+func (r *Rig) unplug(p *plug) {
+	if p == nil {
+		return
+	}
+	r.mu.Lock()
+	if r.plug == p {
+		r.plug = nil
+		os.Remove(r.port)
+	}
+	r.mu.Unlock()
+	p.close()
+	p.done.Wait()
+}
+
+// Replug обрывает текущее соединение, если оно есть, и подключает свежий
+// эмулятор к новой паре псевдотерминала по тому же пути Port.
+func (r *Rig) Replug() error {
+	r.Disconnect()
+	master, slave, err := openPTY()
+	if err != nil {
+		return err
+	}
+	p := &plug{master: master, slave: slave, emu: emulator.NewWithConfig(r.config)}
+	if err := os.Symlink(slave.Name(), r.port); err != nil {
+		p.close()
+		return err
+	}
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		os.Remove(r.port)
+		p.close()
+		return errors.New("ptyrig: rig is closed")
+	}
+	r.plug = p
+	r.mu.Unlock()
+	p.done.Add(2)
+	go r.hostToBoard(p)
+	go r.boardToHost(p)
+	return nil
+}
+
+// Close отключает эмулятор и удаляет порт.
+func (r *Rig) Close() error {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+	r.Disconnect()
+	return os.RemoveAll(r.dir)
+}
+
+func (p *plug) close() {
+	p.once.Do(func() {
+		p.emu.Close()
+		p.master.Close()
+		p.slave.Close()
+	})
+}
+
+// hostToBoard передает эмулятору байты хоста. Пока эмулятор в режиме v1,
+// байты копятся до паузы commandGap и уходят одной командой.
+func (r *Rig) hostToBoard(p *plug) {
+	defer p.done.Done()
+	buf := make([]byte, 256)
+	var pending []byte
+	for {
+		if len(pending) > 0 && !p.emu.V2() {
+			p.master.SetReadDeadline(time.Now().Add(commandGap))
+		} else {
+			p.master.SetReadDeadline(time.Time{})
+		}
+		n, err := p.master.Read(buf)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			p.emu.Write(pending)
+			pending = pending[:0]
+			continue
+		}
+		if err != nil {
+			return
+		}
+		in, cut := r.countHostBytes(n)
+		pending = append(pending, buf[:in]...)
+		if p.emu.V2() {
+			p.emu.Write(pending)
+			pending = pending[:0]
+		}
+		if cut {
+			if len(pending) > 0 {
+				p.emu.Write(pending)
+			}
+			go r.unplug(p)
+			return
+		}
+	}
+}
+
+// countHostBytes учитывает n байт от хоста и сообщает, сколько из них
+// передать и пора ли оборвать соединение.
+func (r *Rig) countHostBytes(n int) (int, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	limit := r.faults.DisconnectAfter
+	if limit <= 0 {
+		return n, false
+	}
+	if r.fromHost+n < limit {
+		r.fromHost += n
+		return n, false
+	}
+	n = limit - r.fromHost
+	r.fromHost = limit
+	return n, true
+}
+
+// boardToHost передает хосту ответы эмулятора с учетом неисправностей.
+func (r *Rig) boardToHost(p *plug) {
+	defer p.done.Done()
+	buf := make([]byte, 256)
+	for {
+		n, err := p.emu.Read(buf)
+		if err != nil {
+			return
+		}
+		f := r.currentFaults()
+		if f.AckDelay > 0 {
+			time.Sleep(f.AckDelay)
+		}
+		out := buf[:n]
+		if len(f.Noise) > 0 && r.chance(f.NoiseRate) {
+			out = append(append([]byte(nil), f.Noise...), out...)
+		}
+		for len(out) > 0 {
+			c := len(out)
+			if f.Chunk > 0 && c > f.Chunk {
+				c = f.Chunk
+			}
+			if _, err := p.master.Write(out[:c]); err != nil {
+				return
+			}
+			out = out[c:]
+			if len(out) > 0 && f.ChunkGap > 0 {
+				time.Sleep(f.ChunkGap)
+			}
+		}
+	}
+}
+
+func (r *Rig) chance(p float64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rnd.Float64() < p
+}
+
+// openPTY создает пару псевдотерминала и переводит ведомую сторону в сырой
+// режим, чтобы до открытия порта хостом ничего не возвращалось эхом.
+func openPTY() (master, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ptyrig: %w", err)
+	}
+	fail := func(err error) (*os.File, *os.File, error) {
+		master.Close()
+		return nil, nil, fmt.Errorf("ptyrig: %w", err)
+	}
+	// Fd переводит файл в блокирующий режим и ломает таймауты чтения,
+	// поэтому ioctl идут через Control.
+	var n uint32
+	err = control(master, func(fd int) error {
+		if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+			return fmt.Errorf("unlockpt: %w", err)
+		}
+		var err error
+		if n, err = unix.IoctlGetUint32(fd, unix.TIOCGPTN); err != nil {
+			return fmt.Errorf("ptsname: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fail(err)
+	}
+	slave, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return fail(err)
+	}
+	err = control(slave, func(fd int) error {
+		t, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+		if err != nil {
+			return err
+		}
+		// cfmakeraw
+		t.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+		t.Oflag &^= unix.OPOST
+		t.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+		t.Cflag &^= unix.CSIZE | unix.PARENB
+		t.Cflag |= unix.CS8
+		return unix.IoctlSetTermios(fd, unix.TCSETS, t)
+	})
+	if err != nil {
+		slave.Close()
+		return fail(fmt.Errorf("raw mode: %w", err))
+	}
+	return master, slave, nil
+}
+
+func control(f *os.File, fn func(fd int) error) error {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var ferr error
+	if err := rc.Control(func(fd uintptr) { ferr = fn(int(fd)) }); err != nil {
+		return err
+	}
+	return ferr
+}
@@ -0,0 +1,206 @@
+//go:build linux
+
+package ptyrig_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"arduino-go-bot/arduinobot"
+	"arduino-go-bot/arduinobot/emulator"
+	"arduino-go-bot/arduinobot/emulator/ptyrig"
+)
+
+// newRig (неэкспортируемая) поднимает порт с эмулятором и закрывает его
+// по окончании теста.
+func newRig(t *testing.T, config emulator.Config) *ptyrig.Rig {
+	t.Helper()
+	rig, err := ptyrig.New(config)
+	if err != nil {
+		t.Skipf("no pseudo-terminal: %v", err)
+	}
+	t.Cleanup(func() { rig.Close() })
+	return rig
+}
+
+func portConfig(rig *ptyrig.Rig, proto arduinobot.Protocol) arduinobot.Config {
+	return arduinobot.Config{
+		Port:        rig.Port(),
+		BaudRate:    115200,
+		ReadTimeout: 50 * time.Millisecond,
+		Protocol:    proto,
+	}
+}
+
+// dial (неэкспортируемая) подключает контроллер к порту rig и закрывает
+// его по окончании теста.
+func dial(t *testing.T, config arduinobot.Config) *arduinobot.Controller {
+	t.Helper()
+	c, err := arduinobot.NewController(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	return c
+}
+
+// typeKeys (неэкспортируемая) нажимает n клавиш и проверяет, что эмулятор
+// выполнил их все.
+func typeKeys(t *testing.T, c *arduinobot.Controller, emu *emulator.Emulator, n int) {
+	t.Helper()
+	before := len(emu.Commands())
+	for i := 0; i < n; i++ {
+		if err := c.Key('a'); err != nil {
+			t.Fatalf("key %d: %v", i, err)
+		}
+	}
+	if got := len(emu.Commands()) - before; got != n {
+		t.Errorf("emulator executed %d keys, want %d", got, n)
+	}
+}
+
+// waitState (неэкспортируемая) ждет события супервизора с состоянием want.
+func waitState(t *testing.T, events <-chan arduinobot.Event, want arduinobot.State) {
+	t.Helper()
+	timeout := time.After(3 * time.Second)
+	for {
+		select {
+		case e := <-events:
+			if e.State == want {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("supervisor did not reach state %s", want)
+		}
+	}
+}
+
+var protocols = []struct {
+	name   string
+	config emulator.Config
+	proto  arduinobot.Protocol
+}{
+	{"v1", emulator.Config{Legacy: true}, arduinobot.ProtocolV1},
+	{"v2", emulator.Config{}, arduinobot.ProtocolV2},
+}
+
+func TestFaults(t *testing.T) {
+	tests := []struct {
+		name   string
+		faults ptyrig.Faults
+	}{
+		{"clean", ptyrig.Faults{}},
+		{"chunked", ptyrig.Faults{Chunk: 1, ChunkGap: 2 * time.Millisecond}},
+		{"delay", ptyrig.Faults{AckDelay: 60 * time.Millisecond}},
+		{"noise", ptyrig.Faults{Noise: []byte("\x00#~"), NoiseRate: 1}},
+	}
+	for _, p := range protocols {
+		for _, tt := range tests {
+			t.Run(p.name+"/"+tt.name, func(t *testing.T) {
+				rig := newRig(t, p.config)
+				c := dial(t, portConfig(rig, p.proto))
+				if got := c.Info().Protocol; got != p.proto {
+					t.Fatalf("negotiated %s, want %s", got, p.proto)
+				}
+				rig.SetFaults(tt.faults)
+				start := time.Now()
+				typeKeys(t, c, rig.Emulator(), 5)
+				if min := 5 * tt.faults.AckDelay; time.Since(start) < min {
+					t.Errorf("5 keys took %s, less than the ack delay allows (%s)", time.Since(start), min)
+				}
+				s := c.Stats()
+				if s.Failed != 0 {
+					t.Errorf("%d commands failed", s.Failed)
+				}
+				if want := uint64(5 * len(tt.faults.Noise)); s.Discarded != want {
+					t.Errorf("Discarded = %d, want %d", s.Discarded, want)
+				}
+			})
+		}
+	}
+}
+
+func TestDelayBeyondTimeout(t *testing.T) {
+	for _, p := range protocols {
+		t.Run(p.name, func(t *testing.T) {
+			rig := newRig(t, p.config)
+			config := portConfig(rig, p.proto)
+			config.Timeouts.Key = 100 * time.Millisecond
+			c := dial(t, config)
+			rig.SetFaults(ptyrig.Faults{AckDelay: 250 * time.Millisecond})
+			if err := c.Key('a'); !errors.Is(err, arduinobot.ErrTimeout) {
+				t.Fatalf("Key with a late ack = %v, want ErrTimeout", err)
+			}
+			// Опоздавший ответ не должен подтвердить следующую команду.
+			rig.SetFaults(ptyrig.Faults{})
+			time.Sleep(300 * time.Millisecond)
+			typeKeys(t, c, rig.Emulator(), 2)
+			if s := c.Stats(); s.Timeouts != 1 || s.LateReplies != 1 {
+				t.Errorf("stats: %d timeouts, %d late replies; want 1, 1", s.Timeouts, s.LateReplies)
+			}
+		})
+	}
+}
+
+func TestDropMidCommand(t *testing.T) {
+	for _, p := range protocols {
+		t.Run(p.name, func(t *testing.T) {
+			rig := newRig(t, p.config)
+			c := dial(t, portConfig(rig, p.proto))
+			emu := rig.Emulator()
+			rig.SetFaults(ptyrig.Faults{DisconnectAfter: 3})
+			// У v1 нет разделителя команд: начало обрезанной команды плата может
+			// выполнить и подтвердить до обрыва. Кадр v2 без конца и CRC не
+			// выполняется никогда.
+			err := c.Text("hello")
+			if p.proto == arduinobot.ProtocolV2 || err != nil {
+				if !errors.Is(err, arduinobot.ErrPortClosed) {
+					t.Fatalf("Text through a dropped line = %v, want ErrPortClosed", err)
+				}
+			}
+			if n := len(emu.Commands()); p.proto == arduinobot.ProtocolV2 && n != 0 {
+				t.Errorf("emulator executed %d commands from a cut-off frame", n)
+			}
+			if err := c.Key('a'); !errors.Is(err, arduinobot.ErrPortClosed) {
+				t.Errorf("Key after the drop = %v, want ErrPortClosed", err)
+			}
+		})
+	}
+}
+
+func TestUnplugAndReplug(t *testing.T) {
+	for _, p := range protocols {
+		t.Run(p.name, func(t *testing.T) {
+			rig := newRig(t, p.config)
+			config := portConfig(rig, p.proto)
+			config.ReconnectWait = 3 * time.Second
+			config.PollInterval = 50 * time.Millisecond
+			sup := arduinobot.NewSupervisor(config)
+			t.Cleanup(sup.Close)
+			events, unsubscribe := sup.Subscribe()
+			defer unsubscribe()
+			waitState(t, events, arduinobot.StateConnected)
+			c := sup.Controller()
+			typeKeys(t, c, rig.Emulator(), 1)
+
+			// Команда, которая успела уйти в выдернутый порт до того, как разрыв
+			// заметил супервизор, получает ErrPortClosed; такую не проверяем.
+			rig.Disconnect()
+			waitState(t, events, arduinobot.StateDisconnected)
+			replugged := make(chan error, 1)
+			time.AfterFunc(200*time.Millisecond, func() { replugged <- rig.Replug() })
+			// Команда во время разрыва ждет переподключения.
+			if err := c.Key('b'); err != nil {
+				t.Fatalf("Key across the replug: %v", err)
+			}
+			if err := <-replugged; err != nil {
+				t.Fatal(err)
+			}
+			typeKeys(t, c, rig.Emulator(), 2)
+			if s := c.Stats(); s.Reconnects < 1 {
+				t.Errorf("Reconnects = %d, want at least 1", s.Reconnects)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package arduinobot
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"strings"
+
+	"arduino-go-bot/arduinobot/wire"
+)
+
+// Ошибки контроллера проверяются через errors.Is; подробности — через errors.As
+// на соответствующие типы *XxxError.
+var (
+	// ErrTimeout — прошивка не подтвердила команду за отведенное время.
+	ErrTimeout = errors.New("timeout waiting for Arduino reply")
+	// ErrPortClosed — порт закрыт или устройство пропало, ответа не будет.
+	ErrPortClosed = errors.New("arduino port closed")
+	// ErrBadReply — вместо подтверждения пришли другие данные.
+	ErrBadReply = errors.New("unexpected reply from Arduino")
+	// ErrDeviceNotFound — подходящее устройство не подключено.
+	ErrDeviceNotFound = errors.New("arduino device not found")
+	// ErrAmbiguousDevice — подходят несколько устройств, и выбрать одно нельзя.
+	ErrAmbiguousDevice = errors.New("several arduino devices match")
+	// ErrRejected — прошивка v2 отвергла команду кадром Nack.
+	ErrRejected = errors.New("command rejected by firmware")
+	// ErrUnsupported — прошивка не поддерживает запрошенную операцию.
+	ErrUnsupported = errors.New("operation not supported by firmware")
+	// ErrOffTarget — курсор не удалось привести к цели с заданной точностью.
+	ErrOffTarget = errors.New("cursor missed the target")
+)
+
+// BadReplyError хранит байты, пришедшие вместо подтверждения команды Op.
+type BadReplyError struct {
+	Op  wire.Op
+	Got []byte
+}
+
+func (e *BadReplyError) Error() string {
+	return fmt.Sprintf("unexpected reply to %s: %q", e.Op, e.Got)
+}
+
+func (e *BadReplyError) Is(target error) bool { return target == ErrBadReply }
+
+// DeviceNotFoundError сообщает, какое устройство искали.
+type DeviceNotFoundError struct {
+	Devices      []USBID
+	SerialNumber string
+}
+
+func (e *DeviceNotFoundError) Error() string {
+	ids := make([]string, len(e.Devices))
+	for i, id := range e.Devices {
+		ids[i] = id.String()
+	}
+	msg := fmt.Sprintf("device %s not found", strings.Join(ids, ", "))
+	if e.SerialNumber != "" {
+		msg = fmt.Sprintf("device %s with serial number %s not found", strings.Join(ids, ", "), e.SerialNumber)
+	}
+	return msg
+}
+
+func (e *DeviceNotFoundError) Is(target error) bool { return target == ErrDeviceNotFound }
+
+// AmbiguousDeviceError перечисляет подходящие устройства, из которых
+// нужно выбрать одно через Config.Port или Config.SerialNumber.
+type AmbiguousDeviceError struct {
+	Candidates []Device
+}
+
+func (e *AmbiguousDeviceError) Error() string {
+	names := make([]string, len(e.Candidates))
+	for i, d := range e.Candidates {
+		names[i] = d.String()
+	}
+	return fmt.Sprintf("%d devices match: %s; set Port or SerialNumber to choose one", len(names), strings.Join(names, ", "))
+}
+
+func (e *AmbiguousDeviceError) Is(target error) bool { return target == ErrAmbiguousDevice }
+
+// NackError — отказ прошивки выполнить команду Op.
+type NackError struct {
+	Op   wire.Op
+	Code wire.NackCode
+}
+
+func (e *NackError) Error() string {
+	return fmt.Sprintf("command %s rejected: %s", e.Op, e.Code)
+}
+
+func (e *NackError) Is(target error) bool { return target == ErrRejected }
+
+// UnsupportedError сообщает, какую операцию не поддерживает прошивка.
+type UnsupportedError struct {
+	Op       wire.Op
+	Firmware string
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("%s is not supported by firmware %q", e.Op, e.Firmware)
+}
+
+func (e *UnsupportedError) Is(target error) bool { return target == ErrUnsupported }
+
+// portClosed (неэкспортируемая) оборачивает ошибку ввода-вывода порта в ErrPortClosed.
+func portClosed(cause error) error {
+	if cause == nil || errors.Is(cause, ErrPortClosed) {
+		return ErrPortClosed
+	}
+	return fmt.Errorf("%w: %w", ErrPortClosed, cause)
+}
+
+// OffTargetError — где оказался курсор после всех поправок и куда его вели.
+type OffTargetError struct {
+	Want, Got image.Point
+}
+
+func (e *OffTargetError) Error() string {
+	return fmt.Sprintf("cursor at %v, want %v", e.Got, e.Want)
+}
+
+func (e *OffTargetError) Is(target error) bool { return target == ErrOffTarget }
@@ -0,0 +1,146 @@
+package arduinobot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"arduino-go-bot/arduinobot/emulator"
+	"arduino-go-bot/arduinobot/keys"
+	"arduino-go-bot/arduinobot/wire"
+)
+
+// controllerWith (неэкспортируемая) — контроллер v2 над эмулятором с
+// таймаутом клавиш timeout.
+func controllerWith(t *testing.T, config emulator.Config, timeout time.Duration) (*Controller, *emulator.Emulator) {
+	t.Helper()
+	emu := emulator.NewWithConfig(config)
+	c, err := NewControllerWithTransport(Config{Protocol: ProtocolV2, Timeouts: Timeouts{Key: timeout}}, emu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	return c, emu
+}
+
+func TestErrors(t *testing.T) {
+	const delay, timeout = 200 * time.Millisecond, 150 * time.Millisecond
+	noise := []byte("#$%")
+	key := func(c *Controller, k keys.Key) error { return c.KeyCtx(context.Background(), k) }
+
+	tests := []struct {
+		name   string
+		target error
+		err    func(t *testing.T) error
+		check  func(t *testing.T, err error)
+	}{
+		{
+			name:   "timeout",
+			target: ErrTimeout,
+			err: func(t *testing.T) error {
+				c, _ := controllerWith(t, emulator.Config{ReplyDelay: delay}, timeout)
+				return key(c, 'a')
+			},
+			check: func(t *testing.T, err error) {
+				if !strings.Contains(err.Error(), wire.OpKey.String()) {
+					t.Errorf("%q does not name the command", err)
+				}
+			},
+		},
+		{
+			name:   "port closed",
+			target: ErrPortClosed,
+			err: func(t *testing.T) error {
+				c, emu := controllerWith(t, emulator.Config{}, timeout)
+				emu.Close()
+				return key(c, 'a')
+			},
+		},
+		{
+			name:   "port closed while waiting",
+			target: ErrPortClosed,
+			err: func(t *testing.T) error {
+				c, emu := controllerWith(t, emulator.Config{ReplyDelay: delay}, time.Second)
+				time.AfterFunc(delay/4, func() { emu.Close() })
+				return key(c, 'a')
+			},
+		},
+		{
+			name:   "bad reply",
+			target: ErrBadReply,
+			err: func(t *testing.T) error {
+				// Шум перед запоздавшим ответом на первую команду приходит,
+				// пока ждет вторая.
+				c, _ := controllerWith(t, emulator.Config{ReplyDelay: delay, Noise: noise}, timeout)
+				if err := key(c, 'a'); !errors.Is(err, ErrTimeout) {
+					t.Fatalf("first command: %v, want ErrTimeout", err)
+				}
+				return key(c, 'b')
+			},
+			check: func(t *testing.T, err error) {
+				var bad *BadReplyError
+				if !errors.As(err, &bad) {
+					t.Fatalf("%v is not a *BadReplyError", err)
+				}
+				if bad.Op != wire.OpKey || !bytes.Equal(bad.Got, noise) {
+					t.Errorf("BadReplyError %+v, want Op Key and Got %q", bad, noise)
+				}
+			},
+		},
+		{
+			name:   "unsupported",
+			target: ErrUnsupported,
+			err: func(t *testing.T) error {
+				c, _ := controllerWith(t, emulator.Config{Ops: without(wire.OpKey), Firmware: "old"}, timeout)
+				return key(c, 'a')
+			},
+			check: func(t *testing.T, err error) {
+				var unsupported *UnsupportedError
+				if !errors.As(err, &unsupported) || unsupported.Op != wire.OpKey || unsupported.Firmware != "old" {
+					t.Errorf("%v, want *UnsupportedError for Key on firmware old", err)
+				}
+			},
+		},
+		{
+			name:   "device not found",
+			target: ErrDeviceNotFound,
+			err: func(t *testing.T) error {
+				_, err := NewController(Config{Devices: []USBID{{VID: "FFFF", PID: "0001"}}, VID: "ffff", PID: "0002", SerialNumber: "no-such-board"})
+				if err != nil && strings.HasPrefix(err.Error(), "failed to list serial ports") {
+					t.Skip(err)
+				}
+				return err
+			},
+			check: func(t *testing.T, err error) {
+				var notFound *DeviceNotFoundError
+				if !errors.As(err, &notFound) {
+					t.Fatalf("%v is not a *DeviceNotFoundError", err)
+				}
+				want := []USBID{{VID: "FFFF", PID: "0001"}, {VID: "ffff", PID: "0002"}}
+				if len(notFound.Devices) != 2 || notFound.Devices[0] != want[0] || notFound.Devices[1] != want[1] || notFound.SerialNumber != "no-such-board" {
+					t.Errorf("DeviceNotFoundError %+v, want devices %v and the serial number", notFound, want)
+				}
+			},
+		},
+	}
+	others := []error{ErrTimeout, ErrPortClosed, ErrBadReply, ErrDeviceNotFound, ErrUnsupported, ErrRejected, ErrAmbiguousDevice}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.err(t)
+			if !errors.Is(err, tt.target) {
+				t.Fatalf("error %v, want %v", err, tt.target)
+			}
+			for _, other := range others {
+				if other != tt.target && errors.Is(err, other) {
+					t.Errorf("%v also matches %v", err, other)
+				}
+			}
+			if tt.check != nil {
+				tt.check(t, err)
+			}
+		})
+	}
+}
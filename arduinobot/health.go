@@ -0,0 +1,249 @@
+package arduinobot
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"time"
+
+	"arduino-go-bot/arduinobot/wire"
+)
+
+// selfTestPings — сколько пингов посылает самопроверка.
+const selfTestPings = 10
+
+func (c *Controller) Ping() (time.Duration, error) { return c.PingCtx(context.Background()) }
+func (c *Controller) SelfTest() (SelfTestReport, error) {
+	return c.SelfTestCtx(context.Background())
+}
+
+// PingCtx проверяет, что плата отвечает, не нажимая клавиш и не двигая
+// мышь, и возвращает время от отправки до ответа. Прошивке с wire.OpPing
+// уходит случайный nonce, который должен вернуться в ответе; прошивке без
+// него — уже действующая на плате настройка из отправленных раньше, а если
+// настроек еще не было, отпускание кнопки мыши, которая не удерживается:
+// ни то ни другое ничего на плате не меняет. ErrUnsupported возвращается,
+// только если на v1 удерживаются все кнопки.
+func (c *Controller) PingCtx(ctx context.Context) (time.Duration, error) {
+	l, err := c.current(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return c.ping(ctx, l)
+}
+
+// ping (неэкспортируемая) посылает пинг через соединение l.
+func (c *Controller) ping(ctx context.Context, l *link) (time.Duration, error) {
+	start := time.Now()
+	if !l.info.Supports(wire.OpPing) {
+		cmd, ok := c.noopCommand()
+		if !ok {
+			return 0, &UnsupportedError{Op: wire.OpPing, Firmware: l.info.Firmware}
+		}
+		if err := l.send(ctx, cmd, c.config.Timeouts.forOp(cmd.Op)); err != nil {
+			return 0, err
+		}
+		return time.Since(start), nil
+	}
+	nonce := rand.Uint32()
+	payload, err := l.exchangeV2(ctx, wire.Command{Op: wire.OpPing, Arg: int(int32(nonce))}, commandTimeout)
+	if err != nil {
+		return 0, err
+	}
+	if len(payload) != 4 || binary.LittleEndian.Uint32(payload) != nonce {
+		return 0, &BadReplyError{Op: wire.OpPing, Got: payload}
+	}
+	return time.Since(start), nil
+}
+
+// noopButtons — кнопки, отпусканием которых пингуется прошивка v1:
+// MOUSE_MIDDLE, MOUSE_RIGHT и MOUSE_LEFT из Mouse.h. Mouse.release
+// не шлет отчет, если кнопка и так отпущена.
+var noopButtons = []int{4, 2, 1}
+
+// noopCommand (неэкспортируемая) возвращает команду v1, повтор которой
+// ничего не меняет на плате: одну из отправленных настроек с ее текущим
+// значением или отпускание неудерживаемой кнопки. Кнопку, нажатую
+// одновременно с пингом из другой горутины, пинг может отпустить.
+func (c *Controller) noopCommand() (wire.Command, bool) {
+	c.cmu.Lock()
+	defer c.cmu.Unlock()
+	for _, op := range settingOps() {
+		if arg, ok := c.settings[op]; ok {
+			return wire.Command{Op: op, Arg: arg}, true
+		}
+	}
+	for _, b := range noopButtons {
+		if _, held := c.buttonsDown[b]; !held {
+			return wire.Command{Op: wire.OpMouseUp, Arg: b}, true
+		}
+	}
+	return wire.Command{}, false
+}
+
+// settingOps (неэкспортируемая) возвращает все команды настроек по порядку кодов.
+func settingOps() []wire.Op {
+	var ops []wire.Op
+	for _, op := range wire.LegacyOps {
+		if isSetting(op) {
+			ops = append(ops, op)
+		}
+	}
+	return ops
+}
+
+// SelfTestStep — одна проверка самопроверки. RTT — время от отправки
+// до подтверждения, Err — почему проверка не прошла.
+type SelfTestStep struct {
+	Command wire.Command
+	RTT     time.Duration
+	Err     error
+}
+
+// SelfTestReport — итог SelfTest.
+type SelfTestReport struct {
+	Info    Info
+	Started time.Time
+	Steps   []SelfTestStep
+	// Latency — задержки всех прошедших проверок.
+	Latency Histogram
+	// Failed — сколько проверок не прошло. Пинг, который прошивка
+	// не поддерживает, провалом не считается.
+	Failed int
+	// Skipped — настройки, которые не проверялись: контроллер их еще
+	// не отправлял, и у платы остаются ее собственные значения.
+	Skipped []wire.Op
+}
+
+// OK сообщает, что все проверки прошли.
+func (r SelfTestReport) OK() bool { return r.Failed == 0 && r.Latency.Count > 0 }
+
+func (r SelfTestReport) String() string {
+	var skipped string
+	if len(r.Skipped) > 0 {
+		names := make([]string, len(r.Skipped))
+		for i, op := range r.Skipped {
+			names[i] = op.String()
+		}
+		skipped = fmt.Sprintf("; not checked, never set: %s", strings.Join(names, ", "))
+	}
+	if r.OK() {
+		return fmt.Sprintf("self-test passed: %d checks, firmware %q (%s), latency p50 %s p95 %s max %s%s",
+			len(r.Steps), r.Info.Firmware, r.Info.Protocol,
+			r.Latency.Quantile(0.5).Round(time.Microsecond),
+			r.Latency.Quantile(0.95).Round(time.Microsecond),
+			r.Latency.Max.Round(time.Microsecond), skipped)
+	}
+	var failed []string
+	for _, s := range r.Steps {
+		if s.Err != nil && !errors.Is(s.Err, ErrUnsupported) {
+			failed = append(failed, fmt.Sprintf("%s: %v", s.Command, s.Err))
+		}
+	}
+	return fmt.Sprintf("self-test failed: %d of %d checks: %s%s", r.Failed, len(r.Steps), strings.Join(failed, "; "), skipped)
+}
+
+func (r *SelfTestReport) add(cmd wire.Command, rtt time.Duration, err error) {
+	r.Steps = append(r.Steps, SelfTestStep{Command: cmd, RTT: rtt, Err: err})
+	switch {
+	case err == nil:
+		r.Latency.observe(rtt)
+	case !errors.Is(err, ErrUnsupported):
+		r.Failed++
+	}
+}
+
+// SelfTestCtx проверяет связь с платой, не нажимая клавиш и не двигая мышь:
+// посылает серию пингов, затем уже отправленные команды настроек
+// (SetDelayKey, SetDelayMouse и остальные) с их текущими значениями
+// и собирает отчет с задержкой каждой проверки. Настройки, которые еще
+// не отправлялись, не трогаются: у платы остаются ее собственные, а в отчете
+// они перечислены в Skipped. Ошибка —
+// первая не прошедшая проверка или отмена ctx; отчет возвращается и с ней.
+func (c *Controller) SelfTestCtx(ctx context.Context) (SelfTestReport, error) {
+	r := SelfTestReport{Info: c.Info(), Started: time.Now(), Latency: *newHistogram()}
+	for i := 0; i < selfTestPings; i++ {
+		rtt, err := c.PingCtx(ctx)
+		r.add(wire.Command{Op: wire.OpPing}, rtt, err)
+		if errors.Is(err, ErrUnsupported) {
+			break
+		}
+		if ctx.Err() != nil {
+			return r, ctx.Err()
+		}
+	}
+	for _, op := range settingOps() {
+		c.cmu.Lock()
+		arg, sent := c.settings[op]
+		c.cmu.Unlock()
+		if !sent {
+			r.Skipped = append(r.Skipped, op)
+			continue
+		}
+		cmd := wire.Command{Op: op, Arg: arg}
+		start := time.Now()
+		err := c.send(ctx, cmd)
+		r.add(cmd, time.Since(start), err)
+		if ctx.Err() != nil {
+			return r, ctx.Err()
+		}
+	}
+	if r.Info.Firmware == "" {
+		// Плата подключилась во время проверки.
+		r.Info = c.Info()
+	}
+	for _, s := range r.Steps {
+		if s.Err != nil && !errors.Is(s.Err, ErrUnsupported) {
+			return r, fmt.Errorf("self-test: %s: %w", s.Command, s.Err)
+		}
+	}
+	return r, nil
+}
+
+// startHeartbeat (неэкспортируемая) запускает проверку молчащего
+// соединения, если она включена в Config.Heartbeat.
+func (c *Controller) startHeartbeat() {
+	if c.config.Heartbeat > 0 {
+		go c.heartbeat(c.config.Heartbeat)
+	}
+}
+
+// heartbeat (неэкспортируемая) пингует плату, от которой дольше interval
+// не было ответов. Соединение, на котором пинг остался без ответа или
+// получил посторонние байты, разрывается: команды на нем все равно
+// не дойдут, а супервизор откроет порт заново. Если пинговать нечем,
+// об этом один раз пишется в журнал: соединение тогда не проверяется.
+func (c *Controller) heartbeat(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var unchecked *link
+	for {
+		select {
+		case <-c.quit:
+			return
+		case <-ticker.C:
+		}
+		c.cmu.Lock()
+		l := c.link
+		c.cmu.Unlock()
+		if l == nil || l.failure() != nil || l.idle() < interval {
+			continue
+		}
+		_, err := c.ping(context.Background(), l)
+		if errors.Is(err, ErrUnsupported) && unchecked != l {
+			unchecked = l
+			log.Printf("[Arduino] heartbeat on %s is not checking the link: %v", l.name, err)
+		}
+		if !errors.Is(err, ErrTimeout) && !errors.Is(err, ErrBadReply) {
+			continue
+		}
+		log.Printf("[Arduino] heartbeat on %s failed, dropping connection: %v", l.name, err)
+		c.metrics.add(&c.metrics.stats.HeartbeatFailures, 1)
+		l.fail(fmt.Errorf("heartbeat: %w", err))
+		l.close()
+	}
+}
@@ -0,0 +1,126 @@
+package arduinobot
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"arduino-go-bot/arduinobot/emulator"
+	"arduino-go-bot/arduinobot/wire"
+)
+
+// settingsSent (неэкспортируемая) возвращает команды настроек, которые
+// получил эмулятор.
+func settingsSent(emu *emulator.Emulator) []wire.Command {
+	var cmds []wire.Command
+	for _, cmd := range emu.Commands() {
+		if isSetting(cmd.Op) {
+			cmds = append(cmds, cmd)
+		}
+	}
+	return cmds
+}
+
+func TestPingV1(t *testing.T) {
+	c, emu := newEmulatedController(t, emulator.Config{Legacy: true}, ProtocolV1)
+
+	// Настроек еще не было: пинг отпускает неудерживаемую кнопку.
+	if _, err := c.Ping(); err != nil {
+		t.Fatalf("Ping without settings: %v", err)
+	}
+	if cmds := emu.Commands(); len(cmds) != 1 || cmds[0].Op != wire.OpMouseUp || cmds[0].Arg != 4 {
+		t.Fatalf("Ping sent %v, want a single MouseUp(4)", cmds)
+	}
+
+	// Удерживаемую кнопку пинг не отпускает.
+	if err := c.MouseDown(4); err != nil {
+		t.Fatal(err)
+	}
+	emu.Reset()
+	if _, err := c.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	if cmds := emu.Commands(); len(cmds) != 1 || cmds[0].Op != wire.OpMouseUp || cmds[0].Arg != 2 {
+		t.Fatalf("Ping with button 4 held sent %v, want MouseUp(2)", cmds)
+	}
+	if h := c.Held(); len(h.Buttons) != 1 || h.Buttons[0] != 4 {
+		t.Errorf("Held() after Ping = %v, want button 4", h)
+	}
+
+	// Удерживается все: пинговать нечем.
+	for _, b := range []int{2, 1} {
+		if err := c.MouseDown(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.Ping(); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("Ping with every button held: %v, want ErrUnsupported", err)
+	}
+
+	// Отправленная настройка повторяется с тем же значением.
+	if err := c.SetDelayKey(25); err != nil {
+		t.Fatal(err)
+	}
+	emu.Reset()
+	if _, err := c.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	if cmds := emu.Commands(); len(cmds) != 1 || cmds[0].Op != wire.OpSetDelayKey || cmds[0].Arg != 25 {
+		t.Fatalf("Ping sent %v, want SetDelayKey(25)", cmds)
+	}
+}
+
+func TestSelfTestKeepsDeviceSettings(t *testing.T) {
+	tests := []struct {
+		name   string
+		config emulator.Config
+		proto  Protocol
+	}{
+		{"v1", emulator.Config{Legacy: true}, ProtocolV1},
+		{"v2", emulator.Config{}, ProtocolV2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, emu := newEmulatedController(t, tt.config, tt.proto)
+			r, err := c.SelfTest()
+			if err != nil || !r.OK() {
+				t.Fatalf("SelfTest() = %v, %v", r, err)
+			}
+			if cmds := settingsSent(emu); len(cmds) != 0 {
+				t.Errorf("SelfTest overwrote settings never set: %v", cmds)
+			}
+			// Отчет не выдает одни пинги за полную проверку.
+			if !slices.Equal(r.Skipped, settingOps()) {
+				t.Errorf("Skipped = %v, want every setting %v", r.Skipped, settingOps())
+			}
+			if !strings.Contains(r.String(), "not checked, never set: SetDelayKey, SetDelayMouse") {
+				t.Errorf("report %q does not mention the skipped settings", r)
+			}
+
+			if err := c.SetDelayKey(30); err != nil {
+				t.Fatal(err)
+			}
+			emu.Reset()
+			r, err = c.SelfTest()
+			if err != nil || !r.OK() {
+				t.Fatalf("SelfTest() = %v, %v", r, err)
+			}
+			if slices.Contains(r.Skipped, wire.OpSetDelayKey) || len(r.Skipped) != len(settingOps())-1 {
+				t.Errorf("Skipped = %v after SetDelayKey", r.Skipped)
+			}
+			cmds := settingsSent(emu)
+			if len(cmds) == 0 {
+				t.Fatal("SelfTest did not check the sent setting")
+			}
+			for _, cmd := range cmds {
+				if cmd.Op != wire.OpSetDelayKey || cmd.Arg != 30 {
+					t.Errorf("SelfTest sent %s, want only SetDelayKey(30)", cmd)
+				}
+			}
+			if !c.Held().Empty() {
+				t.Errorf("SelfTest left %v held", c.Held())
+			}
+		})
+	}
+}
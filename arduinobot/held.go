@@ -0,0 +1,103 @@
+package arduinobot
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+
+	"arduino-go-bot/arduinobot/keys"
+	"arduino-go-bot/arduinobot/wire"
+)
+
+// Held — клавиши и кнопки мыши, которые сейчас удерживаются на хосте.
+type Held struct {
+	Keys    []keys.Key
+	Buttons []int
+}
+
+// Empty сообщает, что ничего не удерживается.
+func (h Held) Empty() bool { return len(h.Keys) == 0 && len(h.Buttons) == 0 }
+
+// Held возвращает клавиши и кнопки, нажатые через KeyDown и MouseDown и еще
+// не отпущенные. Нажатие считается удерживаемым с момента отправки команды:
+// при таймауте неизвестно, дошла ли она до платы.
+func (c *Controller) Held() Held {
+	c.cmu.Lock()
+	defer c.cmu.Unlock()
+	var h Held
+	for k := range c.keysDown {
+		h.Keys = append(h.Keys, k)
+	}
+	for b := range c.buttonsDown {
+		h.Buttons = append(h.Buttons, b)
+	}
+	sort.Slice(h.Keys, func(i, j int) bool { return h.Keys[i] < h.Keys[j] })
+	sort.Ints(h.Buttons)
+	return h
+}
+
+// ReleaseAll отпускает все удерживаемые клавиши и кнопки. Вызывается
+// автоматически из Close и при переподключении.
+func (c *Controller) ReleaseAll() error {
+	return c.ReleaseAllCtx(context.Background())
+}
+
+// ReleaseAllCtx — ReleaseAll с ctx. Отпускание продолжается после первой
+// ошибки; возвращаются все ошибки вместе.
+func (c *Controller) ReleaseAllCtx(ctx context.Context) error {
+	h := c.Held()
+	var errs []error
+	for _, k := range h.Keys {
+		errs = append(errs, c.KeyUpCtx(ctx, k))
+	}
+	for _, b := range h.Buttons {
+		errs = append(errs, c.MouseUpCtx(ctx, b))
+	}
+	return errors.Join(errs...)
+}
+
+// track (неэкспортируемая) отмечает нажатие до отправки команды.
+func (c *Controller) track(cmd wire.Command) {
+	c.cmu.Lock()
+	defer c.cmu.Unlock()
+	switch cmd.Op {
+	case wire.OpKeyDown:
+		c.keysDown[keys.Key(cmd.Arg)] = struct{}{}
+	case wire.OpMouseDown:
+		c.buttonsDown[cmd.Arg] = struct{}{}
+	}
+}
+
+// untrack (неэкспортируемая) снимает отметку после подтвержденного отпускания.
+func (c *Controller) untrack(cmd wire.Command) {
+	c.cmu.Lock()
+	defer c.cmu.Unlock()
+	switch cmd.Op {
+	case wire.OpKeyUp:
+		delete(c.keysDown, keys.Key(cmd.Arg))
+	case wire.OpMouseUp:
+		delete(c.buttonsDown, cmd.Arg)
+	}
+}
+
+// releaseOn (неэкспортируемая) отпускает удерживаемое через соединение l,
+// минуя текущее соединение контроллера: при закрытии его уже нет, а при
+// переподключении новое еще не выдано вызывающим.
+func (c *Controller) releaseOn(l *link) {
+	h := c.Held()
+	var cmds []wire.Command
+	for _, k := range h.Keys {
+		cmds = append(cmds, wire.Command{Op: wire.OpKeyUp, Arg: int(k)})
+	}
+	for _, b := range h.Buttons {
+		cmds = append(cmds, wire.Command{Op: wire.OpMouseUp, Arg: b})
+	}
+	for _, cmd := range cmds {
+		if err := l.send(context.Background(), cmd, c.config.Timeouts.forOp(cmd.Op)); err != nil {
+			log.Printf("[Arduino] failed to release %s: %v", cmd, err)
+			continue
+		}
+		c.untrack(cmd)
+	}
+}
@@ -0,0 +1,147 @@
+package arduinobot
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"arduino-go-bot/arduinobot/emulator"
+	"arduino-go-bot/arduinobot/keys"
+	"arduino-go-bot/arduinobot/wire"
+)
+
+// press (неэкспортируемая) нажимает Ctrl, "a" и левую кнопку мыши.
+func press(t *testing.T, c *Controller) {
+	t.Helper()
+	ctx := context.Background()
+	for _, k := range []keys.Key{keys.LeftCtrl, 'a'} {
+		if err := c.KeyDownCtx(ctx, k); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.MouseDownCtx(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// releases — команды, которыми отпускается то, что нажимает press.
+var releases = []string{
+	keyCmd(wire.OpKeyUp, 'a'),
+	keyCmd(wire.OpKeyUp, keys.LeftCtrl),
+	wire.Command{Op: wire.OpMouseUp, Arg: 1}.String(),
+}
+
+// sameCommands (неэкспортируемая) сравнивает журналы команд без учета порядка.
+func sameCommands(got, want []string) bool {
+	got, want = slices.Clone(got), slices.Clone(want)
+	slices.Sort(got)
+	slices.Sort(want)
+	return slices.Equal(got, want)
+}
+
+func TestHeld(t *testing.T) {
+	c, _ := newEmulatedController(t, emulator.Config{}, ProtocolV2)
+	ctx := context.Background()
+	if h := c.Held(); !h.Empty() {
+		t.Fatalf("held before any command: %+v", h)
+	}
+	press(t, c)
+	h := c.Held()
+	if !slices.Equal(h.Keys, []keys.Key{'a', keys.LeftCtrl}) || !slices.Equal(h.Buttons, []int{1}) {
+		t.Errorf("held %+v, want keys a, LeftCtrl and button 1", h)
+	}
+
+	if err := c.KeyUpCtx(ctx, 'a'); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.MouseUpCtx(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	// Key и MouseClick нажимают и отпускают сами и удерживаемыми не считаются.
+	if err := c.KeyCtx(ctx, 'b'); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.MouseClickCtx(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	h = c.Held()
+	if !slices.Equal(h.Keys, []keys.Key{keys.LeftCtrl}) || len(h.Buttons) != 0 {
+		t.Errorf("held %+v, want only LeftCtrl", h)
+	}
+}
+
+func TestHeldAfterTimeout(t *testing.T) {
+	c, _ := newEmulatedController(t, emulator.Config{ReplyDelay: 200 * time.Millisecond}, ProtocolV2)
+	// Неподтвержденное нажатие могло дойти до платы.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.KeyDownCtx(ctx, keys.F1); err == nil {
+		t.Fatal("KeyDown was confirmed before the reply delay")
+	}
+	if h := c.Held(); !slices.Equal(h.Keys, []keys.Key{keys.F1}) {
+		t.Errorf("held %+v after an unconfirmed KeyDown, want F1", h)
+	}
+}
+
+func TestReleaseAll(t *testing.T) {
+	c, emu := newEmulatedController(t, emulator.Config{}, ProtocolV2)
+	press(t, c)
+	emu.Reset()
+	if err := c.ReleaseAll(); err != nil {
+		t.Fatal(err)
+	}
+	if got := commandLog(emu); !sameCommands(got, releases) {
+		t.Errorf("ReleaseAll sent %q, want %q", got, releases)
+	}
+	if h := c.Held(); !h.Empty() {
+		t.Errorf("held after ReleaseAll: %+v", h)
+	}
+	// Отпускать больше нечего.
+	emu.Reset()
+	if err := c.ReleaseAll(); err != nil {
+		t.Fatal(err)
+	}
+	if got := commandLog(emu); len(got) != 0 {
+		t.Errorf("second ReleaseAll sent %q", got)
+	}
+}
+
+func TestReleaseOnClose(t *testing.T) {
+	c, emu := newEmulatedController(t, emulator.Config{}, ProtocolV2)
+	press(t, c)
+	emu.Reset()
+	c.Close()
+	if got := commandLog(emu); !sameCommands(got, releases) {
+		t.Errorf("Close sent %q, want %q", got, releases)
+	}
+	if h := c.Held(); !h.Empty() {
+		t.Errorf("held after Close: %+v", h)
+	}
+}
+
+func TestReleaseOnReconnect(t *testing.T) {
+	d := &scriptedDialer{then: true}
+	s := supervise(t, Config{}, d)
+	events, unsubscribe := s.Subscribe()
+	defer unsubscribe()
+	waitFor(t, events, StateConnected)
+	c := s.Controller()
+	press(t, c)
+	old := d.last()
+
+	if err := c.Reconnect(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, events, StateDisconnected)
+	waitFor(t, events, StateConnected)
+	// Плата, которая не перезагрузилась, отпускает все на новом соединении.
+	if fresh := d.last(); fresh == old {
+		t.Fatal("no new connection")
+	} else if got := commandLog(fresh); !sameCommands(got, releases) {
+		t.Errorf("new connection got %q, want %q", got, releases)
+	}
+	if h := c.Held(); !h.Empty() {
+		t.Errorf("held after reconnect: %+v", h)
+	}
+}
@@ -0,0 +1,123 @@
+package arduinobot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"arduino-go-bot/arduinobot/wire"
+)
+
+// Info — сведения о прошивке, полученные при подключении.
+type Info struct {
+	Firmware   string
+	Protocol   Protocol
+	Version    int
+	Ops        []wire.Op
+	BufferSize int
+
+	ops wire.OpSet
+}
+
+// Supports сообщает, понимает ли прошивка операцию op.
+func (i Info) Supports(op wire.Op) bool { return i.ops.Has(op) }
+
+// legacyInfo — что известно о прошивке v1, которая не умеет рассказывать о себе.
+func legacyInfo() Info {
+	return Info{
+		Firmware:   "legacy",
+		Protocol:   ProtocolV1,
+		Version:    1,
+		Ops:        wire.LegacyOps,
+		BufferSize: legacyBufferSize,
+		ops:        wire.NewOpSet(wire.LegacyOps...),
+	}
+}
+
+const (
+	// legacyBufferSize — размер приемного буфера Serial у Arduino Leonardo.
+	legacyBufferSize = 64
+	// defaultBootWindow — сколько плата может загружаться после открытия порта.
+	defaultBootWindow = 2 * time.Second
+)
+
+// Info возвращает сведения о прошивке текущего соединения, полученные
+// при рукопожатии. Пока платы нет, возвращается пустая Info.
+func (c *Controller) Info() Info {
+	c.cmu.Lock()
+	l := c.link
+	c.cmu.Unlock()
+	if l == nil {
+		return Info{}
+	}
+	info := l.info
+	info.Ops = append([]wire.Op(nil), l.info.Ops...)
+	return info
+}
+
+// handshake (неэкспортируемая) согласует протокол и запрашивает у прошивки
+// имя, версию, набор операций и размер буфера. Пока плата загружается,
+// согласование повторяется до истечения bootWindow; прошивка, не ответившая
+// за это время и еще negotiateTimeout после него, считается прошивкой v1.
+func (l *link) handshake(config Config, bootWindow time.Duration) error {
+	if config.Protocol == ProtocolV1 {
+		time.Sleep(bootWindow)
+		l.proto = ProtocolV1
+	} else {
+		deadline := time.Now().Add(bootWindow)
+		for {
+			ok, err := l.negotiate()
+			if err != nil {
+				return err
+			}
+			if ok {
+				l.proto = ProtocolV2
+				break
+			}
+			if !time.Now().Before(deadline) {
+				// Ответ на последний запрос мог просто опоздать: после него
+				// прошивка принимает только кадры.
+				time.Sleep(negotiateTimeout)
+				if l.framed() {
+					l.proto = ProtocolV2
+					break
+				}
+				if config.Protocol == ProtocolV2 {
+					return fmt.Errorf("firmware does not support protocol v2")
+				}
+				l.proto = ProtocolV1
+				break
+			}
+		}
+	}
+	if l.proto == ProtocolV1 {
+		l.info = legacyInfo()
+		return nil
+	}
+
+	payload, err := l.exchangeV2(context.Background(), wire.Command{Op: wire.OpHello}, commandTimeout)
+	var nack *NackError
+	if errors.As(err, &nack) && nack.Code == wire.NackUnknownOp {
+		// Ранние прошивки v2 не знают OpHello, но понимают все команды v1.
+		l.info = legacyInfo()
+		l.info.Firmware, l.info.Protocol, l.info.Version = "unknown", ProtocolV2, 2
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("firmware handshake failed: %w", err)
+	}
+	hello, err := wire.DecodeHello(payload)
+	if err != nil {
+		return fmt.Errorf("firmware handshake failed: %w", err)
+	}
+	l.info = Info{
+		Firmware:   hello.Firmware,
+		Protocol:   ProtocolV2,
+		Version:    int(hello.Version),
+		Ops:        hello.Ops.Ops(),
+		BufferSize: int(hello.BufferSize),
+		ops:        hello.Ops,
+	}
+	return nil
+}
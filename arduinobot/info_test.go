@@ -0,0 +1,116 @@
+package arduinobot
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"arduino-go-bot/arduinobot/emulator"
+	"arduino-go-bot/arduinobot/wire"
+)
+
+func TestInfo(t *testing.T) {
+	ops := []wire.Op{wire.OpHello, wire.OpPing, wire.OpKey, wire.OpKeyDown, wire.OpKeyUp, wire.OpMouseMoveAbs}
+	tests := []struct {
+		name   string
+		config emulator.Config
+		proto  Protocol
+		want   Info
+	}{
+		{
+			"hello",
+			emulator.Config{Firmware: "bot-fw 3.1", BufferSize: 128, Ops: ops},
+			ProtocolV2,
+			Info{Firmware: "bot-fw 3.1", Protocol: ProtocolV2, Version: 2, Ops: ops, BufferSize: 128},
+		},
+		{
+			"v2 without hello",
+			emulator.Config{Ops: without(wire.OpHello)},
+			ProtocolV2,
+			Info{Firmware: "unknown", Protocol: ProtocolV2, Version: 2, Ops: wire.LegacyOps, BufferSize: legacyBufferSize},
+		},
+		{
+			"legacy",
+			emulator.Config{Legacy: true},
+			ProtocolAuto,
+			Info{Firmware: "legacy", Protocol: ProtocolV1, Version: 1, Ops: wire.LegacyOps, BufferSize: legacyBufferSize},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newEmulatedController(t, tt.config, tt.proto)
+			got := c.Info()
+			want := tt.want
+			slices.Sort(want.Ops)
+			slices.Sort(got.Ops)
+			if got.Firmware != want.Firmware || got.Protocol != want.Protocol || got.Version != want.Version ||
+				got.BufferSize != want.BufferSize || !slices.Equal(got.Ops, want.Ops) {
+				t.Errorf("Info() = %+v, want %+v", got, want)
+			}
+			for _, op := range want.Ops {
+				if !got.Supports(op) {
+					t.Errorf("%s is not supported", op)
+				}
+			}
+			// Info отдает копию: вызывающий не испортит сведения соединения.
+			if len(got.Ops) > 0 {
+				got.Ops[0] = 0xFF
+				if c.Info().Ops[0] == 0xFF {
+					t.Error("Info shares Ops with the connection")
+				}
+			}
+		})
+	}
+
+	var idle Controller
+	if info := idle.Info(); info.Firmware != "" || info.Supports(wire.OpKey) {
+		t.Errorf("Info without a connection: %+v", info)
+	}
+}
+
+func TestUnsupportedOp(t *testing.T) {
+	const delay = 300 * time.Millisecond
+	ctx := context.Background()
+	tests := []struct {
+		name   string
+		config emulator.Config
+		proto  Protocol
+		op     wire.Op
+		call   func(c *Controller) error
+	}{
+		{
+			"v2 without the op", emulator.Config{Ops: without(wire.OpMouseWheel), ReplyDelay: delay}, ProtocolV2,
+			wire.OpMouseWheel, func(c *Controller) error { return c.MouseWheelCtx(ctx, 3) },
+		},
+		{
+			// v1 не знает абсолютного позиционирования.
+			"v1", emulator.Config{Legacy: true, ReplyDelay: delay}, ProtocolV1,
+			wire.OpMouseMoveAbs, func(c *Controller) error { return c.MouseMoveAbsCtx(ctx, 10, 10) },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, emu := newEmulatedController(t, tt.config, tt.proto)
+			emu.Reset()
+			start := time.Now()
+			err := tt.call(c)
+			elapsed := time.Since(start)
+			var unsupported *UnsupportedError
+			if !errors.Is(err, ErrUnsupported) || !errors.As(err, &unsupported) || unsupported.Op != tt.op {
+				t.Fatalf("%s: %v, want UnsupportedError for it", tt.op, err)
+			}
+			if unsupported.Firmware != c.Info().Firmware {
+				t.Errorf("error names firmware %q, want %q", unsupported.Firmware, c.Info().Firmware)
+			}
+			// Ответа прошивки не ждали: команда даже не ушла.
+			if elapsed >= delay/2 {
+				t.Errorf("unsupported %s took %s", tt.op, elapsed)
+			}
+			if cmds := emu.Commands(); len(cmds) != 0 {
+				t.Errorf("firmware received %v", cmds)
+			}
+		})
+	}
+}
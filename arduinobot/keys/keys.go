@@ -0,0 +1,255 @@
+// Package keys содержит коды клавиш Arduino Keyboard.h и разбор их имен.
+// Печатные клавиши кодируются своим ASCII-символом в нижнем регистре,
+// служебные — кодами 0x80 и выше, как в библиотеке Keyboard.
+package keys
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Key — код клавиши, который принимает прошивка.
+type Key int
+
+// Модификаторы.
+const (
+	LeftCtrl   Key = 0x80
+	LeftShift  Key = 0x81
+	LeftAlt    Key = 0x82
+	LeftGUI    Key = 0x83
+	RightCtrl  Key = 0x84
+	RightShift Key = 0x85
+	RightAlt   Key = 0x86
+	RightGUI   Key = 0x87
+)
+
+// Служебные клавиши.
+const (
+	Enter       Key = 0xB0
+	Esc         Key = 0xB1
+	Backspace   Key = 0xB2
+	Tab         Key = 0xB3
+	CapsLock    Key = 0xC1
+	PrintScreen Key = 0xCE
+	ScrollLock  Key = 0xCF
+	Pause       Key = 0xD0
+	Insert      Key = 0xD1
+	Home        Key = 0xD2
+	PageUp      Key = 0xD3
+	Delete      Key = 0xD4
+	End         Key = 0xD5
+	PageDown    Key = 0xD6
+	Right       Key = 0xD7
+	Left        Key = 0xD8
+	Down        Key = 0xD9
+	Up          Key = 0xDA
+	Menu        Key = 0xED
+	Space       Key = ' '
+)
+
+// Функциональные клавиши. F1–F12 и F13–F24 лежат в разных диапазонах.
+const (
+	F1  Key = 0xC2
+	F2  Key = 0xC3
+	F3  Key = 0xC4
+	F4  Key = 0xC5
+	F5  Key = 0xC6
+	F6  Key = 0xC7
+	F7  Key = 0xC8
+	F8  Key = 0xC9
+	F9  Key = 0xCA
+	F10 Key = 0xCB
+	F11 Key = 0xCC
+	F12 Key = 0xCD
+	F13 Key = 0xF0
+	F14 Key = 0xF1
+	F15 Key = 0xF2
+	F16 Key = 0xF3
+	F17 Key = 0xF4
+	F18 Key = 0xF5
+	F19 Key = 0xF6
+	F20 Key = 0xF7
+	F21 Key = 0xF8
+	F22 Key = 0xF9
+	F23 Key = 0xFA
+	F24 Key = 0xFB
+)
+
+// Цифровой блок.
+const (
+	NumLock    Key = 0xDB
+	KPSlash    Key = 0xDC
+	KPAsterisk Key = 0xDD
+	KPMinus    Key = 0xDE
+	KPPlus     Key = 0xDF
+	KPEnter    Key = 0xE0
+	KP1        Key = 0xE1
+	KP2        Key = 0xE2
+	KP3        Key = 0xE3
+	KP4        Key = 0xE4
+	KP5        Key = 0xE5
+	KP6        Key = 0xE6
+	KP7        Key = 0xE7
+	KP8        Key = 0xE8
+	KP9        Key = 0xE9
+	KP0        Key = 0xEA
+	KPDot      Key = 0xEB
+)
+
+// names — канонические имена клавиш, aliases — допустимые синонимы.
+// Имена сравниваются без учета регистра.
+var (
+	names   = map[Key]string{}
+	byName  = map[string]Key{}
+	aliases = map[string]Key{
+		"ctrl": LeftCtrl, "control": LeftCtrl, "shift": LeftShift, "alt": LeftAlt,
+		"gui": LeftGUI, "win": LeftGUI, "cmd": LeftGUI, "super": LeftGUI,
+		"return": Enter, "escape": Esc, "del": Delete, "ins": Insert,
+		"pgup": PageUp, "pgdn": PageDown, "prtsc": PrintScreen,
+		"arrowup": Up, "arrowdown": Down, "arrowleft": Left, "arrowright": Right,
+	}
+)
+
+func init() {
+	add := func(k Key, name string) {
+		names[k] = name
+		byName[strings.ToLower(name)] = k
+	}
+	for _, e := range []struct {
+		k    Key
+		name string
+	}{
+		{LeftCtrl, "LeftCtrl"}, {LeftShift, "LeftShift"}, {LeftAlt, "LeftAlt"}, {LeftGUI, "LeftGUI"},
+		{RightCtrl, "RightCtrl"}, {RightShift, "RightShift"}, {RightAlt, "RightAlt"}, {RightGUI, "RightGUI"},
+		{Enter, "Enter"}, {Esc, "Esc"}, {Backspace, "Backspace"}, {Tab, "Tab"}, {CapsLock, "CapsLock"},
+		{PrintScreen, "PrintScreen"}, {ScrollLock, "ScrollLock"}, {Pause, "Pause"},
+		{Insert, "Insert"}, {Home, "Home"}, {PageUp, "PageUp"}, {Delete, "Delete"}, {End, "End"},
+		{PageDown, "PageDown"}, {Right, "Right"}, {Left, "Left"}, {Down, "Down"}, {Up, "Up"},
+		{Menu, "Menu"}, {Space, "Space"},
+		{NumLock, "NumLock"}, {KPSlash, "KPSlash"}, {KPAsterisk, "KPAsterisk"}, {KPMinus, "KPMinus"},
+		{KPPlus, "KPPlus"}, {KPEnter, "KPEnter"}, {KPDot, "KPDot"},
+	} {
+		add(e.k, e.name)
+	}
+	for i := 0; i < 12; i++ {
+		add(F1+Key(i), fmt.Sprintf("F%d", i+1))
+		add(F13+Key(i), fmt.Sprintf("F%d", i+13))
+	}
+	for i := 1; i <= 9; i++ {
+		add(KP1+Key(i-1), fmt.Sprintf("KP%d", i))
+	}
+	add(KP0, "KP0")
+	for c := 'a'; c <= 'z'; c++ {
+		add(Key(c), string(c))
+	}
+	for c := '0'; c <= '9'; c++ {
+		add(Key(c), string(c))
+	}
+}
+
+// String возвращает каноническое имя клавиши, для печатного символа без
+// имени — сам символ.
+func (k Key) String() string {
+	if name, ok := names[k]; ok {
+		return name
+	}
+	if k > ' ' && k < 0x7F {
+		return string(rune(k))
+	}
+	return fmt.Sprintf("Key(0x%02X)", int(k))
+}
+
+// IsModifier сообщает, является ли k модификатором (Ctrl, Shift, Alt, GUI).
+func (k Key) IsModifier() bool { return k >= LeftCtrl && k <= RightGUI }
+
+// Parse возвращает клавишу по имени: "F5", "enter", "kp7", "a", "ctrl".
+// Одиночный печатный символ ("/", "=") означает сам себя; буквы
+// приводятся к нижнему регистру, как их ждет Keyboard.press.
+func Parse(name string) (Key, error) {
+	s := strings.TrimSpace(name)
+	if len(s) == 1 && s[0] > ' ' && s[0] < 0x7F {
+		return Key(strings.ToLower(s)[0]), nil
+	}
+	l := strings.ToLower(s)
+	if k, ok := byName[l]; ok {
+		return k, nil
+	}
+	if k, ok := aliases[l]; ok {
+		return k, nil
+	}
+	return 0, fmt.Errorf("unknown key %q", name)
+}
+
+// Names возвращает канонические имена всех клавиш по алфавиту.
+func Names() []string {
+	out := make([]string, 0, len(names))
+	for _, name := range names {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Chord — сочетание клавиш: модификаторы нажимаются по порядку, затем
+// Key, отпускаются в обратном порядке. Key равен нулю у сочетания из одних
+// модификаторов.
+type Chord struct {
+	Modifiers []Key
+	Key       Key
+}
+
+// ParseChord разбирает сочетание вида "ctrl+shift+F5". Последняя клавиша,
+// если это не модификатор, становится Key; "+" как клавиша пишется в конце:
+// "shift++".
+func ParseChord(s string) (Chord, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Chord{}, fmt.Errorf("empty key chord")
+	}
+	var parts []string
+	if strings.HasSuffix(s, "++") || s == "+" {
+		parts = append(strings.Split(strings.TrimSuffix(strings.TrimSuffix(s, "+"), "+"), "+"), "+")
+		if parts[0] == "" {
+			parts = parts[1:]
+		}
+	} else {
+		parts = strings.Split(s, "+")
+	}
+	var c Chord
+	for i, part := range parts {
+		k, err := Parse(part)
+		if err != nil {
+			return Chord{}, fmt.Errorf("key chord %q: %w", s, err)
+		}
+		switch {
+		case k.IsModifier():
+			c.Modifiers = append(c.Modifiers, k)
+		case i == len(parts)-1:
+			c.Key = k
+		default:
+			return Chord{}, fmt.Errorf("key chord %q: %s is not a modifier", s, k)
+		}
+	}
+	return c, nil
+}
+
+// MustParseChord — как ParseChord, но паникует при ошибке. Для констант в коде.
+func MustParseChord(s string) Chord {
+	c, err := ParseChord(s)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func (c Chord) String() string {
+	parts := make([]string, 0, len(c.Modifiers)+1)
+	for _, m := range c.Modifiers {
+		parts = append(parts, m.String())
+	}
+	if c.Key != 0 {
+		parts = append(parts, c.Key.String())
+	}
+	return strings.Join(parts, "+")
+}
@@ -0,0 +1,103 @@
+package keys
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseChord(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Chord
+	}{
+		{"ctrl+shift+F5", Chord{Modifiers: []Key{LeftCtrl, LeftShift}, Key: F5}},
+		{"shift++", Chord{Modifiers: []Key{LeftShift}, Key: '+'}},
+		{"+", Chord{Key: '+'}},
+		{"ctrl+alt", Chord{Modifiers: []Key{LeftCtrl, LeftAlt}}},
+		{" Control + Escape ", Chord{Modifiers: []Key{LeftCtrl}, Key: Esc}},
+		{"WIN+Return", Chord{Modifiers: []Key{LeftGUI}, Key: Enter}},
+		{"cmd+pgdn", Chord{Modifiers: []Key{LeftGUI}, Key: PageDown}},
+		{"RightAlt+arrowLeft", Chord{Modifiers: []Key{RightAlt}, Key: Left}},
+		{"ctrl+S", Chord{Modifiers: []Key{LeftCtrl}, Key: 's'}},
+		{"shift+/", Chord{Modifiers: []Key{LeftShift}, Key: '/'}},
+		{"f13", Chord{Key: F13}},
+		{"F24", Chord{Key: F24}},
+		{"kp0", Chord{Key: KP0}},
+		{"alt+KP7", Chord{Modifiers: []Key{LeftAlt}, Key: KP7}},
+		{"space", Chord{Key: ' '}},
+	}
+	for _, tt := range tests {
+		got, err := ParseChord(tt.in)
+		if err != nil {
+			t.Errorf("ParseChord(%q): %v", tt.in, err)
+			continue
+		}
+		if !slices.Equal(got.Modifiers, tt.want.Modifiers) || got.Key != tt.want.Key {
+			t.Errorf("ParseChord(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "  ", "a+b", "ctrl+", "+ctrl", "ctrl++shift", "F25", "kp10", "hyper+a", "ctrl+F5+a"} {
+		if c, err := ParseChord(in); err == nil {
+			t.Errorf("ParseChord(%q) = %v, want an error", in, c)
+		}
+	}
+}
+
+func TestChordString(t *testing.T) {
+	for in, want := range map[string]string{
+		"ctrl+shift+f5": "LeftCtrl+LeftShift+F5",
+		"shift++":       "LeftShift++",
+		"alt+Q":         "LeftAlt+q",
+		"gui":           "LeftGUI",
+	} {
+		if got := MustParseChord(in).String(); got != want {
+			t.Errorf("%q: String() = %q, want %q", in, got, want)
+		}
+		// Каноническое имя разбирается обратно в то же сочетание.
+		if got := MustParseChord(MustParseChord(in).String()).String(); got != want {
+			t.Errorf("%q does not round-trip: %q", want, got)
+		}
+	}
+}
+
+// TestKeyboardH сверяет коды с Keyboard.h и KeyboardLayout.h библиотеки Arduino Keyboard.
+func TestKeyboardH(t *testing.T) {
+	tests := map[string]int{
+		"LeftCtrl": 0x80, "LeftShift": 0x81, "LeftAlt": 0x82, "LeftGUI": 0x83,
+		"RightCtrl": 0x84, "RightShift": 0x85, "RightAlt": 0x86, "RightGUI": 0x87,
+		"Up": 0xDA, "Down": 0xD9, "Left": 0xD8, "Right": 0xD7,
+		"Backspace": 0xB2, "Tab": 0xB3, "Enter": 0xB0, "Esc": 0xB1, "Menu": 0xED,
+		"Insert": 0xD1, "Delete": 0xD4, "PageUp": 0xD3, "PageDown": 0xD6, "Home": 0xD2, "End": 0xD5,
+		"CapsLock": 0xC1, "PrintScreen": 0xCE, "ScrollLock": 0xCF, "Pause": 0xD0,
+		"F1": 0xC2, "F12": 0xCD, "F13": 0xF0, "F18": 0xF5, "F24": 0xFB,
+		"NumLock": 0xDB, "KPSlash": 0xDC, "KPAsterisk": 0xDD, "KPMinus": 0xDE, "KPPlus": 0xDF,
+		"KPEnter": 0xE0, "KP1": 0xE1, "KP5": 0xE5, "KP9": 0xE9, "KP0": 0xEA, "KPDot": 0xEB,
+	}
+	for name, code := range tests {
+		k, err := Parse(name)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", name, err)
+			continue
+		}
+		if int(k) != code {
+			t.Errorf("%s = 0x%02X, Keyboard.h has 0x%02X", name, int(k), code)
+		}
+		if k.String() != name {
+			t.Errorf("Key(0x%02X).String() = %q, want %q", code, k, name)
+		}
+	}
+}
+
+func TestNames(t *testing.T) {
+	names := Names()
+	if !slices.IsSorted(names) {
+		t.Error("Names() is not sorted")
+	}
+	for _, name := range names {
+		k, err := Parse(name)
+		if err != nil || k.String() != name {
+			t.Errorf("Parse(%q) = %v, %v", name, k, err)
+		}
+	}
+}
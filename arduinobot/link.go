@@ -0,0 +1,366 @@
+package arduinobot
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"arduino-go-bot/arduinobot/trace"
+	"arduino-go-bot/arduinobot/wire"
+)
+
+// closeTimeout — сколько ждать остановки читателя после закрытия порта.
+const closeTimeout = time.Second
+
+// maxGarbage — сколько отброшенных байт хранить для BadReplyError.
+const maxGarbage = 64
+
+// reply — ответ прошивки, доставленный читателем ожидающему вызову.
+type reply struct {
+	token string     // v1: wire.ReadyReply или wire.NegotiateReply
+	frame wire.Frame // v2: Ack или Nack
+	err   error
+}
+
+// tokenWaiter — вызов, ожидающий ответа v1. Брошенный вызов (отмененный
+// после отправки или не дождавшийся ответа) остается в очереди до until,
+// чтобы поглотить запоздавший ответ на свою команду и не отдать его следующей.
+type tokenWaiter struct {
+	ch    chan reply
+	until time.Time
+}
+
+func (w *tokenWaiter) abandoned() bool { return !w.until.IsZero() }
+
+// v1Tokens — ответы, которые прошивка шлет в режиме v1.
+var v1Tokens = []string{wire.ReadyReply, wire.NegotiateReply}
+
+// link — одно открытое соединение с платой. Единственная горутина-читатель
+// разбирает входящий поток и раздает ответы ожидающим вызовам: в v1 — по
+// очереди, в v2 — по номеру последовательности. Когда чтение прекращается,
+// все ожидающие вызовы получают ошибку.
+type link struct {
+	port    Transport
+	name    string   // имя порта, для журнала и событий супервизора
+	metrics *metrics // счетчики контроллера, которому принадлежит соединение
+
+	// Заполняются рукопожатием и дальше не меняются.
+	proto Protocol
+	info  Info
+
+	wmu    sync.Mutex    // сериализует записи в порт
+	v1slot chan struct{} // одна команда v1 в полете
+
+	mu      sync.Mutex
+	v2      bool
+	buf     []byte
+	queue   []*tokenWaiter       // ожидающие ответа v1, по порядку отправки
+	bySeq   map[uint8]chan reply // ожидающие ответа v2
+	seq     uint8
+	err     error
+	closed  bool
+	garbage []byte    // байты, отброшенные с последнего доставленного ответа
+	active  time.Time // когда пришел последний ответ или открылось соединение
+	done    chan struct{}
+}
+
+func newLink(port Transport, name string, m *metrics) *link {
+	l := &link{
+		port:    port,
+		name:    name,
+		metrics: m,
+		v1slot:  make(chan struct{}, 1),
+		bySeq:   make(map[uint8]chan reply),
+		active:  time.Now(),
+		done:    make(chan struct{}),
+	}
+	go l.readLoop()
+	return l
+}
+
+// connect (неэкспортируемая) поднимает соединение поверх открытого транспорта
+// и выполняет рукопожатие. Команды соединения учитываются в m. При ошибке
+// транспорт закрывается.
+func connect(config Config, transport Transport, name string, bootWindow time.Duration, m *metrics) (*link, error) {
+	if config.Trace != nil {
+		config.Trace.Record(trace.KindOpen, []byte(name))
+		transport = &tracedTransport{Transport: transport, rec: config.Trace}
+	}
+	// Остатки вывода прошлой сессии не должны попасть к читателю.
+	if err := transport.ResetInputBuffer(); err != nil {
+		transport.Close()
+		return nil, fmt.Errorf("failed to clear input buffer: %w", err)
+	}
+	l := newLink(transport, name, m)
+	if err := l.handshake(config, bootWindow); err != nil {
+		l.close()
+		return nil, err
+	}
+	log.Printf("Arduino firmware %q on %s, protocol %s (version %d), buffer %d bytes",
+		l.info.Firmware, name, l.info.Protocol, l.info.Version, l.info.BufferSize)
+	return l, nil
+}
+
+// failure возвращает причину остановки читателя или nil, пока соединение живо.
+func (l *link) failure() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// framed (неэкспортируемая) сообщает, что читатель разбирает кадры v2.
+func (l *link) framed() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.v2
+}
+
+// readLoop (неэкспортируемая) — единственный читатель порта.
+// Чтение с таймаутом порта возвращает 0 байт без ошибки; это не конец потока.
+func (l *link) readLoop() {
+	defer close(l.done)
+	chunk := make([]byte, 256)
+	for {
+		n, err := l.port.Read(chunk)
+		if n > 0 {
+			l.feed(chunk[:n])
+		}
+		if err != nil {
+			l.fail(err)
+			return
+		}
+		if n == 0 && l.isClosed() {
+			l.fail(ErrPortClosed)
+			return
+		}
+	}
+}
+
+func (l *link) feed(p []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buf = append(l.buf, p...)
+	if l.v2 {
+		l.feedFrames()
+	} else {
+		l.feedTokens()
+	}
+}
+
+// feedTokens (неэкспортируемая) ищет в буфере ответы v1. Байты перед ответом
+// и ответы, которых никто не ждет, отбрасываются.
+func (l *link) feedTokens() {
+	for {
+		at, token := -1, ""
+		for _, t := range v1Tokens {
+			if i := bytes.Index(l.buf, []byte(t)); i >= 0 && (at < 0 || i < at) {
+				at, token = i, t
+			}
+		}
+		if at < 0 {
+			// Хвост может оказаться началом ответа, который дочитается позже.
+			if keep := len(wire.ReadyReply) - 1; len(l.buf) > keep {
+				l.discard(len(l.buf) - keep)
+			}
+			return
+		}
+		l.discard(at)
+		l.buf = l.buf[len(token):]
+		now := time.Now()
+		for len(l.queue) > 0 && l.queue[0].abandoned() && now.After(l.queue[0].until) {
+			l.queue = l.queue[1:]
+		}
+		if token == wire.NegotiateReply {
+			// Прошивка уже переключилась, даже если согласование не дождалось
+			// ответа: следующие байты — кадры.
+			l.v2, l.active = true, now
+			if len(l.queue) > 0 && !l.queue[0].abandoned() {
+				l.queue[0].ch <- reply{token: token}
+				l.queue = l.queue[1:]
+			} else {
+				log.Printf("[Arduino] late %q, reading frames from now on", token)
+				l.metrics.add(&l.metrics.stats.LateReplies, 1)
+			}
+			l.feedFrames()
+			return
+		}
+		if len(l.queue) == 0 {
+			log.Printf("[Arduino] unexpected reply %q ignored", token)
+			l.metrics.add(&l.metrics.stats.LateReplies, 1)
+			continue
+		}
+		w := l.queue[0]
+		l.queue = l.queue[1:]
+		if w.abandoned() {
+			log.Printf("[Arduino] late reply %q to a cancelled command absorbed", token)
+			l.metrics.add(&l.metrics.stats.LateReplies, 1)
+			continue
+		}
+		w.ch <- reply{token: token}
+		l.garbage, l.active = nil, now
+	}
+}
+
+// feedFrames (неэкспортируемая) разбирает кадры v2 и доставляет их по seq.
+func (l *link) feedFrames() {
+	for len(l.buf) > 0 {
+		f, n, err := wire.ParseFrame(l.buf)
+		if err == wire.ErrIncomplete {
+			l.discard(n)
+			return
+		}
+		if err != nil {
+			log.Printf("[Arduino] corrupted frame skipped: %v", err)
+			l.metrics.add(&l.metrics.stats.Discarded, uint64(n))
+			l.buf = l.buf[n:]
+			continue
+		}
+		f.Payload = append([]byte(nil), f.Payload...)
+		// Шум перед кадром ParseFrame пропускает молча; он такой же мусор,
+		// как и шум без кадра следом.
+		skipped := n - wire.Overhead - len(f.Payload)
+		l.discard(skipped)
+		l.buf = l.buf[n-skipped:]
+		ch, ok := l.bySeq[f.Seq]
+		if !ok || (f.Op != wire.OpAck && f.Op != wire.OpNack) {
+			log.Printf("[Arduino] unexpected %s #%d ignored", f.Op, f.Seq)
+			l.metrics.add(&l.metrics.stats.LateReplies, 1)
+			continue
+		}
+		delete(l.bySeq, f.Seq)
+		ch <- reply{frame: f}
+		l.garbage, l.active = nil, time.Now()
+	}
+}
+
+func (l *link) discard(n int) {
+	if n > 0 {
+		log.Printf("[Arduino] %d unexpected bytes discarded: %q", n, l.buf[:n])
+		l.metrics.add(&l.metrics.stats.Discarded, uint64(n))
+		if room := maxGarbage - len(l.garbage); room > 0 {
+			l.garbage = append(l.garbage, l.buf[:min(n, room)]...)
+		}
+		l.buf = l.buf[n:]
+	}
+}
+
+// idle (неэкспортируемая) возвращает время с последнего ответа платы.
+func (l *link) idle() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return time.Since(l.active)
+}
+
+// takeGarbage (неэкспортируемая) возвращает и забывает отброшенные байты.
+func (l *link) takeGarbage() []byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	g := l.garbage
+	l.garbage = nil
+	return g
+}
+
+// expectToken (неэкспортируемая) ставит вызов в очередь ожидающих ответа v1.
+// cancel убирает его из очереди, если ответ не пришел.
+func (l *link) expectToken() (ch chan reply, cancel func(), err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return nil, nil, l.err
+	}
+	ch = make(chan reply, 1)
+	l.queue = append(l.queue, &tokenWaiter{ch: ch})
+	return ch, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for i, w := range l.queue {
+			if w.ch == ch {
+				l.queue = append(l.queue[:i], l.queue[i+1:]...)
+				return
+			}
+		}
+	}, nil
+}
+
+// abandon (неэкспортируемая) оставляет брошенный вызов v1 в очереди до until:
+// прошивка, скорее всего, еще ответит на уже отправленную команду.
+func (l *link) abandon(ch chan reply, until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, w := range l.queue {
+		if w.ch == ch {
+			w.until = until
+			return
+		}
+	}
+}
+
+// expectSeq (неэкспортируемая) регистрирует ожидание ответа v2 с номером seq.
+func (l *link) expectSeq(seq uint8) (ch chan reply, cancel func(), err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return nil, nil, l.err
+	}
+	ch = make(chan reply, 1)
+	l.bySeq[seq] = ch
+	return ch, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.bySeq[seq] == ch {
+			delete(l.bySeq, seq)
+		}
+	}, nil
+}
+
+func (l *link) write(p []byte) error {
+	l.wmu.Lock()
+	defer l.wmu.Unlock()
+	if _, err := l.port.Write(p); err != nil {
+		return portClosed(err)
+	}
+	return nil
+}
+
+// fail (неэкспортируемая) завершает все ожидающие вызовы ошибкой err.
+func (l *link) fail(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		err = ErrPortClosed
+	}
+	if l.err == nil {
+		l.err = portClosed(err)
+	}
+	for _, w := range l.queue {
+		w.ch <- reply{err: l.err}
+	}
+	l.queue = nil
+	for seq, ch := range l.bySeq {
+		ch <- reply{err: l.err}
+		delete(l.bySeq, seq)
+	}
+}
+
+func (l *link) isClosed() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.closed
+}
+
+// close закрывает порт и дожидается остановки читателя.
+func (l *link) close() error {
+	l.mu.Lock()
+	l.closed = true
+	l.mu.Unlock()
+	err := l.port.Close()
+	select {
+	case <-l.done:
+	case <-time.After(closeTimeout):
+		// Транспорт не прервал чтение при закрытии; не держим вызывающих.
+		l.fail(ErrPortClosed)
+	}
+	return err
+}
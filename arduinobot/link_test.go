@@ -0,0 +1,200 @@
+package arduinobot
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"arduino-go-bot/arduinobot/emulator"
+	"arduino-go-bot/arduinobot/wire"
+)
+
+// dialEmulator (неэкспортируемая) поднимает соединение с эмулятором
+// в протоколе proto и закрывает его по окончании теста.
+func dialEmulator(t *testing.T, config emulator.Config, proto Protocol) (*link, *emulator.Emulator) {
+	t.Helper()
+	emu := emulator.NewWithConfig(config)
+	l, err := connect(Config{Protocol: proto}, emu, "emulator", 0, newMetrics())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.close() })
+	if l.proto != proto {
+		t.Fatalf("negotiated %s, want %s", l.proto, proto)
+	}
+	return l, emu
+}
+
+func TestLateReadyAbsorbedByAbandonedWaiter(t *testing.T) {
+	const delay = 300 * time.Millisecond
+	l, emu := dialEmulator(t, emulator.Config{Legacy: true, ReplyDelay: delay}, ProtocolV1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), delay/2)
+	defer cancel()
+	if err := l.send(ctx, wire.Command{Op: wire.OpKey, Arg: 'a'}, time.Second); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("cancelled send = %v, want context.DeadlineExceeded", err)
+	}
+
+	// "ready" первой команды приходит через delay/2 после отправки второй;
+	// вторая должна дождаться своего.
+	start := time.Now()
+	if err := l.send(context.Background(), wire.Command{Op: wire.OpKey, Arg: 'b'}, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < delay*4/5 {
+		t.Errorf("second send returned after %s, before its own reply (%s)", elapsed, delay)
+	}
+	if got := len(emu.Commands()); got != 2 {
+		t.Errorf("emulator executed %d commands, want 2", got)
+	}
+	if s := l.metrics.snapshot(); s.LateReplies != 1 {
+		t.Errorf("LateReplies = %d, want 1", s.LateReplies)
+	}
+}
+
+func TestNoiseBeforeReply(t *testing.T) {
+	for _, proto := range []Protocol{ProtocolV1, ProtocolV2} {
+		t.Run(proto.String(), func(t *testing.T) {
+			noise := []byte("\x00garbage\xff")
+			l, emu := dialEmulator(t, emulator.Config{Legacy: proto == ProtocolV1, Noise: noise}, proto)
+			before := l.metrics.snapshot().Discarded
+			for i := 0; i < 5; i++ {
+				if err := l.send(context.Background(), wire.Command{Op: wire.OpKey, Arg: 'a' + i}, time.Second); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := len(emu.Commands()); got != 5 {
+				t.Errorf("emulator executed %d commands, want 5", got)
+			}
+			if got := l.metrics.snapshot().Discarded - before; got != uint64(5*len(noise)) {
+				t.Errorf("Discarded = %d, want %d", got, 5*len(noise))
+			}
+		})
+	}
+}
+
+func TestBadReplyOnGarbage(t *testing.T) {
+	for _, proto := range []Protocol{ProtocolV1, ProtocolV2} {
+		t.Run(proto.String(), func(t *testing.T) {
+			// Ответ приходит после таймаута команды, а шум перед ним — во время
+			// ожидания следующей, которая так и не получает подтверждения.
+			const delay, timeout = 200 * time.Millisecond, 150 * time.Millisecond
+			noise := []byte("#$%")
+			l, _ := dialEmulator(t, emulator.Config{Legacy: proto == ProtocolV1, ReplyDelay: delay, Noise: noise}, proto)
+
+			err := l.send(context.Background(), wire.Command{Op: wire.OpKey, Arg: 'a'}, timeout)
+			if !errors.Is(err, ErrTimeout) {
+				t.Fatalf("first send = %v, want ErrTimeout", err)
+			}
+			err = l.send(context.Background(), wire.Command{Op: wire.OpKey, Arg: 'b'}, timeout)
+			var bad *BadReplyError
+			if !errors.As(err, &bad) {
+				t.Fatalf("second send = %v, want BadReplyError", err)
+			}
+			if bad.Op != wire.OpKey || !bytes.Equal(bad.Got, noise) {
+				t.Errorf("BadReplyError = %+v, want Op Key, Got %q", bad, noise)
+			}
+			s := l.metrics.snapshot()
+			if s.Timeouts != 1 || s.BadReplies != 1 || s.LateReplies < 1 {
+				t.Errorf("stats: %d timeouts, %d bad replies, %d late replies; want 1, 1, ≥1", s.Timeouts, s.BadReplies, s.LateReplies)
+			}
+		})
+	}
+}
+
+func TestV2ConcurrentCallers(t *testing.T) {
+	l, emu := dialEmulator(t, emulator.Config{ReplyDelay: 20 * time.Millisecond, Noise: []byte("zz")}, ProtocolV2)
+
+	const callers = 32
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Каждый пинг должен получить обратно свой nonce, а не чужой.
+			payload, err := l.exchangeV2(context.Background(), wire.Command{Op: wire.OpPing, Arg: 1000 + i}, time.Second)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if len(payload) != 4 || int(binary.LittleEndian.Uint32(payload)) != 1000+i {
+				errs <- &BadReplyError{Op: wire.OpPing, Got: payload}
+				return
+			}
+			errs <- l.send(context.Background(), wire.Command{Op: wire.OpKey, Arg: i}, time.Second)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	seen := make(map[int]bool)
+	for _, cmd := range emu.Commands() {
+		seen[cmd.Arg] = true
+	}
+	if len(seen) != callers {
+		t.Errorf("emulator executed %d distinct keys, want %d", len(seen), callers)
+	}
+}
+
+func TestLateNegotiateReply(t *testing.T) {
+	// Ответ на согласование приходит позже negotiateTimeout, но раньше,
+	// чем хост отказался от v2.
+	emu := emulator.NewWithConfig(emulator.Config{ReplyDelay: negotiateTimeout + 100*time.Millisecond})
+	l, err := connect(Config{}, emu, "emulator", 0, newMetrics())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.close()
+	if l.proto != ProtocolV2 || l.info.Firmware != "emulator" {
+		t.Fatalf("negotiated %s with firmware %q, want v2 with the emulator", l.proto, l.info.Firmware)
+	}
+	if err := l.send(context.Background(), wire.Command{Op: wire.OpKey, Arg: 'a'}, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(emu.Commands()); got != 1 {
+		t.Errorf("emulator executed %d commands, want 1", got)
+	}
+}
+
+func TestNegotiateReplyAfterFallback(t *testing.T) {
+	// Ответ опоздал и на запасное ожидание: хост уже на v1, а прошивка
+	// принимает только кадры. Соединение должно разорваться, а не слать
+	// команды, которые прошивка не поймет.
+	const delay = 2*negotiateTimeout + 200*time.Millisecond
+	emu := emulator.NewWithConfig(emulator.Config{ReplyDelay: delay})
+	start := time.Now()
+	l, err := connect(Config{}, emu, "emulator", 0, newMetrics())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.close()
+	if l.proto != ProtocolV1 {
+		t.Fatalf("negotiated %s, want a fallback to v1", l.proto)
+	}
+	time.Sleep(time.Until(start.Add(delay + 100*time.Millisecond)))
+	if !l.framed() {
+		t.Fatal("reader ignored the late negotiation reply")
+	}
+	err = l.send(context.Background(), wire.Command{Op: wire.OpKey, Arg: 'a'}, time.Second)
+	if !errors.Is(err, ErrPortClosed) {
+		t.Fatalf("send after the late switch = %v, want ErrPortClosed", err)
+	}
+	if l.failure() == nil {
+		t.Error("link is still up after the late switch")
+	}
+	if got := len(emu.Commands()); got != 0 {
+		t.Errorf("emulator executed %d commands, want none", got)
+	}
+	if s := l.metrics.snapshot(); s.LateReplies != 1 {
+		t.Errorf("LateReplies = %d, want 1", s.LateReplies)
+	}
+}
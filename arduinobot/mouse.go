@@ -0,0 +1,92 @@
+package arduinobot
+
+import (
+	"context"
+	"fmt"
+	"image"
+
+	"arduino-go-bot/arduinobot/wire"
+	"arduino-go-bot/platform"
+)
+
+// MouseMoveCtx переводит курсор в точку targetX,targetY рабочего стола.
+// Если прошивка умеет абсолютное позиционирование, точка задается напрямую;
+// иначе курсор сдвигается на разницу с его текущим положением. При заданном
+// Config.Tolerance положение затем проверяется и поправляется; курсор,
+// так и не попавший в цель, дает ErrOffTarget.
+func (c *Controller) MouseMoveCtx(ctx context.Context, targetX, targetY int) error {
+	target := image.Pt(targetX, targetY)
+	if c.Info().Supports(wire.OpMouseMoveAbs) {
+		if err := c.MouseMoveAbsCtx(ctx, targetX, targetY); err != nil {
+			return err
+		}
+	} else {
+		current, err := c.cursorSource().CursorPosition()
+		if err != nil {
+			return fmt.Errorf("failed to get current mouse position: %w", err)
+		}
+		if err := c.MouseMoveByCtx(ctx, targetX-current.X, targetY-current.Y); err != nil {
+			return err
+		}
+	}
+	if c.config.Tolerance <= 0 {
+		return nil
+	}
+	return c.settle(ctx, target)
+}
+
+// MouseMoveAbsCtx ставит курсор в точку x,y виртуального рабочего стола
+// командой абсолютного позиционирования. Точка за краем стола прижимается
+// к краю. Прошивке без wire.OpMouseMoveAbs возвращается ErrUnsupported.
+func (c *Controller) MouseMoveAbsCtx(ctx context.Context, x, y int) error {
+	desktop, err := c.desktop()
+	if err != nil {
+		return err
+	}
+	ax, ay := wire.ToAbs(desktop, image.Pt(x, y))
+	return c.send(ctx, wire.Command{Op: wire.OpMouseMoveAbs, X: ax, Y: ay})
+}
+
+// MouseMoveByCtx сдвигает курсор на dx,dy пикселей. Смещение делится на
+// шаги HID-отчетов по ±wire.MaxStep с поправкой на ускорение указателя по
+// Config.Curve, и шаги уходят пачками по размеру буфера прошивки. Прошивка
+// без wire.OpMouseSteps получает обычные MouseMove, каждый в пределах
+// кодировки v1.
+func (c *Controller) MouseMoveByCtx(ctx context.Context, dx, dy int) error {
+	curve := c.curve()
+	if !c.Info().Supports(wire.OpMouseSteps) {
+		for _, p := range wire.SplitMove(curve.scale(dx), curve.scale(dy), wire.LegacyMaxMove) {
+			if err := c.send(ctx, wire.Command{Op: wire.OpMouseMove, DX: p.X, DY: p.Y}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return c.sendSteps(ctx, curve.planSteps(dx, dy))
+}
+
+// sendSteps (неэкспортируемая) отправляет шаги пачками, которые помещаются
+// в буфер прошивки.
+func (c *Controller) sendSteps(ctx context.Context, steps []wire.Step) error {
+	batch := max(1, min(wire.MaxPayload, c.Info().BufferSize-wire.Overhead)/2)
+	for len(steps) > 0 {
+		n := min(batch, len(steps))
+		if err := c.send(ctx, wire.Command{Op: wire.OpMouseSteps, Steps: steps[:n]}); err != nil {
+			return err
+		}
+		steps = steps[n:]
+	}
+	return nil
+}
+
+// desktop (неэкспортируемая) возвращает границы виртуального рабочего стола.
+func (c *Controller) desktop() (image.Rectangle, error) {
+	if !c.config.Desktop.Empty() {
+		return c.config.Desktop, nil
+	}
+	r, err := platform.Current.Desktop()
+	if err != nil {
+		return image.Rectangle{}, fmt.Errorf("failed to get desktop bounds: %w", err)
+	}
+	return r, nil
+}
@@ -0,0 +1,87 @@
+package arduinobot
+
+import (
+	"image"
+	"testing"
+
+	"arduino-go-bot/arduinobot/emulator"
+	"arduino-go-bot/arduinobot/wire"
+)
+
+// newEmulatedController (неэкспортируемая) создает контроллер поверх
+// эмулятора, который заодно служит источником положения курсора.
+func newEmulatedController(t *testing.T, config emulator.Config, proto Protocol) (*Controller, *emulator.Emulator) {
+	t.Helper()
+	if config.Desktop.Empty() {
+		// Стол эмулятора по умолчанию; у системы его не спрашиваем.
+		config.Desktop = image.Rect(0, 0, 1920, 1080)
+	}
+	emu := emulator.NewWithConfig(config)
+	c, err := NewControllerWithTransport(Config{Protocol: proto, Desktop: config.Desktop, CursorSource: emu}, emu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	return c, emu
+}
+
+// without (неэкспортируемая) возвращает операции по умолчанию без op.
+func without(op wire.Op) []wire.Op {
+	var ops []wire.Op
+	for _, o := range emulator.DefaultOps {
+		if o != op {
+			ops = append(ops, o)
+		}
+	}
+	return ops
+}
+
+func TestMouseMove(t *testing.T) {
+	desktop := image.Rect(-1920, 0, 1920, 1080)
+	tests := []struct {
+		name   string
+		config emulator.Config
+		proto  Protocol
+		op     wire.Op // чем контроллер должен двигать курсор
+	}{
+		{"absolute", emulator.Config{}, ProtocolV2, wire.OpMouseMoveAbs},
+		{"stepped", emulator.Config{Ops: without(wire.OpMouseMoveAbs)}, ProtocolV2, wire.OpMouseSteps},
+		{"split", emulator.Config{Legacy: true}, ProtocolV1, wire.OpMouseMove},
+	}
+	targets := []image.Point{{-1900, 40}, {1919, 1079}, {0, 0}, {-3, 700}, {1500, 2}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Desktop, tt.config.Cursor = desktop, image.Pt(100, 100)
+			c, emu := newEmulatedController(t, tt.config, tt.proto)
+			for _, p := range targets {
+				if err := c.MouseMove(p.X, p.Y); err != nil {
+					t.Fatal(err)
+				}
+				if got := emu.Cursor(); got != p {
+					t.Errorf("cursor after MouseMove(%v) = %v", p, got)
+				}
+			}
+			for _, cmd := range emu.Commands() {
+				if cmd.Op != tt.op {
+					t.Errorf("unexpected %s, want only %s", cmd, tt.op)
+				}
+				if cmd.Op == wire.OpMouseMove && (max(cmd.DX, -cmd.DX) > wire.LegacyMaxMove || max(cmd.DY, -cmd.DY) > wire.LegacyMaxMove) {
+					t.Errorf("%s does not fit the v1 encoding", cmd)
+				}
+				if cmd.Op == wire.OpMouseSteps && 2*len(cmd.Steps)+wire.Overhead > c.Info().BufferSize {
+					t.Errorf("%d steps overflow the %d-byte firmware buffer", len(cmd.Steps), c.Info().BufferSize)
+				}
+			}
+		})
+	}
+}
+
+func TestMouseMoveByClampsAtDesktopEdge(t *testing.T) {
+	c, emu := newEmulatedController(t, emulator.Config{Cursor: image.Pt(10, 10)}, ProtocolV2)
+	if err := c.MouseMoveBy(-500, 300); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := emu.Cursor(), image.Pt(0, 310); got != want {
+		t.Errorf("cursor = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,214 @@
+package arduinobot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"arduino-go-bot/arduinobot/wire"
+)
+
+// Protocol — версия протокола обмена с прошивкой.
+type Protocol int
+
+const (
+	// ProtocolAuto — запросить v2 и остаться на v1, если прошивка не ответила.
+	ProtocolAuto Protocol = iota
+	// ProtocolV1 — исходный ASCII-протокол с ответом "ready".
+	ProtocolV1
+	// ProtocolV2 — кадры с длиной, номером последовательности и CRC.
+	ProtocolV2
+)
+
+func (p Protocol) String() string {
+	switch p {
+	case ProtocolAuto:
+		return "auto"
+	case ProtocolV1:
+		return "v1"
+	case ProtocolV2:
+		return "v2"
+	}
+	return fmt.Sprintf("Protocol(%d)", int(p))
+}
+
+const (
+	commandTimeout   = 700 * time.Millisecond
+	negotiateTimeout = 300 * time.Millisecond
+)
+
+// negotiate (неэкспортируемая) один раз запрашивает переход на протокол v2.
+// Прошивка с поддержкой v2 отвечает на wire.Negotiate строкой wire.NegotiateReply
+// и дальше принимает только кадры; старая прошивка запрос молча игнорирует.
+// Читатель соединения сам переключается на разбор кадров, получив ответ.
+func (l *link) negotiate() (bool, error) {
+	ch, cancel, err := l.expectToken()
+	if err != nil {
+		return false, err
+	}
+	if err := l.write([]byte(wire.Negotiate)); err != nil {
+		cancel()
+		return false, fmt.Errorf("error sending protocol negotiation: %w", err)
+	}
+	r, err := await(context.Background(), ch, negotiateTimeout)
+	if err == ErrTimeout {
+		cancel()
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return r.token == wire.NegotiateReply, nil
+}
+
+// send (неэкспортируемая) отправляет команду в согласованной версии протокола
+// и ожидает подтверждения не дольше timeout.
+func (l *link) send(ctx context.Context, cmd wire.Command, timeout time.Duration) error {
+	if !l.info.Supports(cmd.Op) {
+		return &UnsupportedError{Op: cmd.Op, Firmware: l.info.Firmware}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if l.proto == ProtocolV2 {
+		_, err := l.exchangeV2(ctx, cmd, timeout)
+		return err
+	}
+	if l.framed() {
+		return l.switchedLate()
+	}
+	encoded, err := wire.EncodeASCII(cmd)
+	if err != nil {
+		return err
+	}
+	return l.sendAndReceive(ctx, cmd.Op, encoded, timeout)
+}
+
+// sendAndReceive (неэкспортируемая) отправляет команду v1 и ожидает ответа "ready".
+// В v1 ответы не различимы, поэтому одновременно в полете только одна команда.
+func (l *link) sendAndReceive(ctx context.Context, op wire.Op, cmd string, timeout time.Duration) error {
+	select {
+	case l.v1slot <- struct{}{}:
+		defer func() { <-l.v1slot }()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	ch, cancel, err := l.expectToken()
+	if err != nil {
+		return err
+	}
+	if err := l.write([]byte(cmd)); err != nil {
+		cancel()
+		return fmt.Errorf("error sending command '%s': %w", cmd, err)
+	}
+	sentAt := time.Now()
+	log.Printf("Command sent: %s", cmd)
+	l.metrics.sent()
+
+	r, err := await(ctx, ch, timeout)
+	rtt := time.Since(sentAt)
+	defer func() { l.metrics.done(op, rtt, err) }()
+	switch {
+	case err == ErrTimeout:
+		// Команда уже ушла; ее запоздавший "ready" не должен достаться следующей.
+		l.abandon(ch, time.Now().Add(timeout))
+		err = l.timeoutError(op, timeout)
+	case err != nil && ctx.Err() != nil:
+		l.abandon(ch, sentAt.Add(timeout))
+		return err
+	case err == nil && r.token == wire.NegotiateReply:
+		return l.switchedLate()
+	case err == nil && r.token != wire.ReadyReply:
+		err = &BadReplyError{Op: op, Got: []byte(r.token)}
+	}
+	if err != nil {
+		log.Printf("[Arduino TIMEOUT ERROR] %s on cmd '%s'", err, cmd)
+	}
+	return err
+}
+
+// switchedLate (неэкспортируемая) разрывает соединение v1, на котором
+// прошивка все же перешла на v2 уже после согласования: команды v1 она
+// больше не примет. При следующем подключении прошивка сразу ответит на
+// запрос согласования.
+func (l *link) switchedLate() error {
+	err := fmt.Errorf("firmware switched to protocol v2 after negotiation timed out on %s", l.name)
+	l.fail(err)
+	l.port.Close()
+	return l.failure()
+}
+
+// exchangeV2 (неэкспортируемая) отправляет кадр v2, ожидает Ack или Nack с тем же
+// seq и возвращает payload подтверждения. Кадры v2 различимы по seq, поэтому
+// несколько вызовов могут ждать ответа одновременно.
+func (l *link) exchangeV2(ctx context.Context, cmd wire.Command, timeout time.Duration) ([]byte, error) {
+	payload, err := wire.EncodePayload(cmd)
+	if err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	l.seq++
+	seq := l.seq
+	l.mu.Unlock()
+	frame, err := wire.AppendFrame(nil, wire.Frame{Op: cmd.Op, Seq: seq, Payload: payload})
+	if err != nil {
+		return nil, err
+	}
+
+	ch, cancel, err := l.expectSeq(seq)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.write(frame); err != nil {
+		cancel()
+		return nil, fmt.Errorf("error sending command '%s': %w", cmd, err)
+	}
+	sentAt := time.Now()
+	log.Printf("Command sent: #%d %s", seq, cmd)
+	l.metrics.sent()
+
+	r, err := await(ctx, ch, timeout)
+	rtt := time.Since(sentAt)
+	defer func() { l.metrics.done(cmd.Op, rtt, err) }()
+	switch {
+	case err == ErrTimeout:
+		cancel()
+		err = l.timeoutError(cmd.Op, timeout)
+	case err != nil && ctx.Err() != nil:
+		cancel()
+		return nil, err
+	case err == nil && r.frame.Op == wire.OpNack:
+		err = &NackError{Op: cmd.Op, Code: wire.NackReason(r.frame)}
+	}
+	if err != nil {
+		log.Printf("[Arduino ERROR] %s on cmd #%d %s", err, seq, cmd)
+		return nil, err
+	}
+	return r.frame.Payload, nil
+}
+
+// await (неэкспортируемая) ждет ответа читателя не дольше timeout
+// и не дольше, чем жив ctx.
+func await(ctx context.Context, ch chan reply, timeout time.Duration) (reply, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-ch:
+		return r, r.err
+	case <-timer.C:
+		return reply{}, ErrTimeout
+	case <-ctx.Done():
+		return reply{}, ctx.Err()
+	}
+}
+
+// timeoutError (неэкспортируемая) описывает неподтвержденную команду. Если за
+// время ожидания пришли посторонние байты, это BadReplyError, иначе ErrTimeout.
+func (l *link) timeoutError(op wire.Op, timeout time.Duration) error {
+	if got := l.takeGarbage(); len(got) > 0 {
+		return &BadReplyError{Op: op, Got: got}
+	}
+	return fmt.Errorf("%w: %s after %s", ErrTimeout, op, timeout)
+}
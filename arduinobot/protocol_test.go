@@ -0,0 +1,126 @@
+package arduinobot
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"arduino-go-bot/arduinobot/emulator"
+	"arduino-go-bot/arduinobot/wire"
+)
+
+func TestCancelInFlight(t *testing.T) {
+	const delay = 400 * time.Millisecond
+	for _, proto := range []Protocol{ProtocolV1, ProtocolV2} {
+		t.Run(proto.String(), func(t *testing.T) {
+			c, emu := newEmulatedController(t, emulator.Config{Legacy: proto == ProtocolV1, ReplyDelay: delay}, proto)
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(50*time.Millisecond, cancel)
+			start := time.Now()
+			err := c.KeyCtx(ctx, 'a')
+			if elapsed := time.Since(start); elapsed > delay/2 {
+				t.Errorf("cancelled command returned after %s", elapsed)
+			}
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("KeyCtx: %v, want context.Canceled", err)
+			}
+			// Команда уже ушла на плату.
+			if cmds := emu.Commands(); len(cmds) != 1 || cmds[0].Arg != 'a' {
+				t.Errorf("firmware received %v", cmds)
+			}
+
+			// Запоздавшее подтверждение отмененной команды не достается следующей:
+			// она ждет свое и не принимает чужое за него.
+			start = time.Now()
+			if err := c.KeyCtx(context.Background(), 'b'); err != nil {
+				t.Fatalf("command after a cancelled one: %v", err)
+			}
+			if elapsed := time.Since(start); elapsed < delay {
+				t.Errorf("command after a cancelled one confirmed after %s, before its own reply", elapsed)
+			}
+		})
+	}
+
+	// Уже отмененный ctx не отправляет команду вовсе.
+	c, emu := newEmulatedController(t, emulator.Config{}, ProtocolV2)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := c.KeyCtx(ctx, 'a'); !errors.Is(err, context.Canceled) {
+		t.Errorf("KeyCtx with a cancelled ctx: %v", err)
+	}
+	if cmds := emu.Commands(); len(cmds) != 0 {
+		t.Errorf("firmware received %v", cmds)
+	}
+}
+
+func TestTimeoutsForOp(t *testing.T) {
+	timeouts := Timeouts{
+		Settings: 1 * time.Millisecond,
+		Key:      2 * time.Millisecond,
+		Text:     3 * time.Millisecond,
+		Mouse:    4 * time.Millisecond,
+		Move:     5 * time.Millisecond,
+	}
+	tests := []struct {
+		op   wire.Op
+		want time.Duration
+	}{
+		{wire.OpSetDelayKey, 1 * time.Millisecond},
+		{wire.OpSetRandomDelayMouse, 1 * time.Millisecond},
+		{wire.OpKey, 2 * time.Millisecond},
+		{wire.OpKeyDown, 2 * time.Millisecond},
+		{wire.OpKeyUp, 2 * time.Millisecond},
+		{wire.OpText, 3 * time.Millisecond},
+		{wire.OpMouseClick, 4 * time.Millisecond},
+		{wire.OpMouseWheel, 4 * time.Millisecond},
+		{wire.OpMouseMove, 5 * time.Millisecond},
+		{wire.OpMouseMoveAbs, 5 * time.Millisecond},
+		{wire.OpMouseSteps, 5 * time.Millisecond},
+		{wire.OpPing, commandTimeout},
+	}
+	for _, tt := range tests {
+		if got := timeouts.forOp(tt.op); got != tt.want {
+			t.Errorf("%s: timeout %s, want %s", tt.op, got, tt.want)
+		}
+		if got := (Timeouts{}).forOp(tt.op); got != commandTimeout {
+			t.Errorf("%s: default timeout %s, want %s", tt.op, got, commandTimeout)
+		}
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	const delay = 200 * time.Millisecond
+	emu := emulator.NewWithConfig(emulator.Config{ReplyDelay: delay})
+	c, err := NewControllerWithTransport(Config{
+		Protocol: ProtocolV2,
+		Timeouts: Timeouts{Key: delay / 2, Mouse: 3 * delay},
+	}, emu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Клавишам отведено меньше задержки платы.
+	start := time.Now()
+	err = c.KeyCtx(context.Background(), 'a')
+	elapsed := time.Since(start)
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("KeyCtx: %v, want ErrTimeout", err)
+	}
+	if elapsed < delay/2 || elapsed >= delay {
+		t.Errorf("KeyCtx timed out after %s, want %s", elapsed, delay/2)
+	}
+
+	// Мыши и текстовым командам (таймаут по умолчанию) — больше.
+	time.Sleep(delay) // пусть запоздавший ответ на Key придет
+	if err := c.MouseClickCtx(context.Background(), 1); err != nil {
+		t.Errorf("MouseClickCtx: %v", err)
+	}
+	if err := c.TextCtx(context.Background(), "hi"); err != nil {
+		t.Errorf("TextCtx: %v", err)
+	}
+	if got := c.Stats().Timeouts; got != 1 {
+		t.Errorf("%d timeouts counted, want 1", got)
+	}
+}
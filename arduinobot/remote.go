@@ -0,0 +1,29 @@
+package arduinobot
+
+import (
+	"fmt"
+	"time"
+
+	"arduino-go-bot/arduinobot/bridge"
+)
+
+// bridgeScheme — префикс Config.Port платы за мостом.
+const bridgeScheme = "tcp://"
+
+// bridgePing — как часто мерить задержку сети до моста.
+const bridgePing = 2 * time.Second
+
+// openBridge (неэкспортируемая) подключается к мосту addr и выполняет
+// рукопожатие с платой за ним. Задержка сети до моста попадает
+// в Stats.Network, обрыв сети — в ошибку чтения, как у выдернутой платы.
+func openBridge(config Config, addr string, m *metrics) (*link, error) {
+	conn, err := bridge.Dial(addr, bridge.Config{
+		Key:          []byte(config.BridgeKey),
+		PingInterval: bridgePing,
+		OnRTT:        m.network,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s%s: %w", bridgeScheme, addr, err)
+	}
+	return connect(config, conn, bridgeScheme+addr, bootWindow(config), m)
+}
@@ -0,0 +1,284 @@
+package arduinobot
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"arduino-go-bot/arduinobot/wire"
+)
+
+// OpClass — класс команд, как в Timeouts: по нему группируются задержки.
+type OpClass int
+
+const (
+	ClassSettings OpClass = iota // SetDelay*, SetOffsetMouseMove, SetRandomDelay*
+	ClassKey                     // Key, KeyDown, KeyUp
+	ClassText                    // Text
+	ClassMouse                   // MouseClick, MouseDown, MouseUp, MouseWheel
+	ClassMove                    // MouseMove, MouseMoveAbs, MouseSteps
+	ClassControl                 // служебные: Hello, Ping
+)
+
+func (c OpClass) String() string {
+	switch c {
+	case ClassSettings:
+		return "settings"
+	case ClassKey:
+		return "key"
+	case ClassText:
+		return "text"
+	case ClassMouse:
+		return "mouse"
+	case ClassMove:
+		return "move"
+	case ClassControl:
+		return "control"
+	}
+	return fmt.Sprintf("OpClass(%d)", int(c))
+}
+
+// ClassOf возвращает класс операции op.
+func ClassOf(op wire.Op) OpClass {
+	switch op {
+	case wire.OpKey, wire.OpKeyDown, wire.OpKeyUp:
+		return ClassKey
+	case wire.OpText:
+		return ClassText
+	case wire.OpMouseClick, wire.OpMouseDown, wire.OpMouseUp, wire.OpMouseWheel:
+		return ClassMouse
+	case wire.OpMouseMove, wire.OpMouseMoveAbs, wire.OpMouseSteps:
+		return ClassMove
+	}
+	if isSetting(op) {
+		return ClassSettings
+	}
+	return ClassControl
+}
+
+// LatencyBuckets — верхние границы корзин Histogram.
+var LatencyBuckets = []time.Duration{
+	time.Millisecond,
+	2 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	20 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	200 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+}
+
+// Histogram — распределение задержек от записи команды в порт до ее
+// подтверждения. Counts[i] — сколько задержек не больше Bounds[i] и больше
+// Bounds[i-1]; последний элемент Counts — задержки длиннее всех границ.
+type Histogram struct {
+	Bounds   []time.Duration
+	Counts   []uint64
+	Count    uint64
+	Sum      time.Duration
+	Min, Max time.Duration
+}
+
+func newHistogram() *Histogram {
+	return &Histogram{Bounds: LatencyBuckets, Counts: make([]uint64, len(LatencyBuckets)+1)}
+}
+
+func (h *Histogram) observe(d time.Duration) {
+	h.Counts[sort.Search(len(h.Bounds), func(i int) bool { return d <= h.Bounds[i] })]++
+	if h.Count == 0 || d < h.Min {
+		h.Min = d
+	}
+	h.Max = max(h.Max, d)
+	h.Count++
+	h.Sum += d
+}
+
+func (h *Histogram) clone() Histogram {
+	c := *h
+	c.Counts = append([]uint64(nil), h.Counts...)
+	return c
+}
+
+// Mean возвращает среднюю задержку.
+func (h Histogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// Quantile оценивает квантиль q (0..1): находит корзину, в которую он попал,
+// и считает задержки в ней распределенными равномерно между ее границами,
+// суженными до Min и Max.
+func (h Histogram) Quantile(q float64) time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	rank := min(max(q, 0), 1) * float64(h.Count)
+	var seen uint64
+	for i, n := range h.Counts {
+		if n == 0 || float64(seen+n) < rank {
+			seen += n
+			continue
+		}
+		lo, hi := h.Min, h.Max
+		if i > 0 {
+			lo = max(lo, h.Bounds[i-1])
+		}
+		if i < len(h.Bounds) {
+			hi = min(hi, h.Bounds[i])
+		}
+		frac := (rank - float64(seen)) / float64(n)
+		return lo + time.Duration(frac*float64(hi-lo))
+	}
+	return h.Max
+}
+
+// Stats — снимок состояния связи с платой с момента создания контроллера.
+// Рост Timeouts, BadReplies и Discarded при тех же командах значит, что
+// деградирует плата или USB-линия, рост Reconnects — что плата пропадает.
+type Stats struct {
+	Since time.Time
+	// Latency — задержки подтвержденных команд по классам.
+	Latency map[OpClass]Histogram
+	// Commands — отправленные команды, Failed — из них не подтвержденные
+	// по любой причине, включая отмену ctx.
+	Commands uint64
+	Failed   uint64
+	// Timeouts — команды без ответа; BadReplies — команды, вместо ответа
+	// на которые пришли посторонние байты; Rejected — отказы прошивки (Nack).
+	Timeouts   uint64
+	BadReplies uint64
+	Rejected   uint64
+	// LateReplies — ответы, которых уже никто не ждал: на команды после
+	// таймаута или отмены.
+	LateReplies uint64
+	// Discarded — байты от платы, не ставшие ответом: шум и битые кадры.
+	Discarded uint64
+	// Retries — неудачные попытки подключения, после которых супервизор
+	// пробовал снова; Reconnects — удачные подключения после первого.
+	Retries    uint64
+	Reconnects uint64
+	// Connects — все удачные подключения, LastConnect — время последнего.
+	Connects    uint64
+	LastConnect time.Time
+	// HeartbeatFailures — соединения, разорванные из-за пинга без ответа.
+	HeartbeatFailures uint64
+	// Network — задержка сети до моста и обратно, для платы за tcp://;
+	// ее вычет из Latency показывает, сколько занимает сама плата.
+	Network Histogram
+}
+
+// String возвращает сводку в одну строку для журнала и интерфейса.
+func (s Stats) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d commands, %d failed, %d timeouts, %d reconnects", s.Commands, s.Failed, s.Timeouts, s.Reconnects)
+	classes := make([]OpClass, 0, len(s.Latency))
+	for c := range s.Latency {
+		classes = append(classes, c)
+	}
+	sort.Slice(classes, func(i, j int) bool { return classes[i] < classes[j] })
+	for _, c := range classes {
+		h := s.Latency[c]
+		fmt.Fprintf(&b, "; %s p50 %s p95 %s", c, h.Quantile(0.5).Round(time.Microsecond), h.Quantile(0.95).Round(time.Microsecond))
+	}
+	if s.Network.Count > 0 {
+		fmt.Fprintf(&b, "; network p50 %s p95 %s", s.Network.Quantile(0.5).Round(time.Microsecond), s.Network.Quantile(0.95).Round(time.Microsecond))
+	}
+	return b.String()
+}
+
+// metrics копит Stats. Один экземпляр принадлежит контроллеру и переживает
+// переподключения; соединения пишут в него через link.metrics.
+type metrics struct {
+	mu      sync.Mutex
+	stats   Stats
+	latency map[OpClass]*Histogram
+	net     *Histogram
+}
+
+func newMetrics() *metrics {
+	return &metrics{stats: Stats{Since: time.Now()}, latency: make(map[OpClass]*Histogram), net: newHistogram()}
+}
+
+// sent (неэкспортируемая) учитывает отправленную команду.
+func (m *metrics) sent() {
+	m.add(&m.stats.Commands, 1)
+}
+
+// done (неэкспортируемая) учитывает исход команды op: задержку rtt от записи
+// до подтверждения или ошибку err.
+func (m *metrics) done(op wire.Op, rtt time.Duration, err error) {
+	if err != nil {
+		m.failed(err)
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h := m.latency[ClassOf(op)]
+	if h == nil {
+		h = newHistogram()
+		m.latency[ClassOf(op)] = h
+	}
+	h.observe(rtt)
+}
+
+// failed (неэкспортируемая) учитывает команду, не получившую подтверждения.
+func (m *metrics) failed(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stats.Failed++
+	switch {
+	case errors.Is(err, ErrBadReply):
+		m.stats.BadReplies++
+	case errors.Is(err, ErrRejected):
+		m.stats.Rejected++
+	case errors.Is(err, ErrTimeout):
+		m.stats.Timeouts++
+	}
+}
+
+// network (неэкспортируемая) учитывает задержку сети до моста.
+func (m *metrics) network(rtt time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.net.observe(rtt)
+}
+
+// connected (неэкспортируемая) учитывает удачное подключение.
+func (m *metrics) connected() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stats.Connects > 0 {
+		m.stats.Reconnects++
+	}
+	m.stats.Connects++
+	m.stats.LastConnect = time.Now()
+}
+
+func (m *metrics) add(counter *uint64, n uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	*counter += n
+}
+
+func (m *metrics) snapshot() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.stats
+	s.Latency = make(map[OpClass]Histogram, len(m.latency))
+	for c, h := range m.latency {
+		s.Latency[c] = h.clone()
+	}
+	s.Network = m.net.clone()
+	return s
+}
+
+// Stats возвращает снимок задержек и счетчиков связи с платой. Снимок
+// не меняется после возврата; разницу за интервал дают два снимка.
+func (c *Controller) Stats() Stats { return c.metrics.snapshot() }
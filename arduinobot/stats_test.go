@@ -0,0 +1,152 @@
+package arduinobot
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"arduino-go-bot/arduinobot/emulator"
+)
+
+func TestHistogramBuckets(t *testing.T) {
+	h := newHistogram()
+	// Граница корзины входит в нее, чуть больше — уже в следующую.
+	for _, d := range []time.Duration{time.Millisecond, time.Millisecond + 1, 5 * time.Millisecond, time.Second, 3 * time.Second} {
+		h.observe(d)
+	}
+	want := make([]uint64, len(LatencyBuckets)+1)
+	want[0], want[1], want[2], want[len(LatencyBuckets)-1], want[len(LatencyBuckets)] = 1, 1, 1, 1, 1
+	for i := range want {
+		if h.Counts[i] != want[i] {
+			t.Errorf("Counts = %v, want %v", h.Counts, want)
+			break
+		}
+	}
+	if h.Count != 5 || h.Min != time.Millisecond || h.Max != 3*time.Second {
+		t.Errorf("Count %d, Min %s, Max %s", h.Count, h.Min, h.Max)
+	}
+	if mean := h.Mean(); mean != (4*time.Second+7*time.Millisecond+1)/5 {
+		t.Errorf("Mean = %s", mean)
+	}
+	// Самые долгие задержки оцениваются по Max, а не по последней границе.
+	if q := h.Quantile(1); q != 3*time.Second {
+		t.Errorf("Quantile(1) = %s, want Max", q)
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	var empty Histogram
+	if empty.Quantile(0.5) != 0 || empty.Mean() != 0 {
+		t.Errorf("empty histogram: p50 %s, mean %s", empty.Quantile(0.5), empty.Mean())
+	}
+
+	h := newHistogram()
+	h.observe(time.Millisecond)
+	h.observe(2 * time.Millisecond)
+	tests := []struct {
+		q    float64
+		want time.Duration
+	}{
+		{-1, time.Millisecond}, // q прижимается к 0..1
+		{0, time.Millisecond},
+		{0.5, time.Millisecond},
+		{0.75, 1500 * time.Microsecond},
+		{1, 2 * time.Millisecond},
+		{2, 2 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := h.Quantile(tt.q); got != tt.want {
+			t.Errorf("Quantile(%g) = %s, want %s", tt.q, got, tt.want)
+		}
+	}
+
+	// Одинаковые задержки: корзина сужается до Min и Max.
+	same := newHistogram()
+	for i := 0; i < 10; i++ {
+		same.observe(30 * time.Millisecond)
+	}
+	for _, q := range []float64{0.1, 0.5, 0.99} {
+		if got := same.Quantile(q); got != 30*time.Millisecond {
+			t.Errorf("equal latencies: Quantile(%g) = %s", q, got)
+		}
+	}
+
+	// Снимок не меняется вместе с оригиналом.
+	c := h.clone()
+	h.observe(time.Second)
+	if c.Count != 2 || c.Counts[len(c.Counts)-2] != 0 {
+		t.Errorf("clone changed with the original: %+v", c)
+	}
+}
+
+func TestStatsPerClass(t *testing.T) {
+	c, _ := newEmulatedController(t, emulator.Config{}, ProtocolV2)
+	before := c.Stats()
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if err := c.KeyCtx(ctx, 'a'); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if err := c.MouseClickCtx(ctx, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := c.Stats()
+	if got := s.Commands - before.Commands; got != 5 {
+		t.Errorf("%d commands counted, want 5", got)
+	}
+	if s.Failed != 0 {
+		t.Errorf("%d failed", s.Failed)
+	}
+	for class, want := range map[OpClass]uint64{ClassKey: 3, ClassMouse: 2} {
+		if got := s.Latency[class].Count - before.Latency[class].Count; got != want {
+			t.Errorf("%s latencies: %d, want %d", class, got, want)
+		}
+	}
+	if _, ok := s.Latency[ClassText]; ok {
+		t.Error("text latency without text commands")
+	}
+	if str := s.String(); !strings.Contains(str, "key p50") || !strings.Contains(str, "mouse p50") {
+		t.Errorf("String() = %q", str)
+	}
+}
+
+func TestStatsCounters(t *testing.T) {
+	const delay = 200 * time.Millisecond
+	d := &scriptedDialer{config: emulator.Config{ReplyDelay: delay}, plan: []bool{false}, then: true}
+	s := supervise(t, Config{Timeouts: Timeouts{Key: delay / 2}}, d)
+	events, unsubscribe := s.Subscribe()
+	defer unsubscribe()
+	waitFor(t, events, StateConnected)
+	c := s.Controller()
+
+	st := c.Stats()
+	if st.Retries != 1 || st.Connects != 1 || st.Reconnects != 0 {
+		t.Errorf("after the first connection: %d retries, %d connects, %d reconnects; want 1, 1, 0", st.Retries, st.Connects, st.Reconnects)
+	}
+
+	if err := c.KeyCtx(context.Background(), 'a'); err == nil {
+		t.Fatal("Key was confirmed before the reply delay")
+	}
+	time.Sleep(delay) // запоздавший ответ
+	st = c.Stats()
+	if st.Timeouts != 1 || st.Failed != 1 || st.LateReplies != 1 {
+		t.Errorf("after a timeout: %d timeouts, %d failed, %d late replies; want 1, 1, 1", st.Timeouts, st.Failed, st.LateReplies)
+	}
+
+	if err := c.Reconnect(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, events, StateDisconnected)
+	waitFor(t, events, StateConnected)
+	st = c.Stats()
+	if st.Connects != 2 || st.Reconnects != 1 || st.Retries != 1 {
+		t.Errorf("after a reconnect: %d connects, %d reconnects, %d retries; want 2, 1, 1", st.Connects, st.Reconnects, st.Retries)
+	}
+	if st.LastConnect.Before(st.Since) {
+		t.Errorf("LastConnect %s before Since %s", st.LastConnect, st.Since)
+	}
+}
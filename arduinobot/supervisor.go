@@ -0,0 +1,259 @@
+package arduinobot
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// State — состояние соединения под супервизором.
+type State int
+
+const (
+	StateDisconnected State = iota
+	StateConnecting
+	StateConnected
+	StateClosed
+)
+
+func (s State) String() string {
+	switch s {
+	case StateDisconnected:
+		return "disconnected"
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateClosed:
+		return "closed"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// Event — смена состояния соединения. Err — причина разрыва или неудачной
+// попытки подключения, Port — имя порта, если он известен.
+type Event struct {
+	State State
+	Port  string
+	Err   error
+	At    time.Time
+}
+
+// Dialer открывает транспорт к плате и возвращает его имя для журнала.
+type Dialer func() (Transport, string, error)
+
+const (
+	minBackoff          = 500 * time.Millisecond
+	maxBackoff          = 10 * time.Second
+	defaultPollInterval = time.Second
+	// eventBuffer — сколько событий подписчик может не забирать,
+	// прежде чем новые события для него начнут теряться.
+	eventBuffer = 16
+)
+
+// Supervisor держит соединение с платой: замечает отключение и повторное
+// подключение, заново открывает порт с нарастающей паузой и публикует смену
+// состояния подписчикам. Controller, выданный супервизором, остается
+// действительным все это время.
+type Supervisor struct {
+	config  Config
+	open    func(m *metrics) (*link, error)
+	present func(port string) bool // nil — присутствие порта не проверяется
+	ctrl    *Controller
+
+	mu     sync.Mutex
+	state  State
+	port   string
+	subs   map[chan Event]struct{}
+	closed bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewSupervisor создает супервизор для платы, выбранной по config так же,
+// как в NewController, и сразу начинает подключаться в фоне. Плата ищется
+// заново при каждом переподключении.
+func NewSupervisor(config Config) *Supervisor {
+	s := newSupervisor(config, func(m *metrics) (*link, error) {
+		portName, err := findArduinoPort(config)
+		if err != nil {
+			return nil, err
+		}
+		return openPort(config, portName, m)
+	})
+	s.present = portPresent
+	go s.run()
+	return s
+}
+
+// NewSupervisorWithDialer создает супервизор, который получает транспорт
+// от dial. Отключение замечается только по ошибкам чтения и записи.
+func NewSupervisorWithDialer(config Config, dial Dialer) *Supervisor {
+	s := newSupervisor(config, func(m *metrics) (*link, error) {
+		t, name, err := dial()
+		if err != nil {
+			return nil, err
+		}
+		return connect(config, t, name, config.BootTimeout, m)
+	})
+	go s.run()
+	return s
+}
+
+func newSupervisor(config Config, open func(m *metrics) (*link, error)) *Supervisor {
+	s := &Supervisor{
+		config: config,
+		open:   open,
+		subs:   make(map[chan Event]struct{}),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	s.ctrl = newController(config)
+	s.ctrl.sup = s
+	s.ctrl.startHeartbeat()
+	return s
+}
+
+// Controller возвращает контроллер, который переживает переподключения.
+func (s *Supervisor) Controller() *Controller { return s.ctrl }
+
+// State возвращает текущее состояние соединения.
+func (s *Supervisor) State() State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// Subscribe возвращает канал событий и функцию отписки. Сразу после подписки
+// в канал приходит текущее состояние. Медленный подписчик теряет события,
+// но не задерживает супервизор.
+func (s *Supervisor) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, eventBuffer)
+	s.mu.Lock()
+	ch <- Event{State: s.state, Port: s.port, At: time.Now()}
+	if s.closed {
+		close(ch)
+		s.mu.Unlock()
+		return ch, func() {}
+	}
+	s.subs[ch] = struct{}{}
+	s.mu.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if _, ok := s.subs[ch]; ok {
+				delete(s.subs, ch)
+				close(ch)
+			}
+		})
+	}
+}
+
+// Close останавливает супервизор и закрывает соединение.
+func (s *Supervisor) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		<-s.done
+		return
+	}
+	s.closed = true
+	s.mu.Unlock()
+	close(s.stop)
+	<-s.done
+}
+
+func (s *Supervisor) publish(state State, port string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state, s.port = state, port
+	ev := Event{State: state, Port: port, Err: err, At: time.Now()}
+	for ch := range s.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+	if state == StateClosed {
+		for ch := range s.subs {
+			close(ch)
+		}
+		s.subs = nil
+	}
+}
+
+// run (неэкспортируемая) — цикл супервизора: подключиться, дождаться разрыва,
+// повторить.
+func (s *Supervisor) run() {
+	defer close(s.done)
+	defer s.publish(StateClosed, "", nil)
+	defer s.ctrl.shutdown()
+
+	poll := s.config.PollInterval
+	if poll <= 0 {
+		poll = defaultPollInterval
+	}
+	backoff := minBackoff
+	for {
+		s.publish(StateConnecting, "", nil)
+		l, err := s.open(s.ctrl.metrics)
+		if err != nil {
+			log.Printf("[Arduino] connect failed, retry in %s: %v", backoff, err)
+			s.ctrl.metrics.add(&s.ctrl.metrics.stats.Retries, 1)
+			s.publish(StateDisconnected, "", err)
+			select {
+			case <-time.After(backoff):
+			case <-s.stop:
+				return
+			}
+			backoff = min(backoff*2, maxBackoff)
+			continue
+		}
+		backoff = minBackoff
+
+		// Плата, которая не перезагрузилась, все еще держит нажатым то,
+		// что не успели отпустить до разрыва.
+		s.ctrl.restoreSettings(l)
+		s.ctrl.releaseOn(l)
+		s.ctrl.attach(l)
+		s.publish(StateConnected, l.name, nil)
+
+		err = s.watch(l, poll)
+		if err == nil {
+			s.ctrl.releaseOn(l)
+		}
+		l.close()
+		s.ctrl.detach(l)
+		if err == nil {
+			return
+		}
+		log.Printf("[Arduino] connection on %s lost: %v", l.name, err)
+		s.publish(StateDisconnected, l.name, err)
+	}
+}
+
+// watch (неэкспортируемая) ждет разрыва соединения l. Возвращает nil, если
+// супервизор остановлен, иначе причину разрыва.
+func (s *Supervisor) watch(l *link, poll time.Duration) error {
+	// Порт, которого нет в списке системы (например, псевдотерминал),
+	// проверять на исчезновение бессмысленно.
+	listed := s.present != nil && s.present(l.name)
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return nil
+		case <-l.done:
+			return l.failure()
+		case <-ticker.C:
+			if listed && !s.present(l.name) {
+				return fmt.Errorf("%w: port %s disappeared", ErrPortClosed, l.name)
+			}
+		}
+	}
+}
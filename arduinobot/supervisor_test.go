@@ -0,0 +1,267 @@
+package arduinobot
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"arduino-go-bot/arduinobot/emulator"
+	"arduino-go-bot/arduinobot/keys"
+)
+
+// scriptedDialer (неэкспортируемая) открывает эмулятор с config или
+// отказывает по плану: plan[i] — удастся ли i-я попытка, после конца
+// плана — then.
+type scriptedDialer struct {
+	config emulator.Config
+
+	mu    sync.Mutex
+	plan  []bool
+	then  bool
+	dials int
+	emus  []*emulator.Emulator
+}
+
+var errNoBoard = errors.New("no board")
+
+func (d *scriptedDialer) dial() (Transport, string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ok := d.then
+	if d.dials < len(d.plan) {
+		ok = d.plan[d.dials]
+	}
+	d.dials++
+	if !ok {
+		return nil, "", errNoBoard
+	}
+	emu := emulator.NewWithConfig(d.config)
+	d.emus = append(d.emus, emu)
+	return emu, "emulator", nil
+}
+
+// succeed (неэкспортируемая) меняет исход всех следующих попыток.
+func (d *scriptedDialer) succeed(ok bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.plan, d.then = nil, ok
+}
+
+// last (неэкспортируемая) возвращает последний открытый эмулятор.
+func (d *scriptedDialer) last() *emulator.Emulator {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.emus[len(d.emus)-1]
+}
+
+func supervise(t *testing.T, config Config, d *scriptedDialer) *Supervisor {
+	t.Helper()
+	config.Protocol = ProtocolV2
+	s := NewSupervisorWithDialer(config, d.dial)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// waitFor (неэкспортируемая) пропускает события до состояния state.
+func waitFor(t *testing.T, events <-chan Event, state State) Event {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				t.Fatalf("events closed while waiting for %s", state)
+			}
+			if ev.State == state {
+				return ev
+			}
+		case <-timeout:
+			t.Fatalf("no %s event", state)
+		}
+	}
+}
+
+func TestSupervisorBackoff(t *testing.T) {
+	d := &scriptedDialer{plan: []bool{false, false, false, true, false}, then: true}
+	s := supervise(t, Config{}, d)
+	events, unsubscribe := s.Subscribe()
+	defer unsubscribe()
+
+	// Между неудачными попытками пауза растет вдвое, начиная с minBackoff.
+	var attempts []time.Time
+	for len(attempts) < 4 {
+		attempts = append(attempts, waitFor(t, events, StateConnecting).At)
+	}
+	ev := waitFor(t, events, StateConnected)
+	if ev.Port != "emulator" {
+		t.Errorf("connected to %q", ev.Port)
+	}
+	for i, want := range []time.Duration{minBackoff, 2 * minBackoff, 4 * minBackoff} {
+		if gap := attempts[i+1].Sub(attempts[i]); gap < want || gap > want+300*time.Millisecond {
+			t.Errorf("pause before attempt %d: %s, want %s", i+2, gap, want)
+		}
+	}
+
+	// После удачного подключения пауза снова минимальная, а первая попытка
+	// после разрыва делается сразу.
+	lost := time.Now()
+	if err := s.Controller().Reconnect(); err != nil {
+		t.Fatal(err)
+	}
+	if ev := waitFor(t, events, StateDisconnected); !errors.Is(ev.Err, ErrPortClosed) {
+		t.Errorf("disconnect reason %v", ev.Err)
+	}
+	first := waitFor(t, events, StateConnecting).At
+	if gap := first.Sub(lost); gap > 200*time.Millisecond {
+		t.Errorf("reconnect started %s after the link was lost", gap)
+	}
+	if ev := waitFor(t, events, StateDisconnected); !errors.Is(ev.Err, errNoBoard) {
+		t.Errorf("failed attempt reason %v", ev.Err)
+	}
+	second := waitFor(t, events, StateConnecting).At
+	if gap := second.Sub(first); gap < minBackoff || gap > minBackoff+300*time.Millisecond {
+		t.Errorf("pause after a successful connection: %s, want %s", gap, minBackoff)
+	}
+	waitFor(t, events, StateConnected)
+	if s.State() != StateConnected {
+		t.Errorf("state %s", s.State())
+	}
+	if got := s.Controller().Stats().Retries; got != 4 {
+		t.Errorf("%d retries counted, want 4", got)
+	}
+}
+
+func TestSupervisorReconnectWait(t *testing.T) {
+	const wait = time.Second
+	d := &scriptedDialer{then: true}
+	s := supervise(t, Config{ReconnectWait: wait}, d)
+	events, unsubscribe := s.Subscribe()
+	defer unsubscribe()
+	waitFor(t, events, StateConnected)
+	c := s.Controller()
+	if err := c.KeyCtx(context.Background(), 'a'); err != nil {
+		t.Fatal(err)
+	}
+
+	// Плата пропала: команда ждет ReconnectWait и получает ErrPortClosed.
+	d.succeed(false)
+	d.last().Close()
+	waitFor(t, events, StateDisconnected)
+	start := time.Now()
+	err := c.KeyCtx(context.Background(), 'b')
+	if elapsed := time.Since(start); elapsed < wait || elapsed > wait+300*time.Millisecond {
+		t.Errorf("command failed after %s, want %s", elapsed, wait)
+	}
+	if !errors.Is(err, ErrPortClosed) {
+		t.Errorf("command during the outage: %v, want ErrPortClosed", err)
+	}
+
+	// Отмена ctx прерывает ожидание раньше.
+	ctx, cancel := context.WithTimeout(context.Background(), wait/4)
+	defer cancel()
+	if err := c.KeyCtx(ctx, 'b'); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("cancelled command during the outage: %v", err)
+	}
+
+	// Плата вернулась, пока команда ждала: команда уходит на новое соединение.
+	d.succeed(true)
+	if err := c.KeyCtx(context.Background(), 'c'); err != nil {
+		t.Fatalf("command while reconnecting: %v", err)
+	}
+	cmds := d.last().Commands()
+	if len(cmds) != 1 || cmds[0].Arg != 'c' {
+		t.Errorf("new connection got %v, want only Key c", cmds)
+	}
+}
+
+func TestSupervisorWithoutReconnectWait(t *testing.T) {
+	d := &scriptedDialer{then: true}
+	s := supervise(t, Config{}, d)
+	events, unsubscribe := s.Subscribe()
+	defer unsubscribe()
+	waitFor(t, events, StateConnected)
+
+	d.succeed(false)
+	d.last().Close()
+	waitFor(t, events, StateDisconnected)
+	start := time.Now()
+	if err := s.Controller().KeyCtx(context.Background(), 'a'); !errors.Is(err, ErrPortClosed) {
+		t.Errorf("command during the outage: %v, want ErrPortClosed", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("command without ReconnectWait waited %s", elapsed)
+	}
+}
+
+func TestSupervisorSubscribe(t *testing.T) {
+	d := &scriptedDialer{then: true}
+	s := NewSupervisorWithDialer(Config{Protocol: ProtocolV2}, d.dial)
+	events, unsubscribe := s.Subscribe()
+	other, _ := s.Subscribe()
+	waitFor(t, events, StateConnected)
+
+	// Отписка закрывает канал; повторная ничего не ломает.
+	unsubscribe()
+	unsubscribe()
+	for range events {
+	}
+
+	// Close закрывает каналы оставшихся подписчиков последним событием.
+	s.Close()
+	var last Event
+	for ev := range other {
+		last = ev
+	}
+	if last.State != StateClosed {
+		t.Errorf("last event %s, want closed", last.State)
+	}
+	late, unsubscribe := s.Subscribe()
+	unsubscribe()
+	if ev, ok := <-late; !ok || ev.State != StateClosed {
+		t.Errorf("subscribed after Close: %+v, %v", ev, ok)
+	}
+	if _, ok := <-late; ok {
+		t.Error("channel of a late subscriber is open")
+	}
+}
+
+func TestSupervisorCloseWhileReconnecting(t *testing.T) {
+	before := runtime.NumGoroutine()
+	d := &scriptedDialer{}
+	s := NewSupervisorWithDialer(Config{Protocol: ProtocolV2, ReconnectWait: time.Minute}, d.dial)
+	events, _ := s.Subscribe()
+	waitFor(t, events, StateDisconnected)
+
+	// Команда ждет переподключения; Close будит ее, не дожидаясь паузы.
+	failed := make(chan error, 1)
+	go func() { failed <- s.Controller().ChordCtx(context.Background(), keys.MustParseChord("ctrl+a")) }()
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	s.Close()
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Errorf("Close during backoff took %s", elapsed)
+	}
+	select {
+	case err := <-failed:
+		if !errors.Is(err, ErrPortClosed) {
+			t.Errorf("waiting command: %v, want ErrPortClosed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiting command was not woken by Close")
+	}
+	if s.State() != StateClosed {
+		t.Errorf("state %s after Close", s.State())
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		buf := make([]byte, 1<<16)
+		t.Errorf("%d goroutines after Close, %d before:\n%s", n, before, buf[:runtime.Stack(buf, true)])
+	}
+}
@@ -0,0 +1,222 @@
+package trace
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"arduino-go-bot/arduinobot/wire"
+)
+
+// Entry — одна строка разбора записи: команда хоста, ответ платы, шум
+// на линии или событие соединения.
+type Entry struct {
+	At   time.Duration
+	Kind Kind
+	// IsCommand — строка относится к команде: это сама команда хоста или
+	// ответ, сопоставленный с ней. Только тогда значим Op — операция команды;
+	// у wire.OpSetDelayKey она равна 0.
+	IsCommand bool
+	Op        wire.Op
+	Text      string
+	// Latency — для ответа: время от отправки команды до ответа.
+	Latency time.Duration
+}
+
+func (e Entry) String() string {
+	dir := map[Kind]string{KindOpen: "==", KindWrite: "->", KindRead: "<-", KindClose: "=="}[e.Kind]
+	s := fmt.Sprintf("%10.3fs %s %s", e.At.Seconds(), dir, e.Text)
+	if e.Latency > 0 {
+		s += fmt.Sprintf(" (%.1fms)", float64(e.Latency)/float64(time.Millisecond))
+	}
+	return s
+}
+
+// sent — команда, ожидающая ответа.
+type sent struct {
+	at time.Duration
+	op wire.Op
+}
+
+// decoder повторяет разбор потока, который делает хост: до ответа на
+// согласование — протокол v1, после — кадры v2.
+type decoder struct {
+	out       []Entry
+	v2        bool
+	host      []byte
+	board     []byte
+	v1        []sent
+	bySeq     map[uint8]sent
+	negotiate time.Duration
+}
+
+// Decode разбирает записи в команды и ответы. Каждое подключение
+// (KindOpen) разбирается с начала, как у хоста.
+func Decode(records []Record) []Entry {
+	d := &decoder{}
+	d.reset()
+	for _, r := range records {
+		switch r.Kind {
+		case KindOpen:
+			d.reset()
+			d.add(Entry{At: r.At, Kind: r.Kind, Text: "open " + string(r.Data)})
+		case KindClose:
+			d.add(Entry{At: r.At, Kind: r.Kind, Text: "close: " + string(r.Data)})
+			d.reset()
+		case KindWrite:
+			d.write(r.At, r.Data)
+		case KindRead:
+			d.read(r.At, r.Data)
+		}
+	}
+	return d.out
+}
+
+func (d *decoder) reset() {
+	d.v2, d.host, d.board, d.v1 = false, nil, nil, nil
+	d.bySeq = make(map[uint8]sent)
+	d.negotiate = -1
+}
+
+func (d *decoder) add(e Entry) { d.out = append(d.out, e) }
+
+func (d *decoder) write(at time.Duration, p []byte) {
+	// Запрос согласования — всегда ASCII, и хост повторяет его целиком.
+	if string(p) == wire.Negotiate {
+		d.negotiate = at
+		d.add(Entry{At: at, Kind: KindWrite, Text: "negotiate v2"})
+		return
+	}
+	if !d.v2 {
+		cmd, err := wire.DecodeASCII(string(p))
+		if err != nil {
+			d.add(Entry{At: at, Kind: KindWrite, Text: fmt.Sprintf("unknown %q", p)})
+			return
+		}
+		d.v1 = append(d.v1, sent{at: at, op: cmd.Op})
+		d.add(Entry{At: at, Kind: KindWrite, IsCommand: true, Op: cmd.Op, Text: cmd.String()})
+		return
+	}
+	d.host = append(d.host, p...)
+	for len(d.host) > 0 {
+		f, n, err := wire.ParseFrame(d.host)
+		if err == wire.ErrIncomplete {
+			if n > 0 {
+				d.add(Entry{At: at, Kind: KindWrite, Text: fmt.Sprintf("unknown %q", d.host[:n])})
+			}
+			d.host = d.host[n:]
+			return
+		}
+		if err != nil {
+			d.add(Entry{At: at, Kind: KindWrite, Text: fmt.Sprintf("bad frame: %v", err)})
+			d.host = d.host[n:]
+			continue
+		}
+		text := fmt.Sprintf("#%d %s", f.Seq, f.Op)
+		if cmd, err := wire.DecodePayload(f); err == nil {
+			text = fmt.Sprintf("#%d %s", f.Seq, cmd)
+		}
+		d.bySeq[f.Seq] = sent{at: at, op: f.Op}
+		d.add(Entry{At: at, Kind: KindWrite, IsCommand: true, Op: f.Op, Text: text})
+		d.host = d.host[n:]
+	}
+}
+
+func (d *decoder) read(at time.Duration, p []byte) {
+	d.board = append(d.board, p...)
+	for len(d.board) > 0 {
+		if !d.v2 {
+			if !d.readToken(at) {
+				return
+			}
+			continue
+		}
+		f, n, err := wire.ParseFrame(d.board)
+		if n > 0 && err != nil || err == nil && n > frameLen(f) {
+			skip := n
+			if err == nil {
+				skip = n - frameLen(f)
+			}
+			d.noise(at, d.board[:skip])
+		}
+		if err == wire.ErrIncomplete {
+			d.board = d.board[n:]
+			return
+		}
+		d.board = d.board[n:]
+		if err != nil {
+			continue
+		}
+		d.reply(at, f)
+	}
+}
+
+// readToken ищет в начале буфера ответ v1 и сообщает, найден ли он.
+func (d *decoder) readToken(at time.Duration) bool {
+	pos, token := -1, ""
+	for _, t := range []string{wire.ReadyReply, wire.NegotiateReply} {
+		if i := bytes.Index(d.board, []byte(t)); i >= 0 && (pos < 0 || i < pos) {
+			pos, token = i, t
+		}
+	}
+	if pos < 0 {
+		// Хвост может оказаться началом ответа, который дочитается позже.
+		if keep := len(wire.ReadyReply) - 1; len(d.board) > keep {
+			d.noise(at, d.board[:len(d.board)-keep])
+			d.board = d.board[len(d.board)-keep:]
+		}
+		return false
+	}
+	if pos > 0 {
+		d.noise(at, d.board[:pos])
+	}
+	d.board = d.board[pos+len(token):]
+	e := Entry{At: at, Kind: KindRead, Text: token}
+	switch {
+	case token == wire.NegotiateReply:
+		d.v2 = true
+		if d.negotiate >= 0 {
+			e.Latency = at - d.negotiate
+		}
+	case len(d.v1) > 0:
+		e.IsCommand, e.Op, e.Latency = true, d.v1[0].op, at-d.v1[0].at
+		d.v1 = d.v1[1:]
+	default:
+		e.Text += " (unexpected)"
+	}
+	d.add(e)
+	return true
+}
+
+func (d *decoder) reply(at time.Duration, f wire.Frame) {
+	e := Entry{At: at, Kind: KindRead}
+	s, ok := d.bySeq[f.Seq]
+	if ok {
+		delete(d.bySeq, f.Seq)
+		e.IsCommand, e.Op, e.Latency = true, s.op, at-s.at
+	}
+	switch f.Op {
+	case wire.OpAck:
+		e.Text = fmt.Sprintf("#%d ack", f.Seq)
+		if s.op == wire.OpHello {
+			if h, err := wire.DecodeHello(f.Payload); err == nil {
+				e.Text += fmt.Sprintf(" firmware %q version %d, buffer %d bytes", h.Firmware, h.Version, h.BufferSize)
+			}
+		}
+	case wire.OpNack:
+		e.Text = fmt.Sprintf("#%d nack: %s", f.Seq, wire.NackReason(f))
+	default:
+		e.Text = fmt.Sprintf("#%d unexpected %s", f.Seq, f.Op)
+	}
+	if !ok {
+		e.Text += " (unexpected)"
+	}
+	d.add(e)
+}
+
+func (d *decoder) noise(at time.Duration, p []byte) {
+	d.add(Entry{At: at, Kind: KindRead, Text: fmt.Sprintf("noise %q", p)})
+}
+
+// frameLen — длина закодированного кадра f.
+func frameLen(f wire.Frame) int { return wire.Overhead + len(f.Payload) }
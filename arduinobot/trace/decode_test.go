@@ -0,0 +1,134 @@
+package trace
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"arduino-go-bot/arduinobot/wire"
+)
+
+const ms = time.Millisecond
+
+// want — ожидаемая строка разбора; Text сравнивается как подстрока.
+type want struct {
+	kind      Kind
+	isCommand bool
+	op        wire.Op
+	text      string
+	latency   time.Duration
+}
+
+func check(t *testing.T, got []Entry, wants []want) {
+	t.Helper()
+	if len(got) != len(wants) {
+		for _, e := range got {
+			t.Log(e)
+		}
+		t.Fatalf("%d entries, want %d", len(got), len(wants))
+	}
+	for i, w := range wants {
+		e := got[i]
+		if e.Kind != w.kind || e.IsCommand != w.isCommand || e.Op != w.op || e.Latency != w.latency || !strings.Contains(e.Text, w.text) {
+			t.Errorf("entry %d = %+v, want %+v", i, e, w)
+		}
+	}
+}
+
+func ascii(t *testing.T, cmd wire.Command) []byte {
+	t.Helper()
+	s, err := wire.EncodeASCII(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []byte(s)
+}
+
+func frame(t *testing.T, f wire.Frame) []byte {
+	t.Helper()
+	b, err := wire.AppendFrame(nil, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestDecodeV1(t *testing.T) {
+	records := []Record{
+		{0, KindOpen, []byte("COM5")},
+		{1 * ms, KindWrite, []byte(wire.Negotiate)},
+		{400 * ms, KindWrite, ascii(t, wire.Command{Op: wire.OpSetDelayKey, Arg: 30})},
+		// Ответ, разорванный между чтениями, — не шум.
+		{405 * ms, KindRead, []byte("read")},
+		{406 * ms, KindRead, []byte("y")},
+		{410 * ms, KindWrite, ascii(t, wire.Command{Op: wire.OpKey, Arg: 'a'})},
+		{415 * ms, KindRead, []byte("#rea")},
+		{416 * ms, KindRead, []byte("dyready")},
+		{420 * ms, KindClose, []byte("EOF")},
+	}
+	check(t, Decode(records), []want{
+		{KindOpen, false, 0, "open COM5", 0},
+		{KindWrite, false, 0, "negotiate v2", 0},
+		{KindWrite, true, wire.OpSetDelayKey, "", 0},
+		{KindRead, true, wire.OpSetDelayKey, "ready", 6 * ms},
+		{KindWrite, true, wire.OpKey, "", 0},
+		{KindRead, false, 0, `noise "#"`, 0},
+		{KindRead, true, wire.OpKey, "ready", 6 * ms},
+		{KindRead, false, 0, "ready (unexpected)", 0},
+		{KindClose, false, 0, "close: EOF", 0},
+	})
+}
+
+func TestDecodeV2(t *testing.T) {
+	hello, err := wire.EncodeHello(wire.Hello{Version: 2, BufferSize: 64, Firmware: "uno"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ack := frame(t, wire.Ack(1, hello))
+	records := []Record{
+		{0, KindOpen, []byte("/dev/ttyACM0")},
+		{1 * ms, KindWrite, []byte(wire.Negotiate)},
+		{3 * ms, KindRead, []byte("P2o")},
+		{4 * ms, KindRead, []byte("k")},
+		{5 * ms, KindWrite, frame(t, wire.Frame{Op: wire.OpHello, Seq: 1})},
+		{7 * ms, KindRead, append([]byte("zz"), ack[:3]...)},
+		{8 * ms, KindRead, ack[3:]},
+		// Две команды в полете: ответы приходят не по порядку.
+		{10 * ms, KindWrite, append(frame(t, wire.Frame{Op: wire.OpSetDelayKey, Seq: 2, Payload: []byte{30, 0, 0, 0}}),
+			frame(t, wire.Frame{Op: wire.OpKey, Seq: 3, Payload: []byte{'a', 0, 0, 0}})...)},
+		{12 * ms, KindRead, frame(t, wire.Ack(3, nil))},
+		{13 * ms, KindRead, frame(t, wire.Nack(2, wire.NackBusy))},
+		{14 * ms, KindRead, frame(t, wire.Ack(9, nil))},
+	}
+	check(t, Decode(records), []want{
+		{KindOpen, false, 0, "open", 0},
+		{KindWrite, false, 0, "negotiate v2", 0},
+		{KindRead, false, 0, wire.NegotiateReply, 3 * ms},
+		{KindWrite, true, wire.OpHello, "#1", 0},
+		{KindRead, false, 0, `noise "zz"`, 0},
+		{KindRead, true, wire.OpHello, `firmware "uno"`, 3 * ms},
+		{KindWrite, true, wire.OpSetDelayKey, "#2", 0},
+		{KindWrite, true, wire.OpKey, "#3", 0},
+		{KindRead, true, wire.OpKey, "#3 ack", 2 * ms},
+		{KindRead, true, wire.OpSetDelayKey, "#2 nack", 3 * ms},
+		{KindRead, false, 0, "#9 ack (unexpected)", 0},
+	})
+}
+
+func TestDecodeResetsOnOpen(t *testing.T) {
+	records := []Record{
+		{0, KindOpen, []byte("a")},
+		{1 * ms, KindWrite, []byte(wire.Negotiate)},
+		{2 * ms, KindRead, []byte(wire.NegotiateReply)},
+		// Плату переподключили: новая сессия снова начинается с v1.
+		{10 * ms, KindOpen, []byte("b")},
+		{11 * ms, KindWrite, ascii(t, wire.Command{Op: wire.OpKey, Arg: 'x'})},
+		{12 * ms, KindRead, []byte(wire.ReadyReply)},
+	}
+	got := Decode(records)
+	check(t, got[3:], []want{
+		{KindOpen, false, 0, "open b", 0},
+		{KindWrite, true, wire.OpKey, "", 0},
+		{KindRead, true, wire.OpKey, "ready", ms},
+	})
+}
@@ -0,0 +1,110 @@
+package trace
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"arduino-go-bot/arduinobot/emulator"
+)
+
+// replayWait — сколько ждать ответа эмулятора на команду, прежде чем
+// подать следующую, как это делает хост.
+const replayWait = 50 * time.Millisecond
+
+// Replay подает эмулятору emu записанные байты хоста в исходном темпе,
+// ускоренном в speed раз (speed <= 0 — без пауз), и возвращает новую
+// запись: те же KindOpen, KindWrite и KindClose, а вместо записанных
+// KindRead — ответы эмулятора. Разобрав ее через Decode, сессию можно
+// сравнить с исходной, а по emu.Commands — проверить, что получила плата.
+// Эмулятор закрывается в конце.
+func Replay(ctx context.Context, records []Record, emu *emulator.Emulator, speed float64) ([]Record, error) {
+	start := time.Now()
+	var (
+		mu  sync.Mutex
+		out []Record
+	)
+	add := func(kind Kind, p []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+		out = append(out, Record{At: time.Since(start), Kind: kind, Data: p})
+	}
+	done := make(chan struct{})
+	replied := make(chan struct{}, 1)
+	go func() {
+		defer close(done)
+		buf := make([]byte, 256)
+		for {
+			n, err := emu.Read(buf)
+			if err != nil {
+				return
+			}
+			add(KindRead, append([]byte(nil), buf[:n]...))
+			select {
+			case replied <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	var err error
+	for _, r := range records {
+		if speed > 0 {
+			if err = sleep(ctx, time.Duration(float64(r.At)/speed)-time.Since(start)); err != nil {
+				break
+			}
+		} else if err = ctx.Err(); err != nil {
+			break
+		}
+		switch r.Kind {
+		case KindOpen:
+			// Хост сбрасывает входной буфер при каждом подключении.
+			emu.ResetInputBuffer()
+			add(r.Kind, r.Data)
+		case KindWrite:
+			select {
+			case <-replied:
+			default:
+			}
+			add(r.Kind, r.Data)
+			emu.Write(r.Data)
+			// Ответ должен попасть в запись раньше следующей команды.
+			err = wait(ctx, replied)
+		case KindClose:
+			add(r.Kind, r.Data)
+		}
+		if err != nil {
+			break
+		}
+	}
+	emu.Close()
+	<-done
+	return out, err
+}
+
+// wait ждет ответа не дольше replayWait; команда без ответа — не ошибка.
+func wait(ctx context.Context, replied <-chan struct{}) error {
+	t := time.NewTimer(replayWait)
+	defer t.Stop()
+	select {
+	case <-replied:
+	case <-t.C:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,120 @@
+package trace_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"reflect"
+	"testing"
+
+	"arduino-go-bot/arduinobot"
+	"arduino-go-bot/arduinobot/emulator"
+	"arduino-go-bot/arduinobot/trace"
+	"arduino-go-bot/arduinobot/wire"
+)
+
+// record (неэкспортируемая) проводит сессию контроллера с эмулятором под
+// записью и возвращает записи, прочитанные обратно из файла.
+func record(t *testing.T, config emulator.Config, session func(c *arduinobot.Controller)) ([]trace.Record, *emulator.Emulator) {
+	t.Helper()
+	var file bytes.Buffer
+	rec, err := trace.NewRecorder(&file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	emu := emulator.NewWithConfig(config)
+	c, err := arduinobot.NewControllerWithTransport(arduinobot.Config{Trace: rec}, emu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session(c)
+	c.Close()
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := trace.NewReader(&file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []trace.Record
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			return records, emu
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, rec)
+	}
+}
+
+// commands (неэкспортируемая) возвращает операции команд и число ответов на них.
+func commands(entries []trace.Entry) (ops []wire.Op, replies int) {
+	for _, e := range entries {
+		switch {
+		case !e.IsCommand:
+		case e.Kind == trace.KindWrite:
+			ops = append(ops, e.Op)
+		case e.Kind == trace.KindRead:
+			replies++
+		}
+	}
+	return ops, replies
+}
+
+func TestReplay(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		config emulator.Config
+	}{
+		{"v1", emulator.Config{Legacy: true}},
+		{"v2", emulator.Config{}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			records, original := record(t, tt.config, func(c *arduinobot.Controller) {
+				for _, err := range []error{
+					c.SetDelayKey(30),
+					c.Key('a'),
+					c.Text("hi"),
+					c.MouseClick(1),
+					c.MouseWheel(-2),
+				} {
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+			})
+			ops, replies := commands(trace.Decode(records))
+			// SetDelayKey — операция 0; она не должна потеряться при разборе.
+			if len(ops) == 0 || replies != len(ops) {
+				t.Fatalf("recorded %d commands %v with %d replies", len(ops), ops, replies)
+			}
+			if !contains(ops, wire.OpSetDelayKey) {
+				t.Errorf("recorded commands %v lack SetDelayKey", ops)
+			}
+
+			emu := emulator.NewWithConfig(tt.config)
+			replayed, err := trace.Replay(context.Background(), records, emu, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotOps, gotReplies := commands(trace.Decode(replayed))
+			if !reflect.DeepEqual(gotOps, ops) || gotReplies != replies {
+				t.Errorf("replayed %v with %d replies, recorded %v with %d", gotOps, gotReplies, ops, replies)
+			}
+			if got, want := emu.Commands(), original.Commands(); !reflect.DeepEqual(got, want) {
+				t.Errorf("replay executed %v, the session executed %v", got, want)
+			}
+		})
+	}
+}
+
+func contains(ops []wire.Op, op wire.Op) bool {
+	for _, o := range ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,222 @@
+// Package trace записывает обмен хоста с платой в компактный файл: каждый
+// записанный и прочитанный кусок байт с направлением и временем от начала
+// записи по монотонным часам. Записи можно разобрать обратно в команды и
+// ответы с задержками (Decode) и проиграть на эмуляторе (Replay).
+//
+// Формат файла: заголовок "ABTRACE1" и время начала (int64, наносекунды
+// Unix, LE), затем записи: вид (1 байт), приращение времени от предыдущей
+// записи в наносекундах (uvarint), длина данных (uvarint) и сами данные.
+// Запись сбрасывается на диск сразу, поэтому файл остается читаемым, даже
+// если программа упала; оборванная последняя запись пропускается.
+package trace
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const magic = "ABTRACE1"
+
+// maxRecord — предел длины данных одной записи при чтении; защищает от
+// поврежденного файла.
+const maxRecord = 1 << 20
+
+// Kind — вид записи.
+type Kind byte
+
+const (
+	// KindOpen — хост подключился; Data — имя порта.
+	KindOpen Kind = iota + 1
+	// KindWrite — байты от хоста к плате.
+	KindWrite
+	// KindRead — байты от платы к хосту.
+	KindRead
+	// KindClose — соединение закрыто; Data — причина.
+	KindClose
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindOpen:
+		return "open"
+	case KindWrite:
+		return "write"
+	case KindRead:
+		return "read"
+	case KindClose:
+		return "close"
+	}
+	return fmt.Sprintf("kind(%d)", byte(k))
+}
+
+// Record — одна запись.
+type Record struct {
+	At   time.Duration // от начала записи
+	Kind Kind
+	Data []byte
+}
+
+// Recorder пишет записи. Методы безопасны для одновременного вызова.
+// Ошибка записи запоминается и выключает Recorder, чтобы сбой диска не
+// мешал работе с платой; ее возвращают Err и Close.
+type Recorder struct {
+	mu    sync.Mutex
+	w     *bufio.Writer
+	c     io.Closer
+	start time.Time
+	last  time.Duration
+	err   error
+}
+
+// NewRecorder начинает запись в w. Если w — io.Closer, Close закрывает его.
+func NewRecorder(w io.Writer) (*Recorder, error) {
+	r := &Recorder{w: bufio.NewWriter(w), start: time.Now()}
+	if c, ok := w.(io.Closer); ok {
+		r.c = c
+	}
+	r.w.WriteString(magic)
+	binary.Write(r.w, binary.LittleEndian, r.start.UnixNano())
+	if err := r.w.Flush(); err != nil {
+		return nil, fmt.Errorf("trace: %w", err)
+	}
+	return r, nil
+}
+
+// Create создает файл path и начинает запись в него.
+func Create(path string) (*Recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("trace: %w", err)
+	}
+	r, err := NewRecorder(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Record добавляет запись вида kind с копией p.
+func (r *Recorder) Record(kind Kind, p []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil || r.w == nil {
+		return
+	}
+	at := time.Since(r.start)
+	// Монотонные часы не идут назад, но записи из разных горутин могут
+	// прийти под мьютекс не по порядку времени.
+	at = max(at, r.last)
+	var hdr [1 + 2*binary.MaxVarintLen64]byte
+	hdr[0] = byte(kind)
+	n := 1 + binary.PutUvarint(hdr[1:], uint64(at-r.last))
+	n += binary.PutUvarint(hdr[n:], uint64(len(p)))
+	r.last = at
+	r.w.Write(hdr[:n])
+	r.w.Write(p)
+	if err := r.w.Flush(); err != nil {
+		r.err = fmt.Errorf("trace: %w", err)
+	}
+}
+
+// Err возвращает первую ошибку записи.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Close заканчивает запись.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.w == nil {
+		return r.err
+	}
+	r.w = nil
+	if r.c != nil {
+		if err := r.c.Close(); err != nil && r.err == nil {
+			r.err = fmt.Errorf("trace: %w", err)
+		}
+	}
+	return r.err
+}
+
+// Reader читает записи.
+type Reader struct {
+	r     *bufio.Reader
+	start time.Time
+	at    time.Duration
+}
+
+// ErrFormat — данные не похожи на запись обмена.
+var ErrFormat = errors.New("trace: not a capture file")
+
+// NewReader читает заголовок записи из r.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	var hdr [len(magic) + 8]byte
+	if _, err := io.ReadFull(br, hdr[:]); err != nil || string(hdr[:len(magic)]) != magic {
+		return nil, ErrFormat
+	}
+	start := time.Unix(0, int64(binary.LittleEndian.Uint64(hdr[len(magic):])))
+	return &Reader{r: br, start: start}, nil
+}
+
+// Start возвращает время начала записи по часам записывавшей машины.
+func (r *Reader) Start() time.Time { return r.start }
+
+// Next возвращает следующую запись или io.EOF в конце. Оборванная
+// последняя запись тоже дает io.EOF.
+func (r *Reader) Next() (Record, error) {
+	kind, err := r.r.ReadByte()
+	if err != nil {
+		return Record{}, io.EOF
+	}
+	delta, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return Record{}, io.EOF
+	}
+	size, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return Record{}, io.EOF
+	}
+	if size > maxRecord {
+		return Record{}, fmt.Errorf("%w: record of %d bytes", ErrFormat, size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		return Record{}, io.EOF
+	}
+	r.at += time.Duration(delta)
+	return Record{At: r.at, Kind: Kind(kind), Data: data}, nil
+}
+
+// ReadFile читает все записи из файла path.
+func ReadFile(path string) (start time.Time, records []Record, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, nil, err
+	}
+	defer f.Close()
+	r, err := NewReader(f)
+	if err != nil {
+		return time.Time{}, nil, err
+	}
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			return r.Start(), records, nil
+		}
+		if err != nil {
+			return r.Start(), records, err
+		}
+		records = append(records, rec)
+	}
+}
@@ -0,0 +1,46 @@
+package arduinobot
+
+import (
+	"sync/atomic"
+
+	"arduino-go-bot/arduinobot/trace"
+)
+
+// tracedTransport пишет в Config.Trace все байты, прошедшие через порт.
+// Закрытие записывается один раз — с первой причиной: ошибкой чтения или
+// закрытием со стороны хоста.
+type tracedTransport struct {
+	Transport
+	rec    *trace.Recorder
+	closed atomic.Bool
+}
+
+func (t *tracedTransport) Write(p []byte) (int, error) {
+	n, err := t.Transport.Write(p)
+	if n > 0 {
+		t.rec.Record(trace.KindWrite, p[:n])
+	}
+	return n, err
+}
+
+func (t *tracedTransport) Read(p []byte) (int, error) {
+	n, err := t.Transport.Read(p)
+	if n > 0 {
+		t.rec.Record(trace.KindRead, p[:n])
+	}
+	if err != nil {
+		t.closing(err.Error())
+	}
+	return n, err
+}
+
+func (t *tracedTransport) Close() error {
+	t.closing("closed by host")
+	return t.Transport.Close()
+}
+
+func (t *tracedTransport) closing(reason string) {
+	if !t.closed.Swap(true) {
+		t.rec.Record(trace.KindClose, []byte(reason))
+	}
+}
@@ -0,0 +1,319 @@
+// Package wire описывает команды прошивки и их кодирование в обеих версиях
+// протокола: исходном ASCII (v1) и кадровом двоичном (v2).
+// Пакет не зависит от платформы и не выполняет ввода-вывода.
+package wire
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+)
+
+// Op — код операции.
+type Op byte
+
+const (
+	OpSetDelayKey         Op = 0x00
+	OpSetDelayMouse       Op = 0x01
+	OpSetDelayMouseMove   Op = 0x02
+	OpSetOffsetMouseMove  Op = 0x03
+	OpSetRandomDelayKey   Op = 0x04
+	OpSetRandomDelayMouse Op = 0x05
+	OpKey                 Op = 0x11
+	OpText                Op = 0x12
+	OpKeyDown             Op = 0x13
+	OpKeyUp               Op = 0x14
+	OpMouseMove           Op = 0x15
+	OpMouseClick          Op = 0x16
+	OpMouseDown           Op = 0x17
+	OpMouseUp             Op = 0x18
+	OpMouseWheel          Op = 0x19
+	OpMouseMoveAbs        Op = 0x1A // только v2
+	OpMouseSteps          Op = 0x1B // только v2
+
+	// Служебные команды протокола v2. OpPing ничего не делает на плате:
+	// прошивка возвращает в Ack тот же payload — nonce (uint32 LE).
+	OpHello Op = 0x20
+	OpPing  Op = 0x21
+
+	// Ответы прошивки в протоколе v2.
+	OpAck  Op = 0xF0
+	OpNack Op = 0xF1
+)
+
+var opNames = map[Op]string{
+	OpSetDelayKey:         "SetDelayKey",
+	OpSetDelayMouse:       "SetDelayMouse",
+	OpSetDelayMouseMove:   "SetDelayMouseMove",
+	OpSetOffsetMouseMove:  "SetOffsetMouseMove",
+	OpSetRandomDelayKey:   "SetRandomDelayKey",
+	OpSetRandomDelayMouse: "SetRandomDelayMouse",
+	OpKey:                 "Key",
+	OpText:                "Text",
+	OpKeyDown:             "KeyDown",
+	OpKeyUp:               "KeyUp",
+	OpMouseMove:           "MouseMove",
+	OpMouseClick:          "MouseClick",
+	OpMouseDown:           "MouseDown",
+	OpMouseUp:             "MouseUp",
+	OpMouseWheel:          "MouseWheel",
+	OpMouseMoveAbs:        "MouseMoveAbs",
+	OpMouseSteps:          "MouseSteps",
+	OpHello:               "Hello",
+	OpPing:                "Ping",
+	OpAck:                 "Ack",
+	OpNack:                "Nack",
+}
+
+func (op Op) String() string {
+	if name, ok := opNames[op]; ok {
+		return name
+	}
+	return fmt.Sprintf("Op(0x%02X)", byte(op))
+}
+
+// asciiPrefix — префиксы команд протокола v1.
+var asciiPrefix = map[Op]string{
+	OpSetDelayKey:         "00",
+	OpSetDelayMouse:       "01",
+	OpSetDelayMouseMove:   "02",
+	OpSetOffsetMouseMove:  "03",
+	OpSetRandomDelayKey:   "04",
+	OpSetRandomDelayMouse: "05",
+	OpKey:                 "1",
+	OpText:                "2",
+	OpKeyDown:             "3",
+	OpKeyUp:               "4",
+	OpMouseMove:           "5",
+	OpMouseClick:          "6",
+	OpMouseDown:           "7",
+	OpMouseUp:             "8",
+	OpMouseWheel:          "9",
+}
+
+// LegacyOps — команды, которые понимает любая прошивка v1.
+var LegacyOps = []Op{
+	OpSetDelayKey, OpSetDelayMouse, OpSetDelayMouseMove, OpSetOffsetMouseMove,
+	OpSetRandomDelayKey, OpSetRandomDelayMouse,
+	OpKey, OpText, OpKeyDown, OpKeyUp, OpMouseMove, OpMouseClick, OpMouseDown, OpMouseUp, OpMouseWheel,
+}
+
+// asciiOps — обратная таблица asciiPrefix.
+var asciiOps = func() map[string]Op {
+	m := make(map[string]Op, len(asciiPrefix))
+	for op, p := range asciiPrefix {
+		m[p] = op
+	}
+	return m
+}()
+
+// ReadyReply — ответ прошивки v1 на любую выполненную команду.
+const ReadyReply = "ready"
+
+// legacyMoveBase — основание, которым v1 упаковывает смещение мыши в одно число.
+const legacyMoveBase = 65535
+
+// Command — одна команда прошивки.
+// Arg заполняется для всех команд, кроме перечисленных ниже;
+// DX/DY — для OpMouseMove, X/Y (0..AbsMax) — для OpMouseMoveAbs,
+// Steps — для OpMouseSteps, Text — для OpText.
+type Command struct {
+	Op     Op
+	Arg    int
+	DX, DY int
+	X, Y   int
+	Steps  []Step
+	Text   string
+}
+
+func (c Command) String() string {
+	switch c.Op {
+	case OpText:
+		return fmt.Sprintf("%s %q", c.Op, c.Text)
+	case OpMouseMove:
+		return fmt.Sprintf("%s %+d,%+d", c.Op, c.DX, c.DY)
+	case OpMouseMoveAbs:
+		return fmt.Sprintf("%s %d,%d", c.Op, c.X, c.Y)
+	case OpMouseSteps:
+		var dx, dy int
+		for _, s := range c.Steps {
+			dx, dy = dx+int(s.DX), dy+int(s.DY)
+		}
+		return fmt.Sprintf("%s %+d,%+d in %d", c.Op, dx, dy, len(c.Steps))
+	case OpHello:
+		return c.Op.String()
+	default:
+		return fmt.Sprintf("%s %d", c.Op, c.Arg)
+	}
+}
+
+// EncodeASCII кодирует команду в формат протокола v1.
+func EncodeASCII(c Command) (string, error) {
+	prefix, ok := asciiPrefix[c.Op]
+	if !ok {
+		return "", fmt.Errorf("%s has no v1 encoding", c.Op)
+	}
+	switch c.Op {
+	case OpText:
+		return prefix + c.Text, nil
+	case OpMouseMove:
+		dx, dy := abs(c.DX), abs(c.DY)
+		if dy >= legacyMoveBase || dx >= legacyMoveBase {
+			return "", fmt.Errorf("mouse move %+d,%+d does not fit v1 encoding", c.DX, c.DY)
+		}
+		znakX, znakY := "+", "+"
+		if c.DX < 0 {
+			znakX = "-"
+		}
+		if c.DY < 0 {
+			znakY = "-"
+		}
+		return fmt.Sprintf("%s%s%s%d", prefix, znakX, znakY, dx*legacyMoveBase+dy), nil
+	}
+	return prefix + strconv.Itoa(c.Arg), nil
+}
+
+// DecodeASCII разбирает одну команду протокола v1.
+func DecodeASCII(s string) (Command, error) {
+	if len(s) < 2 {
+		return Command{}, fmt.Errorf("command %q is too short", s)
+	}
+	prefixLen := 1
+	if s[0] == '0' {
+		prefixLen = 2
+	}
+	op, ok := asciiOps[s[:prefixLen]]
+	if !ok {
+		return Command{}, fmt.Errorf("unknown command %q", s)
+	}
+	cmd := Command{Op: op}
+	rest := s[prefixLen:]
+
+	switch op {
+	case OpText:
+		cmd.Text = rest
+		return cmd, nil
+	case OpMouseMove:
+		if len(rest) < 3 || !isSign(rest[0]) || !isSign(rest[1]) {
+			return Command{}, fmt.Errorf("bad mouse move %q", s)
+		}
+		coord, err := strconv.Atoi(rest[2:])
+		if err != nil || coord < 0 {
+			return Command{}, fmt.Errorf("bad mouse move %q", s)
+		}
+		cmd.DX, cmd.DY = coord/legacyMoveBase, coord%legacyMoveBase
+		if rest[0] == '-' {
+			cmd.DX = -cmd.DX
+		}
+		if rest[1] == '-' {
+			cmd.DY = -cmd.DY
+		}
+		return cmd, nil
+	}
+
+	arg, err := strconv.Atoi(rest)
+	if err != nil {
+		return Command{}, fmt.Errorf("bad argument in %q: %w", s, err)
+	}
+	cmd.Arg = arg
+	return cmd, nil
+}
+
+// EncodePayload кодирует аргументы команды для кадра v2.
+// Числа передаются как int32 little-endian, текст — как есть.
+func EncodePayload(c Command) ([]byte, error) {
+	switch c.Op {
+	case OpText:
+		if len(c.Text) > MaxPayload {
+			return nil, fmt.Errorf("text of %d bytes exceeds frame payload", len(c.Text))
+		}
+		return []byte(c.Text), nil
+	case OpMouseMove:
+		b := make([]byte, 8)
+		binary.LittleEndian.PutUint32(b, uint32(int32(c.DX)))
+		binary.LittleEndian.PutUint32(b[4:], uint32(int32(c.DY)))
+		return b, nil
+	case OpMouseMoveAbs:
+		if c.X < 0 || c.X > AbsMax || c.Y < 0 || c.Y > AbsMax {
+			return nil, fmt.Errorf("absolute position %d,%d is out of 0..%d", c.X, c.Y, AbsMax)
+		}
+		b := make([]byte, 4)
+		binary.LittleEndian.PutUint16(b, uint16(c.X))
+		binary.LittleEndian.PutUint16(b[2:], uint16(c.Y))
+		return b, nil
+	case OpMouseSteps:
+		if 2*len(c.Steps) > MaxPayload {
+			return nil, fmt.Errorf("%d mouse steps exceed frame payload", len(c.Steps))
+		}
+		b := make([]byte, 0, 2*len(c.Steps))
+		for _, s := range c.Steps {
+			b = append(b, byte(s.DX), byte(s.DY))
+		}
+		return b, nil
+	case OpHello:
+		return nil, nil
+	}
+	if _, ok := opNames[c.Op]; !ok {
+		return nil, fmt.Errorf("unknown op %s", c.Op)
+	}
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, uint32(int32(c.Arg)))
+	return b, nil
+}
+
+// DecodePayload восстанавливает команду из кадра v2.
+func DecodePayload(f Frame) (Command, error) {
+	cmd := Command{Op: f.Op}
+	switch f.Op {
+	case OpText:
+		cmd.Text = string(f.Payload)
+		return cmd, nil
+	case OpMouseMove:
+		if len(f.Payload) != 8 {
+			return Command{}, fmt.Errorf("%s: bad payload length %d", f.Op, len(f.Payload))
+		}
+		cmd.DX = int(int32(binary.LittleEndian.Uint32(f.Payload)))
+		cmd.DY = int(int32(binary.LittleEndian.Uint32(f.Payload[4:])))
+		return cmd, nil
+	case OpMouseMoveAbs:
+		if len(f.Payload) != 4 {
+			return Command{}, fmt.Errorf("%s: bad payload length %d", f.Op, len(f.Payload))
+		}
+		cmd.X = int(binary.LittleEndian.Uint16(f.Payload))
+		cmd.Y = int(binary.LittleEndian.Uint16(f.Payload[2:]))
+		if cmd.X > AbsMax || cmd.Y > AbsMax {
+			return Command{}, fmt.Errorf("%s: position %d,%d is out of 0..%d", f.Op, cmd.X, cmd.Y, AbsMax)
+		}
+		return cmd, nil
+	case OpMouseSteps:
+		if len(f.Payload)%2 != 0 {
+			return Command{}, fmt.Errorf("%s: bad payload length %d", f.Op, len(f.Payload))
+		}
+		cmd.Steps = make([]Step, len(f.Payload)/2)
+		for i := range cmd.Steps {
+			cmd.Steps[i] = Step{DX: int8(f.Payload[2*i]), DY: int8(f.Payload[2*i+1])}
+		}
+		return cmd, nil
+	case OpHello:
+		return cmd, nil
+	case OpAck, OpNack:
+		return Command{}, fmt.Errorf("%s is a reply, not a command", f.Op)
+	}
+	if _, ok := opNames[f.Op]; !ok {
+		return Command{}, fmt.Errorf("unknown op %s", f.Op)
+	}
+	if len(f.Payload) != 4 {
+		return Command{}, fmt.Errorf("%s: bad payload length %d", f.Op, len(f.Payload))
+	}
+	cmd.Arg = int(int32(binary.LittleEndian.Uint32(f.Payload)))
+	return cmd, nil
+}
+
+func isSign(b byte) bool { return b == '+' || b == '-' }
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,95 @@
+package wire
+
+import (
+	"reflect"
+	"testing"
+)
+
+// commands — по команде на каждую операцию прошивки.
+var commands = []Command{
+	{Op: OpSetDelayKey, Arg: 30},
+	{Op: OpSetDelayMouse, Arg: 0},
+	{Op: OpSetDelayMouseMove, Arg: 5},
+	{Op: OpSetOffsetMouseMove, Arg: -3},
+	{Op: OpSetRandomDelayKey, Arg: 15},
+	{Op: OpSetRandomDelayMouse, Arg: 1 << 20},
+	{Op: OpKey, Arg: 0xC2},
+	{Op: OpText, Text: "hello, мир"},
+	{Op: OpKeyDown, Arg: 0x80},
+	{Op: OpKeyUp, Arg: 0x80},
+	{Op: OpMouseMove, DX: -1200, DY: 35},
+	{Op: OpMouseClick, Arg: 1},
+	{Op: OpMouseDown, Arg: 2},
+	{Op: OpMouseUp, Arg: 2},
+	{Op: OpMouseWheel, Arg: -3},
+	{Op: OpMouseMoveAbs, X: 0, Y: AbsMax},
+	{Op: OpMouseSteps, Steps: []Step{{DX: 127, DY: -128}, {DX: 0, DY: 1}}},
+	{Op: OpHello},
+	{Op: OpPing, Arg: -559038737},
+}
+
+func TestPayloadRoundTrip(t *testing.T) {
+	seen := make(map[Op]bool)
+	for i, cmd := range commands {
+		seen[cmd.Op] = true
+		payload, err := EncodePayload(cmd)
+		if err != nil {
+			t.Fatalf("EncodePayload(%s): %v", cmd, err)
+		}
+		buf := mustFrame(t, Frame{Op: cmd.Op, Seq: uint8(i), Payload: payload})
+		f, n, err := ParseFrame(buf)
+		if err != nil || n != len(buf) {
+			t.Fatalf("ParseFrame(%s) = n %d, %v", cmd, n, err)
+		}
+		got, err := DecodePayload(f)
+		if err != nil {
+			t.Fatalf("DecodePayload(%s): %v", cmd, err)
+		}
+		if !reflect.DeepEqual(got, cmd) {
+			t.Errorf("round trip of %s = %+v", cmd, got)
+		}
+	}
+	for op := range opNames {
+		if op != OpAck && op != OpNack && !seen[op] {
+			t.Errorf("no round-trip case for %s", op)
+		}
+	}
+}
+
+func TestASCIIRoundTrip(t *testing.T) {
+	for _, cmd := range commands {
+		if _, ok := asciiPrefix[cmd.Op]; !ok {
+			if _, err := EncodeASCII(cmd); err == nil {
+				t.Errorf("EncodeASCII(%s) succeeded for a v2-only op", cmd)
+			}
+			continue
+		}
+		s, err := EncodeASCII(cmd)
+		if err != nil {
+			t.Fatalf("EncodeASCII(%s): %v", cmd, err)
+		}
+		got, err := DecodeASCII(s)
+		if err != nil {
+			t.Fatalf("DecodeASCII(%q): %v", s, err)
+		}
+		if !reflect.DeepEqual(got, cmd) {
+			t.Errorf("round trip of %s via %q = %+v", cmd, s, got)
+		}
+	}
+}
+
+func TestDecodePayloadErrors(t *testing.T) {
+	tests := []Frame{
+		{Op: OpKey, Payload: []byte{1, 2}},
+		{Op: OpMouseMove, Payload: make([]byte, 7)},
+		{Op: OpMouseMoveAbs, Payload: []byte{0xFF, 0xFF, 0, 0}},
+		{Op: OpMouseSteps, Payload: []byte{1}},
+		{Op: OpAck},
+		{Op: Op(0x7E), Payload: make([]byte, 4)},
+	}
+	for _, f := range tests {
+		if cmd, err := DecodePayload(f); err == nil {
+			t.Errorf("DecodePayload(%s % x) = %+v, want error", f.Op, f.Payload, cmd)
+		}
+	}
+}
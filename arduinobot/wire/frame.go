@@ -0,0 +1,157 @@
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Кадр протокола v2:
+//
+//	0xA5 | len | op | seq | payload... | crc16 (LE)
+//
+// len — число байт op+seq+payload, crc16 (CCITT, начальное значение 0xFFFF)
+// считается по len, op, seq и payload. Ответ прошивки — кадр OpAck или OpNack
+// с тем же seq, что у команды; в Nack первый байт payload — NackCode.
+const (
+	Sync       = 0xA5
+	headerLen  = 2 // sync + len
+	trailerLen = 2 // crc16
+	MaxPayload = 250
+	MaxFrame   = headerLen + 2 + MaxPayload + trailerLen
+	// Overhead — байты кадра сверх payload.
+	Overhead = MaxFrame - MaxPayload
+)
+
+// Negotiate — ASCII-запрос перехода на протокол v2, NegotiateReply — ответ
+// прошивки, которая его поддерживает. Старые прошивки запрос игнорируют.
+const (
+	Negotiate      = "P2"
+	NegotiateReply = "P2ok"
+)
+
+var (
+	// ErrIncomplete — в буфере нет целого кадра, нужно дочитать данные.
+	ErrIncomplete = errors.New("incomplete frame")
+	// ErrChecksum — контрольная сумма кадра не совпала.
+	ErrChecksum = errors.New("frame checksum mismatch")
+	// ErrLength — поле длины кадра вне допустимых границ.
+	ErrLength = errors.New("bad frame length")
+)
+
+// NackCode — причина отказа прошивки выполнить команду.
+type NackCode byte
+
+const (
+	NackChecksum  NackCode = 1
+	NackUnknownOp NackCode = 2
+	NackBadArgs   NackCode = 3
+	NackBusy      NackCode = 4
+)
+
+func (c NackCode) String() string {
+	switch c {
+	case NackChecksum:
+		return "checksum mismatch"
+	case NackUnknownOp:
+		return "unknown opcode"
+	case NackBadArgs:
+		return "bad arguments"
+	case NackBusy:
+		return "device busy"
+	}
+	return fmt.Sprintf("nack code %d", byte(c))
+}
+
+// Frame — один кадр протокола v2.
+type Frame struct {
+	Op      Op
+	Seq     uint8
+	Payload []byte
+}
+
+// AppendFrame дописывает закодированный кадр в dst.
+func AppendFrame(dst []byte, f Frame) ([]byte, error) {
+	if len(f.Payload) > MaxPayload {
+		return dst, fmt.Errorf("payload of %d bytes exceeds %d", len(f.Payload), MaxPayload)
+	}
+	start := len(dst)
+	dst = append(dst, Sync, byte(2+len(f.Payload)), byte(f.Op), f.Seq)
+	dst = append(dst, f.Payload...)
+	crc := crc16(dst[start+1:])
+	return binary.LittleEndian.AppendUint16(dst, crc), nil
+}
+
+// ParseFrame ищет в buf первый кадр. n — число байт, которые вызывающий
+// должен отбросить из начала buf, независимо от ошибки:
+//   - err == nil: f — корректный кадр;
+//   - ErrIncomplete: кадр еще не пришел целиком, n покрывает мусор перед Sync;
+//     если же дальше в buf уже лежит целый корректный кадр, ложный Sync
+//     пропускается и возвращается этот кадр;
+//   - ErrChecksum, ErrLength: поврежденный кадр, n сдвигает за байт Sync,
+//     чтобы синхронизироваться заново. При ErrChecksum f.Op и f.Seq заполнены
+//     как есть, чтобы на кадр можно было ответить Nack.
+//
+// Payload ссылается на buf и действителен до его изменения.
+func ParseFrame(buf []byte) (f Frame, n int, err error) {
+	for n < len(buf) && buf[n] != Sync {
+		n++
+	}
+	rest := buf[n:]
+	if len(rest) < headerLen {
+		return Frame{}, n, ErrIncomplete
+	}
+	size := int(rest[1])
+	if size < 2 || size > 2+MaxPayload {
+		return Frame{}, n + 1, ErrLength
+	}
+	total := headerLen + size + trailerLen
+	if len(rest) < total {
+		// Шум с байтом Sync может выглядеть как начало длинного кадра
+		// и задержать настоящий кадр, пришедший следом.
+		if f, m, err := ParseFrame(rest[1:]); err == nil {
+			return f, n + 1 + m, nil
+		}
+		return Frame{}, n, ErrIncomplete
+	}
+	f = Frame{Op: Op(rest[2]), Seq: rest[3], Payload: rest[4 : headerLen+size]}
+	want := binary.LittleEndian.Uint16(rest[headerLen+size:])
+	if crc16(rest[1:headerLen+size]) != want {
+		f.Payload = nil
+		return f, n + 1, ErrChecksum
+	}
+	return f, n + total, nil
+}
+
+// Ack и Nack строят кадры-ответы прошивки.
+func Ack(seq uint8, payload []byte) Frame {
+	return Frame{Op: OpAck, Seq: seq, Payload: payload}
+}
+
+func Nack(seq uint8, code NackCode) Frame {
+	return Frame{Op: OpNack, Seq: seq, Payload: []byte{byte(code)}}
+}
+
+// NackReason извлекает код отказа из кадра OpNack.
+func NackReason(f Frame) NackCode {
+	if len(f.Payload) == 0 {
+		return 0
+	}
+	return NackCode(f.Payload[0])
+}
+
+// crc16 — CRC-16/CCITT-FALSE.
+func crc16(b []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, v := range b {
+		crc ^= uint16(v) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,96 @@
+package wire
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func mustFrame(t testing.TB, f Frame) []byte {
+	t.Helper()
+	b, err := AppendFrame(nil, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestParseFrame(t *testing.T) {
+	good := mustFrame(t, Frame{Op: OpKey, Seq: 7, Payload: []byte{1, 2, 3, 4}})
+	corrupt := append([]byte(nil), good...)
+	corrupt[4] ^= 0xFF
+
+	tests := []struct {
+		name    string
+		buf     []byte
+		want    Frame
+		n       int
+		wantErr error
+	}{
+		{"frame", good, Frame{Op: OpKey, Seq: 7, Payload: []byte{1, 2, 3, 4}}, len(good), nil},
+		{"noise before frame", append([]byte("xyz"), good...), Frame{Op: OpKey, Seq: 7, Payload: []byte{1, 2, 3, 4}}, 3 + len(good), nil},
+		{"empty", nil, Frame{}, 0, ErrIncomplete},
+		{"noise only", []byte("ready"), Frame{}, 5, ErrIncomplete},
+		{"checksum", corrupt, Frame{Op: OpKey, Seq: 7}, 1, ErrChecksum},
+		{"length too short", []byte{Sync, 1, 0, 0, 0, 0}, Frame{}, 1, ErrLength},
+		{"length too long", []byte{Sync, 2 + MaxPayload + 1}, Frame{}, 1, ErrLength},
+		// Ложный Sync в шуме не должен задерживать кадр, пришедший следом.
+		{"false sync", append([]byte{Sync, 200}, good...), Frame{Op: OpKey, Seq: 7, Payload: []byte{1, 2, 3, 4}}, 2 + len(good), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, n, err := ParseFrame(tt.buf)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if n != tt.n {
+				t.Errorf("n = %d, want %d", n, tt.n)
+			}
+			if f.Op != tt.want.Op || f.Seq != tt.want.Seq || !bytes.Equal(f.Payload, tt.want.Payload) {
+				t.Errorf("frame = %+v, want %+v", f, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFrameTruncated(t *testing.T) {
+	good := mustFrame(t, Frame{Op: OpText, Seq: 1, Payload: []byte("hello")})
+	for i := 0; i < len(good); i++ {
+		_, n, err := ParseFrame(good[:i])
+		if !errors.Is(err, ErrIncomplete) || n != 0 {
+			t.Errorf("ParseFrame(first %d bytes) = n %d, err %v; want n 0, ErrIncomplete", i, n, err)
+		}
+	}
+}
+
+func TestAppendFrameTooLong(t *testing.T) {
+	if _, err := AppendFrame(nil, Frame{Op: OpText, Payload: make([]byte, MaxPayload+1)}); err == nil {
+		t.Fatal("AppendFrame accepted an oversized payload")
+	}
+}
+
+func FuzzParseFrame(f *testing.F) {
+	f.Add(mustFrame(f, Frame{Op: OpKey, Seq: 1, Payload: []byte{0x41, 0, 0, 0}}))
+	f.Add(mustFrame(f, Frame{Op: OpAck, Seq: 255}))
+	f.Add(append([]byte("ready"), mustFrame(f, Frame{Op: OpNack, Seq: 3, Payload: []byte{2}})...))
+	f.Add([]byte{Sync, 200, Sync, 2, 0x11, 0})
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		fr, n, err := ParseFrame(buf)
+		if n < 0 || n > len(buf) {
+			t.Fatalf("n = %d outside buffer of %d bytes", n, len(buf))
+		}
+		if err != nil && !errors.Is(err, ErrIncomplete) && n == 0 {
+			t.Fatalf("%v without progress", err)
+		}
+		if err != nil {
+			return
+		}
+		// Корректный кадр заканчивается ровно на n и кодируется обратно в те же байты.
+		enc := mustFrame(t, fr)
+		if n < len(enc) || !bytes.Equal(buf[n-len(enc):n], enc) {
+			t.Fatalf("frame %+v does not re-encode to the bytes it was parsed from", fr)
+		}
+		DecodePayload(fr)
+	})
+}
@@ -0,0 +1,70 @@
+package wire
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// OpSet — множество кодов операций в виде битовой маски.
+type OpSet [32]byte
+
+// NewOpSet собирает множество из списка операций.
+func NewOpSet(ops ...Op) OpSet {
+	var s OpSet
+	for _, op := range ops {
+		s.Add(op)
+	}
+	return s
+}
+
+func (s *OpSet) Add(op Op)     { s[op/8] |= 1 << (op % 8) }
+func (s OpSet) Has(op Op) bool { return s[op/8]&(1<<(op%8)) != 0 }
+
+// Ops возвращает операции множества по возрастанию кода.
+func (s OpSet) Ops() []Op {
+	var ops []Op
+	for i := 0; i < 256; i++ {
+		if s.Has(Op(i)) {
+			ops = append(ops, Op(i))
+		}
+	}
+	return ops
+}
+
+// Hello — ответ прошивки на OpHello, передается в payload кадра Ack:
+//
+//	version | bufferSize (u16 LE) | ops (32 байта) | firmware (ASCII до конца)
+type Hello struct {
+	Version    uint8
+	BufferSize uint16
+	Ops        OpSet
+	Firmware   string
+}
+
+const helloFixedLen = 1 + 2 + len(OpSet{})
+
+// EncodeHello кодирует ответ на OpHello.
+func EncodeHello(h Hello) ([]byte, error) {
+	if helloFixedLen+len(h.Firmware) > MaxPayload {
+		return nil, fmt.Errorf("firmware name %q is too long", h.Firmware)
+	}
+	b := make([]byte, 0, helloFixedLen+len(h.Firmware))
+	b = append(b, h.Version)
+	b = binary.LittleEndian.AppendUint16(b, h.BufferSize)
+	b = append(b, h.Ops[:]...)
+	return append(b, h.Firmware...), nil
+}
+
+// DecodeHello разбирает ответ на OpHello.
+func DecodeHello(b []byte) (Hello, error) {
+	if len(b) < helloFixedLen {
+		return Hello{}, fmt.Errorf("hello payload of %d bytes is too short", len(b))
+	}
+	h := Hello{
+		Version:    b[0],
+		BufferSize: binary.LittleEndian.Uint16(b[1:]),
+		Firmware:   string(b[helloFixedLen:]),
+	}
+	copy(h.Ops[:], b[3:helloFixedLen])
+	return h, nil
+}
@@ -0,0 +1,87 @@
+package wire
+
+import "image"
+
+const (
+	// AbsMax — наибольшая абсолютная координата HID-дигитайзера. Диапазон
+	// 0..AbsMax по каждой оси покрывает весь виртуальный рабочий стол.
+	AbsMax = 32767
+	// MaxStep — наибольшее смещение по оси в одном HID-отчете мыши.
+	MaxStep = 127
+	// LegacyMaxMove — наибольшее смещение по оси, которое помещается
+	// в одну команду OpMouseMove протокола v1.
+	LegacyMaxMove = legacyMoveBase - 1
+)
+
+// Step — одно относительное перемещение в пределах HID-отчета.
+type Step struct {
+	DX, DY int8
+}
+
+// ToAbs переводит точку рабочего стола desktop в абсолютные координаты
+// 0..AbsMax. У виртуального стола из нескольких мониторов Min может быть
+// отрицательным. Точки за пределами стола прижимаются к его краю.
+func ToAbs(desktop image.Rectangle, p image.Point) (x, y int) {
+	return toAbs(p.X-desktop.Min.X, desktop.Dx()), toAbs(p.Y-desktop.Min.Y, desktop.Dy())
+}
+
+// FromAbs — обратное к ToAbs преобразование.
+func FromAbs(desktop image.Rectangle, x, y int) image.Point {
+	return image.Point{
+		X: desktop.Min.X + fromAbs(x, desktop.Dx()),
+		Y: desktop.Min.Y + fromAbs(y, desktop.Dy()),
+	}
+}
+
+func toAbs(v, size int) int {
+	if size <= 1 {
+		return 0
+	}
+	v = max(0, min(v, size-1))
+	return (v*AbsMax + (size-1)/2) / (size - 1)
+}
+
+func fromAbs(v, size int) int {
+	if size <= 1 {
+		return 0
+	}
+	v = max(0, min(v, AbsMax))
+	return (v*(size-1) + AbsMax/2) / AbsMax
+}
+
+// SplitMove делит смещение dx,dy на части не больше limit по каждой оси.
+// Части идут вдоль прямой от начала к концу, их сумма равна dx,dy.
+// limit меньше 1 считается равным 1.
+func SplitMove(dx, dy, limit int) []image.Point {
+	limit = max(limit, 1)
+	n := (max(abs(dx), abs(dy)) + limit - 1) / limit
+	if n == 0 {
+		return nil
+	}
+	parts := make([]image.Point, n)
+	var px, py int
+	for i := 1; i <= n; i++ {
+		x, y := divRound(dx*i, n), divRound(dy*i, n)
+		parts[i-1] = image.Point{X: x - px, Y: y - py}
+		px, py = x, y
+	}
+	return parts
+}
+
+// PlanSteps делит смещение на шаги HID-отчетов не больше MaxStep по оси.
+func PlanSteps(dx, dy int) []Step {
+	parts := SplitMove(dx, dy, MaxStep)
+	steps := make([]Step, len(parts))
+	for i, p := range parts {
+		steps[i] = Step{DX: int8(p.X), DY: int8(p.Y)}
+	}
+	return steps
+}
+
+// divRound делит с округлением к ближайшему, симметрично для отрицательных.
+func divRound(a, b int) int {
+	if a < 0 {
+		return -((-a + b/2) / b)
+	}
+	return (a + b/2) / b
+}
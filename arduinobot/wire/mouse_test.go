@@ -0,0 +1,71 @@
+package wire
+
+import (
+	"image"
+	"testing"
+)
+
+func TestSplitMove(t *testing.T) {
+	tests := []struct {
+		dx, dy, limit int
+		parts         int
+	}{
+		{0, 0, 127, 0},
+		{5, -3, 127, 1},
+		{127, -127, 127, 1},
+		{128, 0, 127, 2},
+		{-1000, 35, 127, 8},
+		{300, 299, 100, 3},
+		{3, -2, 0, 3},
+		{-4, 1, -7, 4},
+	}
+	for _, tt := range tests {
+		parts := SplitMove(tt.dx, tt.dy, tt.limit)
+		if len(parts) != tt.parts {
+			t.Errorf("SplitMove(%d, %d, %d) = %d parts, want %d", tt.dx, tt.dy, tt.limit, len(parts), tt.parts)
+		}
+		limit := max(tt.limit, 1)
+		var sum image.Point
+		for _, p := range parts {
+			if abs(p.X) > limit || abs(p.Y) > limit {
+				t.Errorf("SplitMove(%d, %d, %d): part %v exceeds the limit", tt.dx, tt.dy, tt.limit, p)
+			}
+			sum = sum.Add(p)
+		}
+		if sum != image.Pt(tt.dx, tt.dy) {
+			t.Errorf("SplitMove(%d, %d, %d) sums to %v", tt.dx, tt.dy, tt.limit, sum)
+		}
+	}
+}
+
+func TestPlanSteps(t *testing.T) {
+	for _, d := range []image.Point{{0, 0}, {1, 1}, {-128, 127}, {5000, -2500}} {
+		var sum image.Point
+		for _, s := range PlanSteps(d.X, d.Y) {
+			if s.DX == -128 || s.DY == -128 {
+				t.Errorf("PlanSteps(%v): step %v outside ±MaxStep", d, s)
+			}
+			sum = sum.Add(image.Pt(int(s.DX), int(s.DY)))
+		}
+		if sum != d {
+			t.Errorf("PlanSteps(%v) sums to %v", d, sum)
+		}
+	}
+}
+
+func TestAbsRoundTrip(t *testing.T) {
+	// Два монитора: левый с отрицательными координатами.
+	desktop := image.Rect(-1920, -200, 1920, 1080)
+	for _, p := range []image.Point{desktop.Min, {0, 0}, {-1, 500}, {1919, 1079}, {123, -17}} {
+		x, y := ToAbs(desktop, p)
+		if x < 0 || x > AbsMax || y < 0 || y > AbsMax {
+			t.Errorf("ToAbs(%v) = %d,%d outside 0..AbsMax", p, x, y)
+		}
+		if got := FromAbs(desktop, x, y); got != p {
+			t.Errorf("FromAbs(ToAbs(%v)) = %v", p, got)
+		}
+	}
+	if x, y := ToAbs(desktop, image.Pt(5000, -5000)); x != AbsMax || y != 0 {
+		t.Errorf("ToAbs outside the desktop = %d,%d, want clamped to %d,0", x, y, AbsMax)
+	}
+}
@@ -0,0 +1,98 @@
+// Command arduinobridge exposes the Arduino plugged into this machine over
+// TCP, so a bot running elsewhere can drive it with Port "tcp://host:port"
+// and the same shared key in BridgeKey.
+//
+//	ARDUINO_BRIDGE_KEY=secret arduinobridge -listen :7531
+//	arduinobridge -key-file bridge.key -port /dev/ttyACM0
+//	arduinobridge -key-file bridge.key -emulator
+//
+// The key authenticates both sides but the traffic is not encrypted; tunnel
+// it through SSH or a VPN on an untrusted network.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"arduino-go-bot/arduinobot"
+	"arduino-go-bot/arduinobot/bridge"
+	"arduino-go-bot/arduinobot/emulator"
+)
+
+// keyEnv is read when -key-file is not given, so the key stays out of the process list.
+const keyEnv = "ARDUINO_BRIDGE_KEY"
+
+func main() {
+	listen := flag.String("listen", ":7531", "TCP address to accept bot connections on")
+	keyFile := flag.String("key-file", "", "file with the shared key (default: $"+keyEnv+")")
+	port := flag.String("port", "", "serial port of the board; empty finds it by -serial, -vid and -pid")
+	serialNumber := flag.String("serial", "", "USB serial number of the board")
+	vid := flag.String("vid", "", "USB vendor ID of the board (default: known Leonardo-class boards)")
+	pid := flag.String("pid", "", "USB product ID of the board")
+	baud := flag.Int("baud", 115200, "serial baud rate")
+	emu := flag.Bool("emulator", false, "serve the firmware emulator instead of a board, for testing")
+	legacy := flag.Bool("legacy", false, "with -emulator, emulate v1-only firmware")
+	flag.Parse()
+
+	key, err := readKey(*keyFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	open := func() (bridge.Port, string, error) {
+		return emulator.NewWithConfig(emulator.Config{Legacy: *legacy}), "emulator", nil
+	}
+	if !*emu {
+		dial := arduinobot.SerialDialer(arduinobot.Config{
+			Port:         *port,
+			SerialNumber: *serialNumber,
+			VID:          strings.ToUpper(*vid),
+			PID:          strings.ToUpper(*pid),
+			BaudRate:     *baud,
+			ReadTimeout:  time.Second,
+		})
+		open = func() (bridge.Port, string, error) { return dial() }
+	}
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		log.Fatal(err)
+	}
+	srv := &bridge.Server{Key: key, Open: open}
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt)
+		<-sig
+		ln.Close()
+	}()
+	log.Printf("arduinobridge listening on %s", ln.Addr())
+	err = srv.Serve(ln)
+	srv.Close()
+	if !errors.Is(err, net.ErrClosed) {
+		log.Fatal(err)
+	}
+}
+
+// readKey loads the shared key from path, or from the environment when path is empty.
+func readKey(path string) ([]byte, error) {
+	key := os.Getenv(keyEnv)
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		key = string(b)
+	}
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return nil, fmt.Errorf("no shared key: use -key-file or set %s", keyEnv)
+	}
+	return []byte(key), nil
+}
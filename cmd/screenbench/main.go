@@ -0,0 +1,98 @@
+// Command screenbench compares the two ways screenfinder reads a window:
+// one Window.Pixel call per point (FindPixels) and one captured frame per
+// Find. The points form an even grid over the window, and the target color
+// never matches, so every point is checked on every pass.
+//
+//	screenbench -process game.exe -points 64
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"os"
+	"testing"
+
+	"arduino-go-bot/platform"
+	"arduino-go-bot/screenfinder"
+)
+
+func main() {
+	process := flag.String("process", "", "executable name of the game")
+	pid := flag.Int("pid", 0, "process id of the game; overrides -process")
+	points := flag.Int("points", 16, "number of points to check per Find")
+	flag.Parse()
+
+	if *pid == 0 {
+		if *process == "" {
+			fmt.Fprintln(os.Stderr, "screenbench: -process or -pid is required")
+			os.Exit(2)
+		}
+		procs, err := platform.Current.Processes()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if *pid = procs[*process]; *pid == 0 {
+			fmt.Fprintf(os.Stderr, "screenbench: process %q not found\n", *process)
+			os.Exit(1)
+		}
+	}
+
+	finder := &screenfinder.Finder{PID: *pid}
+	if err := finder.SetWindow(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	r, err := finder.Window.Rect()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	finder.Positions = grid(r.Size(), *points)
+	// An odd near-white that practically never occurs; a hit would only
+	// shorten both paths equally.
+	finder.TargetColor = screenfinder.Color{R: 255, G: 254, B: 255}
+
+	if _, err := finder.Frame(); err != nil {
+		fmt.Fprintf(os.Stderr, "screenbench: window cannot be captured: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("window %dx%d, %d points, capture area %v\n", r.Dx(), r.Dy(), len(finder.Positions), screenfinder.Bounds(finder.Positions))
+
+	pixels := testing.Benchmark(func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, _, err := finder.FindPixels(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	frames := testing.Benchmark(func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, _, err := finder.Find(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	fmt.Printf("per-pixel  %s\n", pixels)
+	fmt.Printf("frame      %s\n", frames)
+	if frames.NsPerOp() > 0 {
+		fmt.Printf("speedup    %.1fx\n", float64(pixels.NsPerOp())/float64(frames.NsPerOp()))
+	}
+}
+
+// grid spreads n points evenly over a window of the given size.
+func grid(size image.Point, n int) []screenfinder.Coord {
+	cols := 1
+	for cols*cols < n {
+		cols++
+	}
+	rows := (n + cols - 1) / cols
+	coords := make([]screenfinder.Coord, 0, n)
+	for i := 0; i < n; i++ {
+		x := (i%cols*2 + 1) * size.X / (cols * 2)
+		y := (i/cols*2 + 1) * size.Y / (rows * 2)
+		coords = append(coords, screenfinder.Coord{X: int32(x), Y: int32(y)})
+	}
+	return coords
+}
@@ -0,0 +1,93 @@
+// Command screenrec records a game window into a capture archive that
+// screenfinder.LoadArchive plays back, so detection rules can be tuned and
+// checked without the game running.
+//
+//	screenrec -process game.exe -fps 5 -duration 30s -o session.zip
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"os"
+	"os/signal"
+	"time"
+
+	"arduino-go-bot/platform"
+	"arduino-go-bot/screenfinder"
+)
+
+func main() {
+	process := flag.String("process", "", "executable name of the game")
+	pid := flag.Int("pid", 0, "process id of the game; overrides -process")
+	out := flag.String("o", "capture.zip", "archive to write")
+	fps := flag.Float64("fps", 5, "frames per second")
+	duration := flag.Duration("duration", 0, "stop after this long; 0 records until interrupted")
+	flag.Parse()
+
+	if *pid == 0 {
+		if *process == "" {
+			fmt.Fprintln(os.Stderr, "screenrec: -process or -pid is required")
+			os.Exit(2)
+		}
+		procs, err := platform.Current.Processes()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if *pid = procs[*process]; *pid == 0 {
+			fmt.Fprintf(os.Stderr, "screenrec: process %q not found\n", *process)
+			os.Exit(1)
+		}
+	}
+	if *fps <= 0 {
+		fmt.Fprintln(os.Stderr, "screenrec: -fps must be positive")
+		os.Exit(2)
+	}
+
+	finder := &screenfinder.Finder{PID: *pid}
+	if err := finder.SetWindow(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	rec, err := screenfinder.CreateArchive(*out)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	src := screenfinder.Recording{
+		Source:   screenfinder.WindowSource{Window: finder.Window},
+		Recorder: rec,
+		OnError:  func(err error) { fmt.Fprintln(os.Stderr, "record:", err) },
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	var deadline <-chan time.Time
+	if *duration > 0 {
+		deadline = time.After(*duration)
+	}
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / *fps))
+	defer ticker.Stop()
+
+	frames := 0
+	for running := true; running; {
+		select {
+		case <-stop:
+			running = false
+		case <-deadline:
+			running = false
+		case <-ticker.C:
+			if _, err := src.Frame(image.Rectangle{}); err != nil {
+				fmt.Fprintln(os.Stderr, "capture:", err)
+				continue
+			}
+			frames++
+		}
+	}
+	if err := rec.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("%d frames written to %s\n", frames, *out)
+}
@@ -0,0 +1,100 @@
+// Command tracecat prints a capture written by arduinobot.Config.Trace as
+// readable commands and replies with per-command latencies, and can replay it
+// against the firmware emulator to reproduce the session.
+//
+//	tracecat arduino.abt
+//	tracecat -replay -speed 0 arduino.abt
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"arduino-go-bot/arduinobot/emulator"
+	"arduino-go-bot/arduinobot/trace"
+	"arduino-go-bot/arduinobot/wire"
+)
+
+func main() {
+	replay := flag.Bool("replay", false, "feed the capture into the emulator and print its replies instead of the recorded ones")
+	speed := flag.Float64("speed", 1, "replay speed multiplier; 0 replays without pauses")
+	legacy := flag.Bool("legacy", false, "replay against v1-only firmware")
+	quiet := flag.Bool("q", false, "print only the latency summary")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: tracecat [flags] capture.abt\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	start, records, err := trace.ReadFile(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("capture started %s, %d records\n", start.Format(time.RFC3339Nano), len(records))
+
+	var emu *emulator.Emulator
+	if *replay {
+		emu = emulator.NewWithConfig(emulator.Config{Legacy: *legacy})
+		records, err = trace.Replay(context.Background(), records, emu, *speed)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	entries := trace.Decode(records)
+	if !*quiet {
+		for _, e := range entries {
+			fmt.Println(e)
+		}
+	}
+	summarize(entries)
+	if emu != nil {
+		fmt.Printf("emulator executed %d commands, cursor at %v\n", len(emu.Commands()), emu.Cursor())
+	}
+}
+
+// summarize prints reply latencies per operation and commands left without a reply.
+func summarize(entries []trace.Entry) {
+	sent := map[wire.Op]int{}
+	lat := map[wire.Op][]time.Duration{}
+	for _, e := range entries {
+		if !e.IsCommand {
+			continue
+		}
+		switch e.Kind {
+		case trace.KindWrite:
+			sent[e.Op]++
+		case trace.KindRead:
+			lat[e.Op] = append(lat[e.Op], e.Latency)
+		}
+	}
+	ops := make([]wire.Op, 0, len(sent))
+	for op := range sent {
+		ops = append(ops, op)
+	}
+	sort.Slice(ops, func(i, j int) bool { return ops[i] < ops[j] })
+	fmt.Printf("\n%-20s %6s %8s %9s %9s %9s\n", "op", "sent", "no reply", "median", "p95", "max")
+	for _, op := range ops {
+		l := lat[op]
+		sort.Slice(l, func(i, j int) bool { return l[i] < l[j] })
+		fmt.Printf("%-20s %6d %8d %9s %9s %9s\n", op, sent[op], sent[op]-len(l), pct(l, 50), pct(l, 95), pct(l, 100))
+	}
+}
+
+func pct(sorted []time.Duration, p int) string {
+	if len(sorted) == 0 {
+		return "-"
+	}
+	i := (len(sorted)*p+99)/100 - 1
+	return sorted[max(i, 0)].Round(10 * time.Microsecond).String()
+}
@@ -4,6 +4,7 @@ go 1.24.3
 
 require (
 	fyne.io/fyne/v2 v2.7.0
+	github.com/BurntSushi/xgb v0.0.0-20210121224620-deaf085860bc
 	go.bug.st/serial v1.6.4
 	golang.org/x/sys v0.30.0
 )
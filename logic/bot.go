@@ -1,22 +1,53 @@
 package logic
 
 import (
+	"context"
+	"errors"
 	"log"
 	"math/rand"
+	"runtime/debug"
+	"sync/atomic"
 	"time"
 	"arduino-go-bot/arduinobot"
+	"arduino-go-bot/arduinobot/keys"
 	"arduino-go-bot/screenfinder"
+	"arduino-go-bot/uinput"
 )
 
-const (
-	KEY_F1     = 0xC2 // 194 F1
-	KEY_F2     = 0xC3 // 195 F2
-	MOUSE_LEFT = 1
+const MOUSE_LEFT = 1
+
+// InputDriver presses keys and moves the mouse for the bot: *arduinobot.Controller through the board,
+// *uinput.Device through a virtual Linux keyboard and mouse.
+type InputDriver interface {
+	KeyDownCtx(ctx context.Context, key keys.Key) error
+	KeyUpCtx(ctx context.Context, key keys.Key) error
+	TextCtx(ctx context.Context, text string) error
+	MouseMoveCtx(ctx context.Context, x, y int) error
+	MouseDownCtx(ctx context.Context, button int) error
+	MouseUpCtx(ctx context.Context, button int) error
+	MouseWheelCtx(ctx context.Context, amount int) error
+	// ReleaseAllCtx lets go of everything pressed with KeyDownCtx/MouseDownCtx and not released yet.
+	ReleaseAllCtx(ctx context.Context) error
+}
+
+var (
+	_ InputDriver = (*arduinobot.Controller)(nil)
+	_ InputDriver = (*uinput.Device)(nil)
 )
 
+// Keys are the game bindings the bot presses.
+type Keys struct {
+	Attack   keys.Key // target the monster under the cursor
+	Teleport keys.Key // jump to a random spot
+}
+
+// DefaultKeys are the stock game bindings.
+var DefaultKeys = Keys{Attack: keys.F1, Teleport: keys.F2}
+
+// errorCounter counts Arduino failures in a row; attack goroutines and the main loop share it.
 var (
-	errorCounter int
-	maxErrors    = 5
+	errorCounter atomic.Int32
+	maxErrors    int32 = 5
 )
 
 func jitter(base, jitter time.Duration) time.Duration {
@@ -25,78 +56,123 @@ func jitter(base, jitter time.Duration) time.Duration {
 	return base + time.Duration(j)
 }
 
-func KeyPressRand(controller *arduinobot.Controller, key int, actionDelay, actionJitter time.Duration) error {
-	if err := controller.KeyDown(key); err != nil { return err }
-	time.Sleep(jitter(actionDelay, actionJitter))
-	if err := controller.KeyUp(key); err != nil { return err }
-	return nil
+// sleepCtx waits for d unless ctx is cancelled first. It reports whether the whole delay elapsed.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select { case <-t.C: return true; case <-ctx.Done(): return false }
+}
+
+// KeyPressRand holds key for a jittered delay. The release is sent even if ctx is cancelled meanwhile.
+func KeyPressRand(ctx context.Context, controller InputDriver, key keys.Key, actionDelay, actionJitter time.Duration) error {
+	if err := controller.KeyDownCtx(ctx, key); err != nil { return err }
+	sleepCtx(ctx, jitter(actionDelay, actionJitter))
+	if err := controller.KeyUpCtx(context.WithoutCancel(ctx), key); err != nil { return err }
+	return ctx.Err()
 }
 
-func ClickRand(controller *arduinobot.Controller, button int, actionDelay, actionJitter time.Duration) error {
-	if err := controller.MouseDown(button); err != nil { return err }
-	time.Sleep(jitter(actionDelay, actionJitter))
-	if err := controller.MouseUp(button); err != nil { return err }
-	return nil
+// ClickRand holds button for a jittered delay. The release is sent even if ctx is cancelled meanwhile.
+func ClickRand(ctx context.Context, controller InputDriver, button int, actionDelay, actionJitter time.Duration) error {
+	if err := controller.MouseDownCtx(ctx, button); err != nil { return err }
+	sleepCtx(ctx, jitter(actionDelay, actionJitter))
+	if err := controller.MouseUpCtx(context.WithoutCancel(ctx), button); err != nil { return err }
+	return ctx.Err()
 }
 
-func handleArduinoError(controllerPtr **arduinobot.Controller, prevConfig arduinobot.Config, err error) {
-	errorCounter++
-	log.Printf("Temporary issue talking to Arduino (%d/%d). We will try to fix it automatically. Details: %v", errorCounter, maxErrors, err)
-	if errorCounter < maxErrors { return }
+// handleArduinoError decides what to do based on why the command failed. The supervisor
+// brings a lost port back by itself; after maxErrors timeouts or bad replies in a row we ask it to reopen the port
+// (if the driver can reconnect at all).
+func handleArduinoError(controller InputDriver, err error) {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return // stopped by user, not an Arduino problem
+	case errors.Is(err, arduinobot.ErrOffTarget):
+		log.Printf("The cursor didn't reach the monster, skipping the click. Try calibrating the mouse. Details: %v", err)
+		return
+	case errors.Is(err, arduinobot.ErrUnsupported):
+		log.Printf("The Arduino firmware doesn't support this action. Please update the firmware. Details: %v", err)
+		return
+	case errors.Is(err, arduinobot.ErrPortClosed):
+		log.Printf("The Arduino is disconnected. Waiting for it to come back... Details: %v", err)
+		errorCounter.Store(0)
+		time.Sleep(time.Second)
+		return
+	}
+	n := errorCounter.Add(1)
+	log.Printf("Temporary issue talking to Arduino (%d/%d). We will try to fix it automatically. Details: %v", n, maxErrors, err)
+	// Only the goroutine that resets the counter reconnects.
+	if n < maxErrors || !errorCounter.CompareAndSwap(n, 0) { return }
+	r, ok := controller.(interface{ Reconnect() error })
+	if !ok { return }
 	log.Println("Too many Arduino errors in a row. Reconnecting controller...")
-	(*controllerPtr).Close()
-	time.Sleep(time.Second)
-	newCtrl, err := arduinobot.NewController(prevConfig)
-	if err != nil { log.Fatalf("We couldn't reconnect to Arduino. Please check the USB cable and try again. Details: %v", err) }
-	*controllerPtr = newCtrl
-	errorCounter = 0
-	log.Println("Arduino connection restored.")
+	if err := r.Reconnect(); err != nil { log.Printf("Couldn't reconnect to Arduino: %v", err) }
+}
+
+// releaseAll lets go of every key and button the bot still holds.
+func releaseAll(controller InputDriver) {
+	if err := controller.ReleaseAllCtx(context.Background()); err != nil { log.Printf("Couldn't release held keys: %v", err) }
+}
+
+// releaseOnPanic recovers a panic in a bot goroutine so held keys don't stay pressed on the host.
+func releaseOnPanic(controller InputDriver) {
+	if r := recover(); r != nil {
+		log.Printf("Bot crashed: %v\n%s", r, debug.Stack())
+		releaseAll(controller)
+	}
 }
 
 // RunBotLoop runs until stopCh is closed. actionDelay/teleportDelay have optional jitters.
-func RunBotLoop(controller *arduinobot.Controller, prevConfig arduinobot.Config, finder *screenfinder.Finder, stopCh <-chan struct{}, actionDelay, teleportDelay, actionJitter, teleportJitter time.Duration) {
+// Closing stopCh also aborts any Arduino command that is waiting for its reply and releases held keys.
+func RunBotLoop(controller InputDriver, bindings Keys, finder *screenfinder.Finder, stopCh <-chan struct{}, actionDelay, teleportDelay, actionJitter, teleportJitter time.Duration) {
 	log.Println("App is running. Looking for monsters...")
+	defer releaseAll(controller)
+	defer releaseOnPanic(controller)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { select { case <-stopCh: cancel(); case <-ctx.Done(): } }()
 
 	for {
 		select { case <-stopCh: log.Println("Stopped by user."); return; default: }
 
 		found, coord, err := finder.Find()
-		if err != nil { log.Printf("We couldn't access the game window. We'll try again in a moment. Details: %v", err); time.Sleep(2*time.Second); continue }
+		if err != nil { log.Printf("We couldn't access the game window. We'll try again in a moment. Details: %v", err); sleepCtx(ctx, 2*time.Second); continue }
 
 		tlx, tly, _ := finder.TopLeft()
 
 		if found {
 			log.Printf("Monster found at %d,%d. Attacking...", coord.X, coord.Y)
 			go func(c screenfinder.Coord) {
-				if err := KeyPressRand(controller, KEY_F1, actionDelay, actionJitter); err != nil { handleArduinoError(&controller, prevConfig, err); return } else { errorCounter = 0 }
-				time.Sleep(jitter(actionDelay, actionJitter))
-				if err := controller.MouseMove(int(tlx+c.X), int(tly+c.Y)); err != nil { handleArduinoError(&controller, prevConfig, err); return } else { errorCounter = 0 }
-				time.Sleep(jitter(actionDelay, actionJitter))
-				if err := ClickRand(controller, MOUSE_LEFT, actionDelay, actionJitter); err != nil { handleArduinoError(&controller, prevConfig, err); return } else { errorCounter = 0 }
-				time.Sleep(jitter(actionDelay, actionJitter))
+				defer releaseOnPanic(controller)
+				if err := KeyPressRand(ctx, controller, bindings.Attack, actionDelay, actionJitter); err != nil { handleArduinoError(controller, err); return } else { errorCounter.Store(0) }
+				if !sleepCtx(ctx, jitter(actionDelay, actionJitter)) { return }
+				if err := controller.MouseMoveCtx(ctx, int(tlx+c.X), int(tly+c.Y)); err != nil { handleArduinoError(controller, err); return } else { errorCounter.Store(0) }
+				if !sleepCtx(ctx, jitter(actionDelay, actionJitter)) { return }
+				if err := ClickRand(ctx, controller, MOUSE_LEFT, actionDelay, actionJitter); err != nil { handleArduinoError(controller, err); return } else { errorCounter.Store(0) }
+				if !sleepCtx(ctx, jitter(actionDelay, actionJitter)) { return }
 				killed := make(chan bool, 1)
-				go func(){ defer close(killed); for { select { case <-stopCh: return; default: } ; time.Sleep(150*time.Millisecond); check,_,_ := finder.Find(); if !check { killed<-true; break } } }()
+				go func(){ defer releaseOnPanic(controller); defer close(killed); for { select { case <-stopCh: return; default: } ; time.Sleep(150*time.Millisecond); check,_,_ := finder.Find(); if !check { killed<-true; break } } }()
 				select {
 				case <-stopCh:
 					return
 				case <-time.After(6 * time.Second):
 					log.Println("Monster is still alive after 6s. Using teleport...")
-					if err := KeyPressRand(controller, KEY_F2, actionDelay, actionJitter); err != nil { handleArduinoError(&controller, prevConfig, err); return } else { errorCounter = 0 }
-					time.Sleep(jitter(actionDelay, actionJitter))
+					if err := KeyPressRand(ctx, controller, bindings.Teleport, actionDelay, actionJitter); err != nil { handleArduinoError(controller, err); return } else { errorCounter.Store(0) }
+					if !sleepCtx(ctx, jitter(actionDelay, actionJitter)) { return }
 					log.Println("Waiting for the screen to update after teleport...")
-					time.Sleep(jitter(teleportDelay, teleportJitter))
+					sleepCtx(ctx, jitter(teleportDelay, teleportJitter))
 					select { case <-killed: default: }
 				case <-killed:
 					log.Println("Monster defeated. Ready for the next target!")
-					time.Sleep(jitter(actionDelay, actionJitter))
+					sleepCtx(ctx, jitter(actionDelay, actionJitter))
 				}
 			}(coord)
 		} else {
 			log.Println("No monster detected. Performing auto-teleport...")
-			if err := KeyPressRand(controller, KEY_F2, actionDelay, actionJitter); err != nil { handleArduinoError(&controller, prevConfig, err); continue } else { errorCounter = 0 }
+			if err := KeyPressRand(ctx, controller, bindings.Teleport, actionDelay, actionJitter); err != nil { handleArduinoError(controller, err); continue } else { errorCounter.Store(0) }
 			log.Println("Waiting for the screen to update after teleport...")
-			time.Sleep(jitter(teleportDelay, teleportJitter))
+			sleepCtx(ctx, jitter(teleportDelay, teleportJitter))
 		}
-		time.Sleep(jitter(actionDelay, actionJitter))
+		sleepCtx(ctx, jitter(actionDelay, actionJitter))
 	}
 }
@@ -0,0 +1,68 @@
+package logic
+
+import (
+	"context"
+	"testing"
+
+	"arduino-go-bot/arduinobot/keys"
+)
+
+// fakeDriver records what the bot holds; methods the tests don't use panic via the nil InputDriver.
+type fakeDriver struct {
+	InputDriver
+	held     map[keys.Key]bool
+	releases int
+}
+
+func (d *fakeDriver) KeyDownCtx(_ context.Context, k keys.Key) error {
+	if d.held == nil {
+		d.held = make(map[keys.Key]bool)
+	}
+	d.held[k] = true
+	return nil
+}
+
+func (d *fakeDriver) KeyUpCtx(_ context.Context, k keys.Key) error {
+	delete(d.held, k)
+	return nil
+}
+
+func (d *fakeDriver) ReleaseAllCtx(context.Context) error {
+	d.releases++
+	clear(d.held)
+	return nil
+}
+
+func TestReleaseOnPanic(t *testing.T) {
+	d := &fakeDriver{}
+	func() {
+		defer releaseOnPanic(d)
+		d.KeyDownCtx(context.Background(), keys.F1)
+		panic("boom")
+	}()
+	if d.releases != 1 || len(d.held) != 0 {
+		t.Errorf("after a panic: %d releases, held %v", d.releases, d.held)
+	}
+
+	// Without a panic the goroutine releases its own keys.
+	d = &fakeDriver{}
+	func() {
+		defer releaseOnPanic(d)
+		KeyPressRand(context.Background(), d, keys.F2, 0, 0)
+	}()
+	if d.releases != 0 || len(d.held) != 0 {
+		t.Errorf("without a panic: %d releases, held %v", d.releases, d.held)
+	}
+}
+
+func TestKeyPressRandReleasesOnCancel(t *testing.T) {
+	d := &fakeDriver{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := KeyPressRand(ctx, d, keys.F1, 0, 0); err != context.Canceled {
+		t.Errorf("KeyPressRand: %v, want context.Canceled", err)
+	}
+	if len(d.held) != 0 {
+		t.Errorf("held after a cancelled press: %v", d.held)
+	}
+}
@@ -0,0 +1,75 @@
+// Package platform отделяет бота от операционной системы: положение
+// курсора, чтение экрана, поиск окна процесса, список процессов и
+// глобальные горячие клавиши. Реализация для Windows собирается только
+// под Windows, для Linux экран и окна читаются через X11 (NewX11); на
+// остальных системах возможности, которых пока нет, возвращают
+// ErrUnsupported, чтобы модуль собирался и тестировался везде.
+package platform
+
+import (
+	"errors"
+	"image"
+	"image/color"
+)
+
+// ErrUnsupported — возможность не реализована на этой платформе
+// или недоступна в текущем окружении (например, без дисплея).
+var ErrUnsupported = errors.New("not supported on this platform")
+
+// Cursor сообщает положение курсора на рабочем столе.
+type Cursor interface {
+	CursorPosition() (image.Point, error)
+}
+
+// Screen читает изображение рабочего стола.
+type Screen interface {
+	// Desktop возвращает границы виртуального рабочего стола. У нескольких
+	// мониторов Min может быть отрицательным.
+	Desktop() (image.Rectangle, error)
+	// Pixel возвращает цвет точки рабочего стола.
+	Pixel(p image.Point) (color.RGBA, error)
+	// Capture снимает область рабочего стола.
+	Capture(r image.Rectangle) (*image.RGBA, error)
+}
+
+// Window — окно другого процесса.
+type Window interface {
+	// Rect возвращает положение окна на рабочем столе.
+	Rect() (image.Rectangle, error)
+	// Pixel возвращает цвет точки в координатах окна.
+	Pixel(p image.Point) (color.RGBA, error)
+	// Capture снимает область окна в его координатах.
+	Capture(r image.Rectangle) (*image.RGBA, error)
+}
+
+// WindowFinder ищет окна процессов.
+type WindowFinder interface {
+	// FindWindow возвращает главное окно процесса pid — его первое видимое
+	// окно; скрытые окна (свернутые в трей, служебные) не находятся.
+	FindWindow(pid int) (Window, error)
+}
+
+// Processes перечисляет запущенные процессы.
+type Processes interface {
+	// Processes возвращает PID по имени исполняемого файла.
+	Processes() (map[string]int, error)
+}
+
+// Hotkeys регистрирует глобальные горячие клавиши.
+type Hotkeys interface {
+	// RegisterHotkey вызывает fn при каждом нажатии chord ("Ctrl+Shift+S")
+	// в любом окне. unregister снимает регистрацию.
+	RegisterHotkey(chord string, fn func()) (unregister func(), err error)
+}
+
+// Platform объединяет все возможности.
+type Platform interface {
+	Cursor
+	Screen
+	WindowFinder
+	Processes
+	Hotkeys
+}
+
+// Current — реализация для системы, под которую собрана программа.
+var Current Platform = current()
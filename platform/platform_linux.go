@@ -0,0 +1,394 @@
+package platform
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math/bits"
+	"os"
+	"sync"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/shm"
+	"github.com/BurntSushi/xgb/xproto"
+	"golang.org/x/sys/unix"
+)
+
+// x11Platform читает экран и ищет окна через X-сервер из DISPLAY.
+// Соединение открывается при первом обращении; неудачное подключение
+// повторяется при следующем, так что X-сервер может подняться позже
+// программы. Без дисплея экранные методы возвращают ErrUnsupported.
+// Список процессов и горячие клавиши — от otherPlatform.
+type x11Platform struct {
+	otherPlatform
+	display string
+
+	mu sync.Mutex
+	x  *x11Conn
+}
+
+func current() Platform { return &x11Platform{} }
+
+// NewX11 подключается к X-серверу display (":99"; пустая строка — DISPLAY).
+// Нужна, чтобы работать с конкретным дисплеем, например с Xvfb в тестах.
+func NewX11(display string) (Platform, error) {
+	p := &x11Platform{display: display}
+	if _, err := p.conn(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *x11Platform) conn() (*x11Conn, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.x != nil {
+		return p.x, nil
+	}
+	if p.display == "" && os.Getenv("DISPLAY") == "" {
+		return nil, fmt.Errorf("X11: DISPLAY is not set: %w", ErrUnsupported)
+	}
+	x, err := dialX11(p.display)
+	if err != nil {
+		return nil, err
+	}
+	p.x = x
+	return x, nil
+}
+
+func (p *x11Platform) CursorPosition() (image.Point, error) {
+	x, err := p.conn()
+	if err != nil {
+		return image.Point{}, err
+	}
+	r, err := xproto.QueryPointer(x.c, x.root).Reply()
+	if err != nil {
+		return image.Point{}, fmt.Errorf("QueryPointer: %w", err)
+	}
+	return image.Pt(int(r.RootX), int(r.RootY)), nil
+}
+
+// Desktop — корневое окно; в X все мониторы лежат в нем, начиная с 0,0.
+func (p *x11Platform) Desktop() (image.Rectangle, error) {
+	x, err := p.conn()
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+	return x.rect(x.root)
+}
+
+func (p *x11Platform) Pixel(pt image.Point) (color.RGBA, error) {
+	x, err := p.conn()
+	if err != nil {
+		return color.RGBA{}, err
+	}
+	return x.pixel(x.root, pt)
+}
+
+func (p *x11Platform) Capture(r image.Rectangle) (*image.RGBA, error) {
+	x, err := p.conn()
+	if err != nil {
+		return nil, err
+	}
+	return x.capture(x.root, r)
+}
+
+// FindWindow ищет видимое окно со свойством _NET_WM_PID == pid: сначала
+// в _NET_CLIENT_LIST оконного менеджера, а без менеджера — по всему дереву.
+func (p *x11Platform) FindWindow(pid int) (Window, error) {
+	x, err := p.conn()
+	if err != nil {
+		return nil, err
+	}
+	wins, err := x.clients()
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range wins {
+		if x.windowPID(w) == pid && x.viewable(w) {
+			return x11Window{x: x, id: w}, nil
+		}
+	}
+	return nil, fmt.Errorf("window of process %d not found", pid)
+}
+
+type x11Window struct {
+	x  *x11Conn
+	id xproto.Window
+}
+
+// Handle возвращает идентификатор окна X11.
+func (w x11Window) Handle() uintptr { return uintptr(w.id) }
+
+// Rect — клиентская область окна в координатах корневого окна; рамку
+// рисует оконный менеджер в своем окне-родителе, и в Rect она не входит.
+func (w x11Window) Rect() (image.Rectangle, error) {
+	return w.x.rect(w.id)
+}
+
+func (w x11Window) Pixel(p image.Point) (color.RGBA, error) {
+	return w.x.pixel(w.id, p)
+}
+
+func (w x11Window) Capture(r image.Rectangle) (*image.RGBA, error) {
+	return w.x.capture(w.id, r)
+}
+
+// x11Conn — соединение с X-сервером и все, что нужно для разбора картинок.
+type x11Conn struct {
+	c     *xgb.Conn
+	setup *xproto.SetupInfo
+	root  xproto.Window
+
+	atomPID, atomClients xproto.Atom
+
+	// mu защищает сегмент разделяемой памяти: один на соединение,
+	// растет под самый большой снимок.
+	mu     sync.Mutex
+	shmOK  bool
+	shmSeg shm.Seg
+	shmBuf []byte
+}
+
+func dialX11(display string) (*x11Conn, error) {
+	c, err := xgb.NewConnDisplay(display)
+	if err != nil {
+		return nil, fmt.Errorf("X11: %w: %v", ErrUnsupported, err)
+	}
+	setup := xproto.Setup(c)
+	x := &x11Conn{c: c, setup: setup, root: setup.DefaultScreen(c).Root}
+	if x.atomPID, err = x.atom("_NET_WM_PID"); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if x.atomClients, err = x.atom("_NET_CLIENT_LIST"); err != nil {
+		c.Close()
+		return nil, err
+	}
+	// Без MIT-SHM (удаленный дисплей) снимки идут обычным GetImage.
+	x.shmOK = shm.Init(c) == nil
+	return x, nil
+}
+
+func (x *x11Conn) atom(name string) (xproto.Atom, error) {
+	r, err := xproto.InternAtom(x.c, false, uint16(len(name)), name).Reply()
+	if err != nil {
+		return 0, fmt.Errorf("InternAtom %s: %w", name, err)
+	}
+	return r.Atom, nil
+}
+
+// rect возвращает положение окна w на корневом окне.
+func (x *x11Conn) rect(w xproto.Window) (image.Rectangle, error) {
+	g, err := xproto.GetGeometry(x.c, xproto.Drawable(w)).Reply()
+	if err != nil {
+		return image.Rectangle{}, fmt.Errorf("GetGeometry: %w", err)
+	}
+	t, err := xproto.TranslateCoordinates(x.c, w, x.root, 0, 0).Reply()
+	if err != nil {
+		return image.Rectangle{}, fmt.Errorf("TranslateCoordinates: %w", err)
+	}
+	return image.Rect(0, 0, int(g.Width), int(g.Height)).Add(image.Pt(int(t.DstX), int(t.DstY))), nil
+}
+
+// clients возвращает окна приложений: _NET_CLIENT_LIST, если его ведет
+// оконный менеджер, иначе все окна дерева.
+func (x *x11Conn) clients() ([]xproto.Window, error) {
+	r, err := xproto.GetProperty(x.c, false, x.root, x.atomClients, xproto.AtomWindow, 0, 1<<16).Reply()
+	if err == nil && r.Format == 32 && r.ValueLen > 0 {
+		wins := make([]xproto.Window, r.ValueLen)
+		for i := range wins {
+			wins[i] = xproto.Window(xgb.Get32(r.Value[4*i:]))
+		}
+		return wins, nil
+	}
+	var wins []xproto.Window
+	var walk func(w xproto.Window) error
+	walk = func(w xproto.Window) error {
+		t, err := xproto.QueryTree(x.c, w).Reply()
+		if err != nil {
+			return fmt.Errorf("QueryTree: %w", err)
+		}
+		for _, ch := range t.Children {
+			wins = append(wins, ch)
+			if err := walk(ch); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(x.root); err != nil {
+		return nil, err
+	}
+	return wins, nil
+}
+
+// windowPID возвращает _NET_WM_PID окна или 0, если свойства нет.
+func (x *x11Conn) windowPID(w xproto.Window) int {
+	r, err := xproto.GetProperty(x.c, false, w, x.atomPID, xproto.AtomCardinal, 0, 1).Reply()
+	if err != nil || r.Format != 32 || r.ValueLen != 1 {
+		return 0
+	}
+	return int(xgb.Get32(r.Value))
+}
+
+func (x *x11Conn) viewable(w xproto.Window) bool {
+	a, err := xproto.GetWindowAttributes(x.c, w).Reply()
+	return err == nil && a.MapState == xproto.MapStateViewable
+}
+
+func (x *x11Conn) pixel(w xproto.Window, p image.Point) (color.RGBA, error) {
+	img, err := x.capture(w, image.Rect(p.X, p.Y, p.X+1, p.Y+1))
+	if err != nil {
+		return color.RGBA{}, err
+	}
+	return img.RGBAAt(p.X, p.Y), nil
+}
+
+// capture снимает область r окна w (в его координатах) через MIT-SHM,
+// а если расширения нет — через GetImage. Область за границами окна
+// сервер не отдает, и это ошибка.
+func (x *x11Conn) capture(w xproto.Window, r image.Rectangle) (*image.RGBA, error) {
+	if r.Empty() {
+		return nil, fmt.Errorf("empty capture rectangle %v", r)
+	}
+	var (
+		data   []byte
+		depth  byte
+		visual xproto.Visualid
+	)
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.shmOK {
+		var err error
+		if data, depth, visual, err = x.shmCapture(w, r); err != nil && !errors.Is(err, errShm) {
+			return nil, err
+		}
+	}
+	if data == nil {
+		g, err := xproto.GetImage(x.c, xproto.ImageFormatZPixmap, xproto.Drawable(w),
+			int16(r.Min.X), int16(r.Min.Y), uint16(r.Dx()), uint16(r.Dy()), ^uint32(0)).Reply()
+		if err != nil {
+			return nil, fmt.Errorf("GetImage %v: %w", r, err)
+		}
+		data, depth, visual = g.Data, g.Depth, g.Visual
+	}
+	return x.decode(r, data, depth, visual)
+}
+
+// errShm — MIT-SHM недоступен; capture переходит на GetImage.
+var errShm = errors.New("MIT-SHM unavailable")
+
+func (x *x11Conn) shmCapture(w xproto.Window, r image.Rectangle) ([]byte, byte, xproto.Visualid, error) {
+	size := r.Dx() * r.Dy() * 4
+	if size > len(x.shmBuf) {
+		if err := x.shmAlloc(size); err != nil {
+			// Сервер на другой машине не видит нашу память — больше не пробуем.
+			x.shmOK = false
+			return nil, 0, 0, fmt.Errorf("%w: %v", errShm, err)
+		}
+	}
+	g, err := shm.GetImage(x.c, xproto.Drawable(w), int16(r.Min.X), int16(r.Min.Y),
+		uint16(r.Dx()), uint16(r.Dy()), ^uint32(0), xproto.ImageFormatZPixmap, x.shmSeg, 0).Reply()
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("ShmGetImage %v: %w", r, err)
+	}
+	if int(g.Size) > len(x.shmBuf) {
+		return nil, 0, 0, fmt.Errorf("%w: image of %d bytes does not fit the segment", errShm, g.Size)
+	}
+	// Буфер перезапишет следующий снимок, поэтому — копия.
+	return append([]byte(nil), x.shmBuf[:g.Size]...), g.Depth, g.Visual, nil
+}
+
+// shmAlloc заменяет сегмент разделяемой памяти на сегмент не меньше size байт.
+func (x *x11Conn) shmAlloc(size int) error {
+	if x.shmBuf != nil {
+		shm.Detach(x.c, x.shmSeg)
+		unix.SysvShmDetach(x.shmBuf)
+		x.shmBuf = nil
+	}
+	id, err := unix.SysvShmGet(unix.IPC_PRIVATE, size, unix.IPC_CREAT|0o600)
+	if err != nil {
+		return fmt.Errorf("shmget: %w", err)
+	}
+	// Сегмент удалится сам, когда от него отсоединятся и мы, и сервер.
+	defer unix.SysvShmCtl(id, unix.IPC_RMID, nil)
+	buf, err := unix.SysvShmAttach(id, 0, 0)
+	if err != nil {
+		return fmt.Errorf("shmat: %w", err)
+	}
+	seg, err := shm.NewSegId(x.c)
+	if err == nil {
+		err = shm.AttachChecked(x.c, seg, uint32(id), false).Check()
+	}
+	if err != nil {
+		unix.SysvShmDetach(buf)
+		return fmt.Errorf("ShmAttach: %w", err)
+	}
+	x.shmSeg, x.shmBuf = seg, buf
+	return nil
+}
+
+// decode переводит ZPixmap в RGBA по маскам визуала. Поддерживаются
+// TrueColor-визуалы с 32 битами на точку — так работают все современные
+// серверы, в том числе Xvfb с глубиной 24.
+func (x *x11Conn) decode(r image.Rectangle, data []byte, depth byte, visual xproto.Visualid) (*image.RGBA, error) {
+	bpp := 0
+	for _, f := range x.setup.PixmapFormats {
+		if f.Depth == depth {
+			bpp = int(f.BitsPerPixel)
+		}
+	}
+	if bpp != 32 {
+		return nil, fmt.Errorf("X11 image depth %d (%d bpp): %w", depth, bpp, ErrUnsupported)
+	}
+	vi := x.visual(visual)
+	if vi == nil || vi.Class != xproto.VisualClassTrueColor {
+		return nil, fmt.Errorf("X11 visual %#x is not TrueColor: %w", visual, ErrUnsupported)
+	}
+	n := r.Dx() * r.Dy()
+	if len(data) < n*4 {
+		return nil, fmt.Errorf("X11 image is %d bytes, want %d", len(data), n*4)
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if x.setup.ImageByteOrder != xproto.ImageOrderLSBFirst {
+		order = binary.BigEndian
+	}
+	img := image.NewRGBA(r)
+	for i := 0; i < n; i++ {
+		v := order.Uint32(data[4*i:])
+		img.Pix[4*i] = channel(v, vi.RedMask)
+		img.Pix[4*i+1] = channel(v, vi.GreenMask)
+		img.Pix[4*i+2] = channel(v, vi.BlueMask)
+		img.Pix[4*i+3] = 0xFF
+	}
+	return img, nil
+}
+
+func (x *x11Conn) visual(id xproto.Visualid) *xproto.VisualInfo {
+	for _, s := range x.setup.Roots {
+		for _, d := range s.AllowedDepths {
+			for i := range d.Visuals {
+				if d.Visuals[i].VisualId == id {
+					return &d.Visuals[i]
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// channel достает из точки компоненту по маске и приводит ее к 8 битам.
+func channel(v, mask uint32) uint8 {
+	if mask == 0 {
+		return 0
+	}
+	c := (v & mask) >> bits.TrailingZeros32(mask)
+	n := bits.OnesCount32(mask)
+	if n >= 8 {
+		return uint8(c >> (n - 8))
+	}
+	return uint8(c * 0xFF / (1<<n - 1))
+}
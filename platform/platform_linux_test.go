@@ -0,0 +1,142 @@
+package platform
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+)
+
+// freeDisplay (неэкспортируемая) возвращает номер первого незанятого дисплея
+// от first. Без Xvfb тест пропускается.
+func freeDisplay(t *testing.T, first int) int {
+	t.Helper()
+	if _, err := exec.LookPath("Xvfb"); err != nil {
+		t.Skip("Xvfb not installed")
+	}
+	for n := first; n < first+20; n++ {
+		if _, err := os.Stat(fmt.Sprintf("/tmp/.X11-unix/X%d", n)); err != nil {
+			return n
+		}
+	}
+	t.Skip("no free X display")
+	return 0
+}
+
+// startXvfb (неэкспортируемая) запускает Xvfb 640x480 на первом свободном
+// дисплее от first и возвращает его имя.
+func startXvfb(t *testing.T, first int) string {
+	t.Helper()
+	n := freeDisplay(t, first)
+	display := fmt.Sprintf(":%d", n)
+	cmd := exec.Command("Xvfb", display, "-screen", "0", "640x480x24", "-nolisten", "tcp")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		if _, err := os.Stat(fmt.Sprintf("/tmp/.X11-unix/X%d", n)); err == nil {
+			return display
+		}
+	}
+	t.Fatalf("Xvfb did not start on %s", display)
+	return ""
+}
+
+// createWindow (неэкспортируемая) показывает окно r с фоном rgb и
+// свойством _NET_WM_PID этого процесса.
+func createWindow(t *testing.T, display string, r image.Rectangle, rgb uint32) {
+	t.Helper()
+	c, err := xgb.NewConnDisplay(display)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	screen := xproto.Setup(c).DefaultScreen(c)
+	wid, err := xproto.NewWindowId(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = xproto.CreateWindowChecked(c, screen.RootDepth, wid, screen.Root,
+		int16(r.Min.X), int16(r.Min.Y), uint16(r.Dx()), uint16(r.Dy()), 0,
+		xproto.WindowClassInputOutput, screen.RootVisual,
+		xproto.CwBackPixel|xproto.CwOverrideRedirect, []uint32{rgb, 1}).Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	atom, err := xproto.InternAtom(c, false, uint16(len("_NET_WM_PID")), "_NET_WM_PID").Reply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid := binary.LittleEndian.AppendUint32(nil, uint32(os.Getpid()))
+	if err := xproto.ChangePropertyChecked(c, xproto.PropModeReplace, wid, atom.Atom, xproto.AtomCardinal, 32, 1, pid).Check(); err != nil {
+		t.Fatal(err)
+	}
+	if err := xproto.MapWindowChecked(c, wid).Check(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestX11(t *testing.T) {
+	display := startXvfb(t, 90)
+	p, err := NewX11(display)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, err := p.Desktop(); err != nil || d != image.Rect(0, 0, 640, 480) {
+		t.Fatalf("Desktop() = %v, %v; want 640x480", d, err)
+	}
+
+	at := image.Rect(100, 50, 300, 170)
+	createWindow(t, display, at, 0x20c040)
+	w, err := p.FindWindow(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, err := w.Rect(); err != nil || r != at {
+		t.Errorf("Rect() = %v, %v; want %v", r, err, at)
+	}
+	want := color.RGBA{0x20, 0xc0, 0x40, 0xff}
+	if c, err := w.Pixel(image.Pt(10, 10)); err != nil || c != want {
+		t.Errorf("window Pixel = %v, %v; want %v", c, err, want)
+	}
+	img, err := w.Capture(image.Rect(0, 0, at.Dx(), at.Dy()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := img.RGBAAt(at.Dx()-1, at.Dy()-1); c != want {
+		t.Errorf("window capture corner = %v, want %v", c, want)
+	}
+	// Экранные координаты совпадают с оконными, сдвинутыми на Rect().Min.
+	if c, err := p.Pixel(at.Min.Add(image.Pt(10, 10))); err != nil || c != want {
+		t.Errorf("desktop Pixel = %v, %v; want %v", c, err, want)
+	}
+	if _, err := p.FindWindow(os.Getpid() + 1); err == nil {
+		t.Error("FindWindow found a window of another process")
+	}
+}
+
+func TestX11RetriesConnect(t *testing.T) {
+	// Дисплея еще нет: подключение не удается, но ошибка не запоминается.
+	n := freeDisplay(t, 110)
+	p := &x11Platform{display: fmt.Sprintf(":%d", n)}
+	if _, err := p.Desktop(); err == nil {
+		t.Fatal("Desktop() succeeded before the X server started")
+	}
+	if display := startXvfb(t, n); display != p.display {
+		t.Fatalf("Xvfb took %s instead of %s", display, p.display)
+	}
+	if _, err := p.Desktop(); err != nil {
+		t.Fatalf("Desktop() after the X server came up: %v", err)
+	}
+}
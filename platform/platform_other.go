@@ -0,0 +1,67 @@
+//go:build !windows
+
+package platform
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// otherPlatform — заглушка для систем без своей реализации. Список
+// процессов читается из /proc, остальное возвращает ErrUnsupported.
+// На Linux на ней стоит x11Platform.
+type otherPlatform struct{}
+
+func (otherPlatform) CursorPosition() (image.Point, error) {
+	return image.Point{}, fmt.Errorf("cursor position: %w", ErrUnsupported)
+}
+
+func (otherPlatform) Desktop() (image.Rectangle, error) {
+	return image.Rectangle{}, fmt.Errorf("desktop bounds: %w", ErrUnsupported)
+}
+
+func (otherPlatform) Pixel(image.Point) (color.RGBA, error) {
+	return color.RGBA{}, fmt.Errorf("screen pixel: %w", ErrUnsupported)
+}
+
+func (otherPlatform) Capture(image.Rectangle) (*image.RGBA, error) {
+	return nil, fmt.Errorf("screen capture: %w", ErrUnsupported)
+}
+
+func (otherPlatform) FindWindow(int) (Window, error) {
+	return nil, fmt.Errorf("window lookup: %w", ErrUnsupported)
+}
+
+func (otherPlatform) RegisterHotkey(string, func()) (func(), error) {
+	return nil, fmt.Errorf("global hotkeys: %w", ErrUnsupported)
+}
+
+// Processes читает /proc. Имя процесса — имя исполняемого файла, а если
+// ссылка на него недоступна (чужой процесс), то содержимое comm.
+func (otherPlatform) Processes() (map[string]int, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, fmt.Errorf("process list: %w: %v", ErrUnsupported, err)
+	}
+	res := map[string]int{}
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		dir := filepath.Join("/proc", e.Name())
+		if exe, err := os.Readlink(filepath.Join(dir, "exe")); err == nil {
+			res[filepath.Base(strings.TrimSuffix(exe, " (deleted)"))] = pid
+			continue
+		}
+		if comm, err := os.ReadFile(filepath.Join(dir, "comm")); err == nil {
+			res[strings.TrimSpace(string(comm))] = pid
+		}
+	}
+	return res, nil
+}
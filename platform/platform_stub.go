@@ -0,0 +1,5 @@
+//go:build !windows && !linux
+
+package platform
+
+func current() Platform { return otherPlatform{} }
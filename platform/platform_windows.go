@@ -0,0 +1,332 @@
+package platform
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"arduino-go-bot/arduinobot/keys"
+	"golang.org/x/sys/windows"
+)
+
+var (
+	user32 = windows.NewLazySystemDLL("user32.dll")
+	gdi32  = windows.NewLazySystemDLL("gdi32.dll")
+
+	procGetCursorPos        = user32.NewProc("GetCursorPos")
+	procGetSystemMetrics    = user32.NewProc("GetSystemMetrics")
+	procGetDC               = user32.NewProc("GetDC")
+	procReleaseDC           = user32.NewProc("ReleaseDC")
+	procGetWindowRect       = user32.NewProc("GetWindowRect")
+	procRegisterHotKey      = user32.NewProc("RegisterHotKey")
+	procUnregisterHotKey    = user32.NewProc("UnregisterHotKey")
+	procGetMessageW         = user32.NewProc("GetMessageW")
+	procPostThreadMessageW  = user32.NewProc("PostThreadMessageW")
+	procGetPixel            = gdi32.NewProc("GetPixel")
+	procCreateCompatibleDC  = gdi32.NewProc("CreateCompatibleDC")
+	procCreateCompatibleBmp = gdi32.NewProc("CreateCompatibleBitmap")
+	procSelectObject        = gdi32.NewProc("SelectObject")
+	procBitBlt              = gdi32.NewProc("BitBlt")
+	procGetDIBits           = gdi32.NewProc("GetDIBits")
+	procDeleteObject        = gdi32.NewProc("DeleteObject")
+	procDeleteDC            = gdi32.NewProc("DeleteDC")
+)
+
+const (
+	smXVirtualScreen  = 76
+	smYVirtualScreen  = 77
+	smCXVirtualScreen = 78
+	smCYVirtualScreen = 79
+
+	clrInvalid  = 0xFFFFFFFF
+	srcCopy     = 0x00CC0020
+	dibRGB      = 0
+	wmHotkey    = 0x0312
+	wmQuit      = 0x0012
+	modAlt      = 0x0001
+	modControl  = 0x0002
+	modShift    = 0x0004
+	modWin      = 0x0008
+	modNoRepeat = 0x4000
+)
+
+type winPlatform struct{}
+
+func current() Platform { return winPlatform{} }
+
+func (winPlatform) CursorPosition() (image.Point, error) {
+	var pt struct{ X, Y int32 }
+	r, _, err := procGetCursorPos.Call(uintptr(unsafe.Pointer(&pt)))
+	if r == 0 {
+		return image.Point{}, fmt.Errorf("GetCursorPos: %w", err)
+	}
+	return image.Pt(int(pt.X), int(pt.Y)), nil
+}
+
+func (winPlatform) Desktop() (image.Rectangle, error) {
+	metric := func(i uintptr) int {
+		v, _, _ := procGetSystemMetrics.Call(i)
+		return int(int32(v))
+	}
+	x, y := metric(smXVirtualScreen), metric(smYVirtualScreen)
+	w, h := metric(smCXVirtualScreen), metric(smCYVirtualScreen)
+	if w <= 0 || h <= 0 {
+		return image.Rectangle{}, errors.New("GetSystemMetrics returned empty virtual screen")
+	}
+	return image.Rect(x, y, x+w, y+h), nil
+}
+
+func (winPlatform) Pixel(p image.Point) (color.RGBA, error) {
+	return pixel(0, p)
+}
+
+// pixel читает точку из контекста окна hwnd; hwnd 0 — весь рабочий стол.
+func pixel(hwnd uintptr, p image.Point) (color.RGBA, error) {
+	hdc, _, _ := procGetDC.Call(hwnd)
+	if hdc == 0 {
+		return color.RGBA{}, errors.New("GetDC failed")
+	}
+	defer procReleaseDC.Call(hwnd, hdc)
+	ref, _, _ := procGetPixel.Call(hdc, uintptr(int32(p.X)), uintptr(int32(p.Y)))
+	if ref == clrInvalid {
+		return color.RGBA{}, fmt.Errorf("pixel %v is outside the visible area", p)
+	}
+	return color.RGBA{R: uint8(ref), G: uint8(ref >> 8), B: uint8(ref >> 16), A: 0xFF}, nil
+}
+
+// bitmapInfoHeader — BITMAPINFOHEADER.
+type bitmapInfoHeader struct {
+	Size          uint32
+	Width         int32
+	Height        int32
+	Planes        uint16
+	BitCount      uint16
+	Compression   uint32
+	SizeImage     uint32
+	XPelsPerMeter int32
+	YPelsPerMeter int32
+	ClrUsed       uint32
+	ClrImportant  uint32
+}
+
+func (winPlatform) Capture(r image.Rectangle) (*image.RGBA, error) {
+	return capture(0, r)
+}
+
+// capture снимает область контекста окна hwnd; hwnd 0 — весь рабочий стол.
+func capture(hwnd uintptr, r image.Rectangle) (*image.RGBA, error) {
+	if r.Empty() {
+		return nil, fmt.Errorf("empty capture rectangle %v", r)
+	}
+	w, h := r.Dx(), r.Dy()
+	screen, _, _ := procGetDC.Call(hwnd)
+	if screen == 0 {
+		return nil, errors.New("GetDC failed")
+	}
+	defer procReleaseDC.Call(hwnd, screen)
+	mem, _, _ := procCreateCompatibleDC.Call(screen)
+	if mem == 0 {
+		return nil, errors.New("CreateCompatibleDC failed")
+	}
+	defer procDeleteDC.Call(mem)
+	bmp, _, _ := procCreateCompatibleBmp.Call(screen, uintptr(w), uintptr(h))
+	if bmp == 0 {
+		return nil, errors.New("CreateCompatibleBitmap failed")
+	}
+	defer procDeleteObject.Call(bmp)
+
+	old, _, _ := procSelectObject.Call(mem, bmp)
+	ok, _, _ := procBitBlt.Call(mem, 0, 0, uintptr(w), uintptr(h), screen,
+		uintptr(int32(r.Min.X)), uintptr(int32(r.Min.Y)), srcCopy)
+	// GetDIBits требует, чтобы битмап не был выбран в контекст.
+	procSelectObject.Call(mem, old)
+	if ok == 0 {
+		return nil, errors.New("BitBlt failed")
+	}
+
+	img := image.NewRGBA(r)
+	bi := bitmapInfoHeader{Width: int32(w), Height: -int32(h), Planes: 1, BitCount: 32}
+	bi.Size = uint32(unsafe.Sizeof(bi))
+	lines, _, _ := procGetDIBits.Call(mem, bmp, 0, uintptr(h),
+		uintptr(unsafe.Pointer(&img.Pix[0])), uintptr(unsafe.Pointer(&bi)), dibRGB)
+	if int(lines) != h {
+		return nil, errors.New("GetDIBits failed")
+	}
+	// GDI отдает BGRX.
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+2], img.Pix[i+3] = img.Pix[i+2], img.Pix[i], 0xFF
+	}
+	return img, nil
+}
+
+type winWindow uintptr
+
+// Handle возвращает HWND окна.
+func (w winWindow) Handle() uintptr { return uintptr(w) }
+
+func (w winWindow) Rect() (image.Rectangle, error) {
+	var r struct{ Left, Top, Right, Bottom int32 }
+	ok, _, _ := procGetWindowRect.Call(uintptr(w), uintptr(unsafe.Pointer(&r)))
+	if ok == 0 {
+		return image.Rectangle{}, errors.New("GetWindowRect failed")
+	}
+	return image.Rect(int(r.Left), int(r.Top), int(r.Right), int(r.Bottom)), nil
+}
+
+func (w winWindow) Pixel(p image.Point) (color.RGBA, error) {
+	return pixel(uintptr(w), p)
+}
+
+func (w winWindow) Capture(r image.Rectangle) (*image.RGBA, error) {
+	return capture(uintptr(w), r)
+}
+
+// enumMu — обратный вызов EnumWindows пишет в общую переменную.
+var enumMu sync.Mutex
+
+// FindWindow возвращает первое видимое окно процесса pid: у процесса бывают
+// скрытые служебные окна (IME, сообщения), снимать которые бессмысленно.
+func (winPlatform) FindWindow(pid int) (Window, error) {
+	enumMu.Lock()
+	defer enumMu.Unlock()
+	var found windows.HWND
+	cb := windows.NewCallback(func(h windows.HWND, _ uintptr) uintptr {
+		var procID uint32
+		windows.GetWindowThreadProcessId(h, &procID)
+		if int(procID) == pid && windows.IsWindowVisible(h) {
+			found = h
+			return 0 // прекратить перебор
+		}
+		return 1
+	})
+	// EnumWindows сообщает об ошибке и тогда, когда перебор прерван обратным вызовом.
+	_ = windows.EnumWindows(cb, nil)
+	if found == 0 {
+		return nil, fmt.Errorf("window of process %d not found", pid)
+	}
+	return winWindow(found), nil
+}
+
+func (winPlatform) Processes() (map[string]int, error) {
+	snap, err := windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return nil, fmt.Errorf("CreateToolhelp32Snapshot: %w", err)
+	}
+	defer windows.CloseHandle(snap)
+	res := map[string]int{}
+	var e windows.ProcessEntry32
+	e.Size = uint32(unsafe.Sizeof(e))
+	for err = windows.Process32First(snap, &e); err == nil; err = windows.Process32Next(snap, &e) {
+		res[windows.UTF16ToString(e.ExeFile[:])] = int(e.ProcessID)
+	}
+	return res, nil
+}
+
+var hotkeyID atomic.Uint32
+
+func (winPlatform) RegisterHotkey(chord string, fn func()) (func(), error) {
+	mod, vk, err := parseHotkey(chord)
+	if err != nil {
+		return nil, err
+	}
+	id := uintptr(hotkeyID.Add(1))
+	ready := make(chan error, 1)
+	var tid uint32
+	go func() {
+		// WM_HOTKEY приходит в очередь потока, который зарегистрировал клавишу.
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		tid = windows.GetCurrentThreadId()
+		if r, _, err := procRegisterHotKey.Call(0, id, uintptr(mod|modNoRepeat), uintptr(vk)); r == 0 {
+			ready <- fmt.Errorf("RegisterHotKey %q: %w", chord, err)
+			return
+		}
+		defer procUnregisterHotKey.Call(0, id)
+		ready <- nil
+		var m struct {
+			hwnd    uintptr
+			message uint32
+			wParam  uintptr
+			lParam  uintptr
+			time    uint32
+			pt      struct{ X, Y int32 }
+		}
+		for {
+			r, _, _ := procGetMessageW.Call(uintptr(unsafe.Pointer(&m)), 0, 0, 0)
+			if r == 0 || r == ^uintptr(0) { // WM_QUIT или ошибка
+				return
+			}
+			if m.message == wmHotkey && m.wParam == id {
+				fn()
+			}
+		}
+	}()
+	if err := <-ready; err != nil {
+		return nil, err
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() { procPostThreadMessageW.Call(uintptr(tid), wmQuit, 0, 0) })
+	}, nil
+}
+
+// virtualKeys — виртуальные коды служебных клавиш; буквы, цифры и F1–F24
+// считаются в parseHotkey.
+var virtualKeys = map[keys.Key]uint32{
+	keys.Backspace: 0x08, keys.Tab: 0x09, keys.Enter: 0x0D, keys.Pause: 0x13,
+	keys.CapsLock: 0x14, keys.Esc: 0x1B, keys.Space: 0x20, keys.PageUp: 0x21,
+	keys.PageDown: 0x22, keys.End: 0x23, keys.Home: 0x24, keys.Left: 0x25,
+	keys.Up: 0x26, keys.Right: 0x27, keys.Down: 0x28, keys.PrintScreen: 0x2C,
+	keys.Insert: 0x2D, keys.Delete: 0x2E, keys.Menu: 0x5D,
+	keys.KPAsterisk: 0x6A, keys.KPPlus: 0x6B, keys.KPMinus: 0x6D, keys.KPDot: 0x6E,
+	keys.KPSlash: 0x6F, keys.NumLock: 0x90, keys.ScrollLock: 0x91,
+}
+
+// parseHotkey разбирает "Ctrl+Shift+S" в модификаторы и виртуальный код клавиши.
+// Имена клавиш и синонимы те же, что у keys.ParseChord; левый и правый
+// модификаторы для RegisterHotKey не различаются.
+func parseHotkey(s string) (mod, vk uint32, err error) {
+	chord, err := keys.ParseChord(s)
+	if err != nil {
+		return 0, 0, fmt.Errorf("hotkey: %w", err)
+	}
+	for _, m := range chord.Modifiers {
+		switch m {
+		case keys.LeftCtrl, keys.RightCtrl:
+			mod |= modControl
+		case keys.LeftShift, keys.RightShift:
+			mod |= modShift
+		case keys.LeftAlt, keys.RightAlt:
+			mod |= modAlt
+		case keys.LeftGUI, keys.RightGUI:
+			mod |= modWin
+		}
+	}
+	k := chord.Key
+	switch {
+	case k >= 'a' && k <= 'z':
+		return mod, uint32(k - 'a' + 'A'), nil
+	case k >= '0' && k <= '9':
+		return mod, uint32(k), nil
+	case k >= keys.F1 && k <= keys.F12:
+		return mod, 0x70 + uint32(k-keys.F1), nil // VK_F1
+	case k >= keys.F13 && k <= keys.F24:
+		return mod, 0x7C + uint32(k-keys.F13), nil // VK_F13
+	case k >= keys.KP1 && k <= keys.KP9:
+		return mod, 0x61 + uint32(k-keys.KP1), nil // VK_NUMPAD1
+	case k == keys.KP0:
+		return mod, 0x60, nil
+	}
+	if vk, ok := virtualKeys[k]; ok {
+		return mod, vk, nil
+	}
+	if k == 0 {
+		return 0, 0, fmt.Errorf("hotkey %q has no key besides modifiers", s)
+	}
+	return 0, 0, fmt.Errorf("hotkey %q: %s cannot be a global hotkey", s, k)
+}
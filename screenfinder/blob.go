@@ -0,0 +1,184 @@
+package screenfinder
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"sort"
+)
+
+// Region — область поиска в координатах окна: многоугольник Polygon или,
+// если его нет, прямоугольник от Min включительно до Max не включительно.
+type Region struct {
+	Min     Coord   `json:"min,omitzero"`
+	Max     Coord   `json:"max,omitzero"`
+	Polygon []Coord `json:"polygon,omitempty"`
+}
+
+// Rect возвращает прямоугольную область.
+func Rect(x0, y0, x1, y1 int32) Region {
+	return Region{Min: Coord{X: x0, Y: y0}, Max: Coord{X: x1, Y: y1}}
+}
+
+// Bounds возвращает прямоугольник, в который вписана область.
+func (r Region) Bounds() image.Rectangle {
+	if len(r.Polygon) == 0 {
+		return image.Rect(int(r.Min.X), int(r.Min.Y), int(r.Max.X), int(r.Max.Y))
+	}
+	return Bounds(r.Polygon)
+}
+
+// Contains сообщает, попадает ли точка в область. Точка многоугольника —
+// пиксель, чей центр лежит внутри (по правилу чет-нечет).
+func (r Region) Contains(x, y int) bool {
+	if len(r.Polygon) == 0 {
+		return image.Pt(x, y).In(r.Bounds())
+	}
+	px, py := float64(x)+0.5, float64(y)+0.5
+	in := false
+	for i, j := 0, len(r.Polygon)-1; i < len(r.Polygon); j, i = i, i+1 {
+		xi, yi := float64(r.Polygon[i].X), float64(r.Polygon[i].Y)
+		xj, yj := float64(r.Polygon[j].X), float64(r.Polygon[j].Y)
+		if (yi > py) != (yj > py) && px < (xj-xi)*(py-yi)/(yj-yi)+xi {
+			in = !in
+		}
+	}
+	return in
+}
+
+func (r Region) validate() error {
+	if len(r.Polygon) > 0 && len(r.Polygon) < 3 {
+		return fmt.Errorf("region polygon needs at least 3 points, got %d", len(r.Polygon))
+	}
+	if r.Bounds().Empty() {
+		return fmt.Errorf("region %v is empty", r.Bounds())
+	}
+	return nil
+}
+
+// BlobFilter отсеивает пятна по размеру. Нулевое поле — без ограничения.
+type BlobFilter struct {
+	MinPixels int `json:"minPixels,omitempty"`
+	MaxPixels int `json:"maxPixels,omitempty"`
+	MinWidth  int `json:"minWidth,omitempty"`
+	MaxWidth  int `json:"maxWidth,omitempty"`
+	MinHeight int `json:"minHeight,omitempty"`
+	MaxHeight int `json:"maxHeight,omitempty"`
+}
+
+func (b BlobFilter) accepts(t Target) bool {
+	in := func(v, lo, hi int) bool { return v >= lo && (hi == 0 || v <= hi) }
+	return in(t.Pixels, b.MinPixels, b.MaxPixels) &&
+		in(t.Bounds.Dx(), b.MinWidth, b.MaxWidth) &&
+		in(t.Bounds.Dy(), b.MinHeight, b.MaxHeight)
+}
+
+// Target — пятно подходящих точек, связанных по сторонам и углам.
+// Centroid — центр масс пятна, по нему стоит кликать: у вогнутого пятна
+// он может лежать вне его точек, но внутри Bounds.
+type Target struct {
+	Centroid Coord
+	Bounds   image.Rectangle
+	Pixels   int
+}
+
+// Targets снимает кадр и ищет на нем цели в Regions.
+func (f *Finder) Targets() ([]Target, error) {
+	frame, err := f.Frame()
+	if err != nil {
+		return nil, err
+	}
+	return f.TargetsIn(frame)
+}
+
+// TargetsIn ищет в Regions на кадре точки цвета цели, собирает их в пятна,
+// отсеивает пятна по Blobs и возвращает цели от самой крупной к самой мелкой.
+// Части областей за границами кадра не просматриваются.
+func (f *Finder) TargetsIn(frame *image.RGBA) ([]Target, error) {
+	if len(f.Regions) == 0 {
+		return nil, nil
+	}
+	match, err := f.matcher()
+	if err != nil {
+		return nil, err
+	}
+	var area image.Rectangle
+	for _, reg := range f.Regions {
+		area = area.Union(reg.Bounds())
+	}
+	area = area.Intersect(frame.Rect)
+	w, h := area.Dx(), area.Dy()
+	mask := make([]bool, w*h)
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			c := frame.RGBAAt(x, y)
+			if !match(Color{R: c.R, G: c.G, B: c.B}) {
+				continue
+			}
+			for _, reg := range f.Regions {
+				if reg.Contains(x, y) {
+					mask[(y-area.Min.Y)*w+x-area.Min.X] = true
+					break
+				}
+			}
+		}
+	}
+
+	var targets []Target
+	var stack []int
+	for start := range mask {
+		if !mask[start] {
+			continue
+		}
+		mask[start] = false
+		stack = append(stack[:0], start)
+		var sumX, sumY, n int
+		bounds := image.Rectangle{Min: image.Pt(w, h)}
+		for len(stack) > 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			x, y := i%w, i/w
+			sumX, sumY, n = sumX+x, sumY+y, n+1
+			bounds.Min.X, bounds.Min.Y = min(bounds.Min.X, x), min(bounds.Min.Y, y)
+			bounds.Max.X, bounds.Max.Y = max(bounds.Max.X, x+1), max(bounds.Max.Y, y+1)
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					nx, ny := x+dx, y+dy
+					if nx < 0 || ny < 0 || nx >= w || ny >= h || !mask[ny*w+nx] {
+						continue
+					}
+					mask[ny*w+nx] = false
+					stack = append(stack, ny*w+nx)
+				}
+			}
+		}
+		t := Target{
+			Centroid: Coord{
+				X: int32(area.Min.X + (2*sumX+n)/(2*n)),
+				Y: int32(area.Min.Y + (2*sumY+n)/(2*n)),
+			},
+			Bounds: bounds.Add(area.Min),
+			Pixels: n,
+		}
+		if f.Blobs.accepts(t) {
+			targets = append(targets, t)
+		}
+	}
+	sort.SliceStable(targets, func(i, j int) bool { return targets[i].Pixels > targets[j].Pixels })
+	return targets, nil
+}
+
+// validateRegions (неэкспортируемая) проверяет Regions и Blobs.
+func (f *Finder) validateRegions() error {
+	for _, reg := range f.Regions {
+		if err := reg.validate(); err != nil {
+			return err
+		}
+	}
+	b := f.Blobs
+	if b.MaxPixels > 0 && b.MaxPixels < b.MinPixels || b.MaxWidth > 0 && b.MaxWidth < b.MinWidth ||
+		b.MaxHeight > 0 && b.MaxHeight < b.MinHeight {
+		return errors.New("blob filter: a maximum is below its minimum")
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package screenfinder
+
+import (
+	"image"
+	"testing"
+)
+
+// pixels (неэкспортируемая) возвращает точки 0..size-1 по обеим осям,
+// которые попадают в область.
+func pixels(r Region, size int) map[image.Point]bool {
+	in := make(map[image.Point]bool)
+	for y := -1; y <= size; y++ {
+		for x := -1; x <= size; x++ {
+			if r.Contains(x, y) {
+				in[image.Pt(x, y)] = true
+			}
+		}
+	}
+	return in
+}
+
+func TestRegionContains(t *testing.T) {
+	// Квадрат-многоугольник и прямоугольник с теми же углами покрывают
+	// одни и те же точки: Min включительно, Max нет.
+	square := Region{Polygon: []Coord{{2, 2}, {8, 2}, {8, 8}, {2, 8}}}
+	rect := Rect(2, 2, 8, 8)
+	sq, rc := pixels(square, 10), pixels(rect, 10)
+	if len(sq) != 36 || len(rc) != 36 {
+		t.Fatalf("square covers %d points, rectangle %d; want 36", len(sq), len(rc))
+	}
+	for p := range rc {
+		if !sq[p] {
+			t.Errorf("%v is in the rectangle but not in the polygon", p)
+		}
+	}
+	for _, p := range []image.Point{{2, 2}, {7, 2}, {2, 7}, {7, 7}} {
+		if !rect.Contains(p.X, p.Y) || !square.Contains(p.X, p.Y) {
+			t.Errorf("corner pixel %v is outside", p)
+		}
+	}
+	for _, p := range []image.Point{{8, 5}, {5, 8}, {1, 5}, {5, 1}} {
+		if rect.Contains(p.X, p.Y) || square.Contains(p.X, p.Y) {
+			t.Errorf("pixel %v past the edge is inside", p)
+		}
+	}
+
+	// Наклонная сторона 2x+y=20 не проходит через центры точек: внутри
+	// те, у которых 2x+y <= 18, — по 19-2x в каждом столбце.
+	triangle := Region{Polygon: []Coord{{0, 0}, {10, 0}, {0, 20}}}
+	in := pixels(triangle, 20)
+	if len(in) != 100 {
+		t.Errorf("triangle covers %d points, want 100", len(in))
+	}
+	for p := range in {
+		if 2*p.X+p.Y > 18 {
+			t.Errorf("%v is past the slanted edge", p)
+		}
+	}
+	for _, p := range []image.Point{{0, 18}, {9, 0}, {4, 10}} {
+		if !in[p] {
+			t.Errorf("edge pixel %v is outside", p)
+		}
+	}
+	for _, p := range []image.Point{{0, 19}, {9, 1}, {5, 9}} {
+		if in[p] {
+			t.Errorf("pixel %v past the edge is inside", p)
+		}
+	}
+	if b := triangle.Bounds(); b != image.Rect(0, 0, 11, 21) {
+		t.Errorf("triangle bounds %v", b)
+	}
+}
+
+func TestTargetsConnectivity(t *testing.T) {
+	tests := []struct {
+		name   string
+		pixels []image.Point
+		want   []int // размеры пятен от большего к меньшему
+	}{
+		{"diagonal neighbours", []image.Point{{5, 5}, {6, 6}, {7, 7}}, []int{3}},
+		{"anti-diagonal", []image.Point{{5, 7}, {6, 6}, {7, 5}}, []int{3}},
+		{"one point gap", []image.Point{{5, 5}, {7, 5}, {5, 7}}, []int{1, 1, 1}},
+		{"checkerboard", []image.Point{{2, 2}, {4, 2}, {3, 3}, {2, 4}, {4, 4}, {9, 9}}, []int{5, 1}},
+		{"ring", []image.Point{{1, 1}, {2, 1}, {3, 1}, {1, 2}, {3, 2}, {1, 3}, {2, 3}, {3, 3}}, []int{8}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame := solid(image.Rect(0, 0, 12, 12), gray)
+			for _, p := range tt.pixels {
+				frame.SetRGBA(p.X, p.Y, red)
+			}
+			f := &Finder{TargetColor: Color{R: 0xff}, Regions: []Region{Rect(0, 0, 12, 12)}}
+			targets, err := f.TargetsIn(frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []int
+			for _, tg := range targets {
+				got = append(got, tg.Pixels)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("blobs %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("blobs %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestTargetsInPolygon(t *testing.T) {
+	// Весь кадр красный: пятно — ровно точки многоугольника.
+	frame := solid(image.Rect(0, 0, 30, 30), red)
+	f := &Finder{TargetColor: Color{R: 0xff}, Regions: []Region{{Polygon: []Coord{{0, 0}, {10, 0}, {0, 20}}}}}
+	targets, err := f.TargetsIn(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 1 || targets[0].Pixels != 100 || targets[0].Bounds != image.Rect(0, 0, 10, 19) {
+		t.Fatalf("targets %+v, want one of 100 points in (0,0)-(10,19)", targets)
+	}
+
+	// Область, вылезающая за кадр, просматривается в его пределах.
+	f.Regions = []Region{Rect(25, -5, 40, 5)}
+	targets, err = f.TargetsIn(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 1 || targets[0].Bounds != image.Rect(25, 0, 30, 5) {
+		t.Errorf("targets %+v, want the visible 5x5 corner", targets)
+	}
+}
+
+func TestBlobFilter(t *testing.T) {
+	// Пятна 1x1, 3x3, 5x2 и 8x8 далеко друг от друга.
+	frame := solid(image.Rect(0, 0, 40, 40), gray)
+	blobs := []image.Rectangle{
+		image.Rect(1, 1, 2, 2),
+		image.Rect(10, 10, 13, 13),
+		image.Rect(20, 2, 25, 4),
+		image.Rect(2, 25, 10, 33),
+	}
+	for _, r := range blobs {
+		paint(frame, r, red)
+	}
+	tests := []struct {
+		name   string
+		filter BlobFilter
+		want   []int // размеры от большего к меньшему
+	}{
+		{"none", BlobFilter{}, []int{64, 10, 9, 1}},
+		{"min pixels inclusive", BlobFilter{MinPixels: 9}, []int{64, 10, 9}},
+		{"max pixels inclusive", BlobFilter{MaxPixels: 10}, []int{10, 9, 1}},
+		{"pixel band", BlobFilter{MinPixels: 2, MaxPixels: 63}, []int{10, 9}},
+		{"min width", BlobFilter{MinWidth: 5}, []int{64, 10}},
+		{"max width", BlobFilter{MaxWidth: 3}, []int{9, 1}},
+		{"min height", BlobFilter{MinHeight: 3}, []int{64, 9}},
+		{"max height", BlobFilter{MaxHeight: 2}, []int{10, 1}},
+		{"width and height", BlobFilter{MinWidth: 3, MaxWidth: 5, MinHeight: 3}, []int{9}},
+		{"nothing fits", BlobFilter{MinPixels: 65}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &Finder{TargetColor: Color{R: 0xff}, Regions: []Region{Rect(0, 0, 40, 40)}, Blobs: tt.filter}
+			if err := f.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			targets, err := f.TargetsIn(frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []int
+			for _, tg := range targets {
+				got = append(got, tg.Pixels)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("blobs %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("blobs %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+
+	f := &Finder{TargetColor: Color{R: 0xff}, Regions: []Region{Rect(0, 0, 40, 40)}}
+	targets, _ := f.TargetsIn(frame)
+	if c := targets[2].Centroid; c != (Coord{X: 11, Y: 11}) {
+		t.Errorf("3x3 blob centroid %v, want (11,11)", c)
+	}
+}
+
+func TestValidateRegions(t *testing.T) {
+	for _, f := range []*Finder{
+		{Regions: []Region{{Polygon: []Coord{{0, 0}, {5, 5}}}}},
+		{Regions: []Region{Rect(5, 5, 5, 10)}},
+		{Regions: []Region{Rect(0, 0, 10, 10)}, Blobs: BlobFilter{MinPixels: 10, MaxPixels: 5}},
+		{Regions: []Region{Rect(0, 0, 10, 10)}, Blobs: BlobFilter{MinWidth: 4, MaxWidth: 3}},
+		{Regions: []Region{Rect(0, 0, 10, 10)}, Blobs: BlobFilter{MinHeight: 4, MaxHeight: 3}},
+	} {
+		if err := f.Validate(); err == nil {
+			t.Errorf("Validate accepted regions %v with filter %+v", f.Regions, f.Blobs)
+		}
+	}
+}
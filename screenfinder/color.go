@@ -0,0 +1,248 @@
+package screenfinder
+
+import (
+	"fmt"
+	"math"
+)
+
+// Metric — способ сравнения цвета в ColorRule.
+type Metric string
+
+const (
+	// MetricExact — цвет совпадает с Color до единицы.
+	MetricExact Metric = "exact"
+	// MetricChannel — каждый канал отличается от Color не больше чем на Tolerance.
+	MetricChannel Metric = "channel"
+	// MetricDistance — евклидово расстояние в RGB до Color не больше Tolerance
+	// (от 0 до 441).
+	MetricDistance Metric = "distance"
+	// MetricHSV — тон, насыщенность и яркость попадают в диапазоны Hue, Sat
+	// и Val; Color не нужен.
+	MetricHSV Metric = "hsv"
+	// MetricDeltaE — цветовое отличие CIEDE2000 от Color не больше Tolerance.
+	// Около 1 — разница на грани заметного, 2–5 — заметна рядом, больше 10 —
+	// другой цвет.
+	MetricDeltaE Metric = "deltaE"
+)
+
+// Range — диапазон [min, max] включительно. Нулевой диапазон — любое значение.
+type Range [2]float64
+
+func (r Range) any() bool { return r == Range{} }
+
+func (r Range) contains(v float64) bool { return r.any() || v >= r[0] && v <= r[1] }
+
+// containsHue (неэкспортируемая) проверяет тон на круге: диапазон с min больше
+// max проходит через 0, так [340, 20] — красные.
+func (r Range) containsHue(h float64) bool {
+	if r.any() || r[0] <= r[1] {
+		return r.contains(h)
+	}
+	return h >= r[0] || h <= r[1]
+}
+
+// ColorRule — правило, по которому точка кадра считается цветом цели.
+// Задается в config.json, например
+//
+//	{"match": "channel", "tolerance": 12}
+//	{"match": "deltaE", "color": {"r": 200, "g": 30, "b": 30}, "tolerance": 8}
+//	{"match": "hsv", "hue": [340, 20], "sat": [0.5, 1], "val": [0.3, 1]}
+//
+// Правило без color сравнивает с Finder.TargetColor.
+type ColorRule struct {
+	Match     Metric  `json:"match"`
+	Color     *Color  `json:"color,omitempty"`
+	Tolerance float64 `json:"tolerance,omitempty"`
+	// Hue — тон в градусах 0..360, Sat и Val — насыщенность и яркость 0..1.
+	Hue Range `json:"hue,omitzero"`
+	Sat Range `json:"sat,omitzero"`
+	Val Range `json:"val,omitzero"`
+}
+
+// Matcher возвращает проверку цвета по правилу; target заменяет
+// отсутствующий Color. Ошибка — правило задано неверно.
+func (r ColorRule) Matcher(target Color) (func(Color) bool, error) {
+	if r.Color != nil {
+		target = *r.Color
+	}
+	if r.Tolerance < 0 {
+		return nil, fmt.Errorf("color rule %q: negative tolerance %g", r.Match, r.Tolerance)
+	}
+	switch r.Match {
+	case MetricExact, "":
+		return func(c Color) bool { return c == target }, nil
+	case MetricChannel:
+		return func(c Color) bool {
+			return math.Abs(float64(c.R)-float64(target.R)) <= r.Tolerance &&
+				math.Abs(float64(c.G)-float64(target.G)) <= r.Tolerance &&
+				math.Abs(float64(c.B)-float64(target.B)) <= r.Tolerance
+		}, nil
+	case MetricDistance:
+		limit := r.Tolerance * r.Tolerance
+		return func(c Color) bool {
+			dr, dg, db := float64(c.R)-float64(target.R), float64(c.G)-float64(target.G), float64(c.B)-float64(target.B)
+			return dr*dr+dg*dg+db*db <= limit
+		}, nil
+	case MetricHSV:
+		for _, rg := range []Range{r.Sat, r.Val} {
+			if rg[0] > rg[1] {
+				return nil, fmt.Errorf("color rule %q: bad range %v", r.Match, rg)
+			}
+		}
+		return func(c Color) bool {
+			h, s, v := c.HSV()
+			return r.Hue.containsHue(h) && r.Sat.contains(s) && r.Val.contains(v)
+		}, nil
+	case MetricDeltaE:
+		want := target.Lab()
+		return func(c Color) bool { return DeltaE(c.Lab(), want) <= r.Tolerance }, nil
+	}
+	return nil, fmt.Errorf("unknown color match %q", r.Match)
+}
+
+// matcher (неэкспортируемая) собирает Rules в одну проверку: подходит цвет,
+// подходящий хоть под одно правило. Без правил — точное совпадение с TargetColor.
+func (f *Finder) matcher() (func(Color) bool, error) {
+	if len(f.Rules) == 0 {
+		return ColorRule{}.Matcher(f.TargetColor)
+	}
+	matchers := make([]func(Color) bool, len(f.Rules))
+	for i, rule := range f.Rules {
+		m, err := rule.Matcher(f.TargetColor)
+		if err != nil {
+			return nil, err
+		}
+		matchers[i] = m
+	}
+	if len(matchers) == 1 {
+		return matchers[0], nil
+	}
+	return func(c Color) bool {
+		for _, m := range matchers {
+			if m(c) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// HSV возвращает тон в градусах [0, 360), насыщенность и яркость 0..1.
+// У серых тон 0.
+func (c Color) HSV() (h, s, v float64) {
+	r, g, b := float64(c.R)/255, float64(c.G)/255, float64(c.B)/255
+	hi, lo := max(r, g, b), min(r, g, b)
+	v = hi
+	d := hi - lo
+	if hi > 0 {
+		s = d / hi
+	}
+	switch {
+	case d == 0:
+		h = 0
+	case hi == r:
+		h = math.Mod((g-b)/d, 6)
+	case hi == g:
+		h = (b-r)/d + 2
+	default:
+		h = (r-g)/d + 4
+	}
+	h *= 60
+	if h < 0 {
+		h += 360
+	}
+	return h, s, v
+}
+
+// Lab — цвет в пространстве CIE L*a*b* (белая точка D65).
+type Lab struct {
+	L, A, B float64
+}
+
+// Lab переводит цвет sRGB в CIE L*a*b*.
+func (c Color) Lab() Lab {
+	lin := func(v uint8) float64 {
+		x := float64(v) / 255
+		if x <= 0.04045 {
+			return x / 12.92
+		}
+		return math.Pow((x+0.055)/1.055, 2.4)
+	}
+	r, g, b := lin(c.R), lin(c.G), lin(c.B)
+	x := (0.4124564*r + 0.3575761*g + 0.1804375*b) / 0.95047
+	y := 0.2126729*r + 0.7151522*g + 0.0721750*b
+	z := (0.0193339*r + 0.1191920*g + 0.9503041*b) / 1.08883
+	const e = 6.0 / 29
+	f := func(t float64) float64 {
+		if t > e*e*e {
+			return math.Cbrt(t)
+		}
+		return t/(3*e*e) + 4.0/29
+	}
+	fx, fy, fz := f(x), f(y), f(z)
+	return Lab{L: 116*fy - 16, A: 500 * (fx - fy), B: 200 * (fy - fz)}
+}
+
+// DeltaE возвращает цветовое отличие CIEDE2000 между p и q.
+func DeltaE(p, q Lab) float64 {
+	const pow25 = 6103515625 // 25^7
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	hue := func(b, a float64) float64 {
+		if a == 0 && b == 0 {
+			return 0
+		}
+		h := math.Atan2(b, a) * 180 / math.Pi
+		if h < 0 {
+			h += 360
+		}
+		return h
+	}
+
+	cBar := (math.Hypot(p.A, p.B) + math.Hypot(q.A, q.B)) / 2
+	c7 := math.Pow(cBar, 7)
+	g := 0.5 * (1 - math.Sqrt(c7/(c7+pow25)))
+	a1, a2 := (1+g)*p.A, (1+g)*q.A
+	c1, c2 := math.Hypot(a1, p.B), math.Hypot(a2, q.B)
+	h1, h2 := hue(p.B, a1), hue(q.B, a2)
+
+	dL := q.L - p.L
+	dC := c2 - c1
+	var dh float64
+	if c1*c2 != 0 {
+		dh = h2 - h1
+		switch {
+		case dh > 180:
+			dh -= 360
+		case dh < -180:
+			dh += 360
+		}
+	}
+	dH := 2 * math.Sqrt(c1*c2) * math.Sin(rad(dh/2))
+
+	lBar := (p.L + q.L) / 2
+	cBar = (c1 + c2) / 2
+	hBar := h1 + h2
+	if c1*c2 != 0 {
+		switch {
+		case math.Abs(h1-h2) <= 180:
+			hBar /= 2
+		case hBar < 360:
+			hBar = (hBar + 360) / 2
+		default:
+			hBar = (hBar - 360) / 2
+		}
+	}
+	t := 1 - 0.17*math.Cos(rad(hBar-30)) + 0.24*math.Cos(rad(2*hBar)) +
+		0.32*math.Cos(rad(3*hBar+6)) - 0.20*math.Cos(rad(4*hBar-63))
+	dTheta := 30 * math.Exp(-math.Pow((hBar-275)/25, 2))
+	c7 = math.Pow(cBar, 7)
+	rc := 2 * math.Sqrt(c7/(c7+pow25))
+	l50 := (lBar - 50) * (lBar - 50)
+	sl := 1 + 0.015*l50/math.Sqrt(20+l50)
+	sc := 1 + 0.045*cBar
+	sh := 1 + 0.015*cBar*t
+	rt := -math.Sin(rad(2*dTheta)) * rc
+
+	l, c, h := dL/sl, dC/sc, dH/sh
+	return math.Sqrt(l*l + c*c + h*h + rt*c*h)
+}
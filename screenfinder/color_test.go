@@ -0,0 +1,213 @@
+package screenfinder
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"slices"
+	"testing"
+)
+
+// palette — цвета клеток кадра в TestColorRules.
+var palette = []Color{
+	{255, 0, 0},     // 0 красный
+	{200, 30, 30},   // 1 темно-красный
+	{255, 0, 40},    // 2 малиновый, тон 350.6
+	{255, 128, 0},   // 3 оранжевый, тон 30
+	{250, 5, 5},     // 4 почти красный
+	{0, 255, 0},     // 5 зеленый
+	{128, 128, 128}, // 6 серый
+	{255, 180, 180}, // 7 бледно-розовый, насыщенность 0.29
+	{205, 35, 30},   // 8 ржавый, рядом с темно-красным
+	{190, 40, 35},   // 9 кирпичный, рядом с темно-красным
+}
+
+// swatches (неэкспортируемая) рисует palette клетками 6x6 через 4 точки
+// на черном фоне и возвращает кадр и области клеток.
+func swatches() (*image.RGBA, []Region) {
+	frame := solid(image.Rect(0, 0, 10*len(palette), 10), color.RGBA{A: 0xff})
+	var cells []Region
+	for i, c := range palette {
+		r := image.Rect(10*i, 2, 10*i+6, 8)
+		paint(frame, r, color.RGBA{c.R, c.G, c.B, 0xff})
+		cells = append(cells, Rect(int32(r.Min.X), int32(r.Min.Y), int32(r.Max.X), int32(r.Max.Y)))
+	}
+	return frame, cells
+}
+
+func TestColorRules(t *testing.T) {
+	darkRed := &palette[1]
+	tests := []struct {
+		name  string
+		rules []ColorRule
+		want  []int // номера подходящих клеток palette
+	}{
+		{"exact target", []ColorRule{{}}, []int{0}},
+		{"exact color", []ColorRule{{Match: MetricExact, Color: darkRed}}, []int{1}},
+		{"channel", []ColorRule{{Match: MetricChannel, Color: darkRed, Tolerance: 12}}, []int{1, 8, 9}},
+		{"distance", []ColorRule{{Match: MetricDistance, Tolerance: 10}}, []int{0, 4}},
+		{"hsv wraps through 0", []ColorRule{{Match: MetricHSV, Hue: Range{340, 20}, Sat: Range{0.5, 1}, Val: Range{0.3, 1}}}, []int{0, 1, 2, 4, 8, 9}},
+		{"hsv without wrap", []ColorRule{{Match: MetricHSV, Hue: Range{20, 340}}}, []int{3, 5}},
+		{"hsv value only", []ColorRule{{Match: MetricHSV, Val: Range{0, 0.6}}}, []int{6}},
+		{"deltaE to color", []ColorRule{{Match: MetricDeltaE, Color: darkRed, Tolerance: 3}}, []int{1, 8, 9}},
+		{"deltaE to target", []ColorRule{{Match: MetricDeltaE, Tolerance: 6}}, []int{0, 2, 4}},
+		{"any of rules", []ColorRule{{Match: MetricExact, Color: &palette[5]}, {Match: MetricDistance, Tolerance: 10}}, []int{0, 4, 5}},
+	}
+	frame, cells := swatches()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &Finder{TargetColor: palette[0], Rules: tt.rules, Regions: cells}
+			targets, err := f.TargetsIn(frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []int
+			for _, tg := range targets {
+				if tg.Pixels != 36 {
+					t.Errorf("cell at %v matched %d of 36 pixels", tg.Bounds, tg.Pixels)
+				}
+				got = append(got, tg.Bounds.Min.X/10)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("matched cells %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestColorRuleErrors(t *testing.T) {
+	for _, r := range []ColorRule{
+		{Match: MetricChannel, Tolerance: -1},
+		{Match: "rgb"},
+		{Match: MetricHSV, Sat: Range{1, 0.5}},
+		{Match: MetricHSV, Val: Range{0.8, 0.2}},
+	} {
+		if _, err := r.Matcher(Color{}); err == nil {
+			t.Errorf("Matcher accepted %+v", r)
+		}
+		if err := (&Finder{Rules: []ColorRule{r}}).Validate(); err == nil {
+			t.Errorf("Validate accepted %+v", r)
+		}
+	}
+}
+
+func TestHSV(t *testing.T) {
+	tests := []struct {
+		c       Color
+		h, s, v float64
+	}{
+		{Color{255, 0, 0}, 0, 1, 1},
+		{Color{255, 255, 0}, 60, 1, 1},
+		{Color{0, 255, 0}, 120, 1, 1},
+		{Color{0, 255, 255}, 180, 1, 1},
+		{Color{0, 0, 255}, 240, 1, 1},
+		{Color{255, 0, 255}, 300, 1, 1},
+		{Color{255, 0, 128}, 329.882, 1, 1},
+		{Color{128, 64, 64}, 0, 0.5, 0.502},
+		{Color{0, 0, 0}, 0, 0, 0},
+		{Color{255, 255, 255}, 0, 0, 1},
+		{Color{128, 128, 128}, 0, 0, 0.502},
+	}
+	for _, tt := range tests {
+		h, s, v := tt.c.HSV()
+		if math.Abs(h-tt.h) > 1e-3 || math.Abs(s-tt.s) > 1e-3 || math.Abs(v-tt.v) > 1e-3 {
+			t.Errorf("%v.HSV() = %.3f, %.3f, %.3f; want %.3f, %.3f, %.3f", tt.c, h, s, v, tt.h, tt.s, tt.v)
+		}
+	}
+}
+
+func TestHueRange(t *testing.T) {
+	tests := []struct {
+		r    Range
+		h    float64
+		want bool
+	}{
+		{Range{340, 20}, 350, true},
+		{Range{340, 20}, 0, true},
+		{Range{340, 20}, 20, true},
+		{Range{340, 20}, 340, true},
+		{Range{340, 20}, 21, false},
+		{Range{340, 20}, 180, false},
+		{Range{20, 340}, 0, false},
+		{Range{20, 340}, 180, true},
+		{Range{}, 200, true},
+	}
+	for _, tt := range tests {
+		if got := tt.r.containsHue(tt.h); got != tt.want {
+			t.Errorf("%v.containsHue(%g) = %v, want %v", tt.r, tt.h, got, tt.want)
+		}
+	}
+}
+
+func TestLab(t *testing.T) {
+	tests := []struct {
+		c    Color
+		want Lab
+	}{
+		{Color{255, 255, 255}, Lab{100, 0, 0}},
+		{Color{0, 0, 0}, Lab{0, 0, 0}},
+		{Color{255, 0, 0}, Lab{53.24, 80.09, 67.20}},
+		{Color{0, 255, 0}, Lab{87.73, -86.18, 83.18}},
+		{Color{0, 0, 255}, Lab{32.30, 79.19, -107.86}},
+	}
+	for _, tt := range tests {
+		got := tt.c.Lab()
+		if math.Abs(got.L-tt.want.L) > 0.01 || math.Abs(got.A-tt.want.A) > 0.01 || math.Abs(got.B-tt.want.B) > 0.01 {
+			t.Errorf("%v.Lab() = %.2f, want %.2f", tt.c, got, tt.want)
+		}
+	}
+}
+
+// TestDeltaE сверяет DeltaE с тестовыми парами Sharma, Wu и Dalal,
+// "The CIEDE2000 color-difference formula" (2005), таблица 1.
+func TestDeltaE(t *testing.T) {
+	tests := []struct {
+		p, q Lab
+		want float64
+	}{
+		{Lab{50, 2.6772, -79.7751}, Lab{50, 0, -82.7485}, 2.0425},
+		{Lab{50, 3.1571, -77.2803}, Lab{50, 0, -82.7485}, 2.8615},
+		{Lab{50, 2.8361, -74.0200}, Lab{50, 0, -82.7485}, 3.4412},
+		{Lab{50, -1.3802, -84.2814}, Lab{50, 0, -82.7485}, 1.0000},
+		{Lab{50, -1.1848, -84.8006}, Lab{50, 0, -82.7485}, 1.0000},
+		{Lab{50, -0.9009, -85.5211}, Lab{50, 0, -82.7485}, 1.0000},
+		{Lab{50, 0, 0}, Lab{50, -1, 2}, 2.3669},
+		{Lab{50, -1, 2}, Lab{50, 0, 0}, 2.3669},
+		{Lab{50, 2.4900, -0.0010}, Lab{50, -2.4900, 0.0009}, 7.1792},
+		{Lab{50, 2.4900, -0.0010}, Lab{50, -2.4900, 0.0010}, 7.1792},
+		{Lab{50, 2.4900, -0.0010}, Lab{50, -2.4900, 0.0011}, 7.2195},
+		{Lab{50, 2.4900, -0.0010}, Lab{50, -2.4900, 0.0012}, 7.2195},
+		{Lab{50, -0.0010, 2.4900}, Lab{50, 0.0009, -2.4900}, 4.8045},
+		{Lab{50, -0.0010, 2.4900}, Lab{50, 0.0010, -2.4900}, 4.8045},
+		{Lab{50, -0.0010, 2.4900}, Lab{50, 0.0011, -2.4900}, 4.7461},
+		{Lab{50, 2.5, 0}, Lab{50, 0, -2.5}, 4.3065},
+		{Lab{50, 2.5, 0}, Lab{73, 25, -18}, 27.1492},
+		{Lab{50, 2.5, 0}, Lab{61, -5, 29}, 22.8977},
+		{Lab{50, 2.5, 0}, Lab{56, -27, -3}, 31.9030},
+		{Lab{50, 2.5, 0}, Lab{58, 24, 15}, 19.4535},
+		{Lab{50, 2.5, 0}, Lab{50, 3.1736, 0.5854}, 1.0000},
+		{Lab{50, 2.5, 0}, Lab{50, 3.2972, 0}, 1.0000},
+		{Lab{50, 2.5, 0}, Lab{50, 1.8634, 0.5757}, 1.0000},
+		{Lab{50, 2.5, 0}, Lab{50, 3.2592, 0.3350}, 1.0000},
+		{Lab{60.2574, -34.0099, 36.2677}, Lab{60.4626, -34.1751, 39.4387}, 1.2644},
+		{Lab{63.0109, -31.0961, -5.8663}, Lab{62.8187, -29.7946, -4.0864}, 1.2630},
+		{Lab{61.2901, 3.7196, -5.3901}, Lab{61.4292, 2.2480, -4.9620}, 1.8731},
+		{Lab{35.0831, -44.1164, 3.7933}, Lab{35.0232, -40.0716, 1.5901}, 1.8645},
+		{Lab{22.7233, 20.0904, -46.6940}, Lab{23.0331, 14.9730, -42.5619}, 2.0373},
+		{Lab{36.4612, 47.8580, 18.3852}, Lab{36.2715, 50.5065, 21.2231}, 1.4146},
+		{Lab{90.8027, -2.0831, 1.4410}, Lab{91.1528, -1.6435, 0.0447}, 1.4441},
+		{Lab{90.9257, -0.5406, -0.9208}, Lab{88.6381, -0.8985, -0.7239}, 1.5381},
+		{Lab{6.7747, -0.2908, -2.4247}, Lab{5.8714, -0.0985, -2.2286}, 0.6377},
+		{Lab{2.0776, 0.0795, -1.1350}, Lab{0.9033, -0.0636, -0.5514}, 0.9082},
+	}
+	for i, tt := range tests {
+		// Значения в статье округлены до четырех знаков.
+		if got := DeltaE(tt.p, tt.q); math.Abs(got-tt.want) > 1e-4 {
+			t.Errorf("pair %d: DeltaE(%v, %v) = %.4f, want %.4f", i+1, tt.p, tt.q, got, tt.want)
+		}
+		if a, b := DeltaE(tt.p, tt.q), DeltaE(tt.q, tt.p); math.Abs(a-b) > 1e-9 {
+			t.Errorf("pair %d: DeltaE is not symmetric: %.6f and %.6f", i+1, a, b)
+		}
+	}
+}
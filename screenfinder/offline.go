@@ -0,0 +1,324 @@
+package screenfinder
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RecordedFrame — кадр записи: снимок и время от ее начала. Границы Image —
+// координаты окна, в которых кадр был снят.
+type RecordedFrame struct {
+	At    time.Duration
+	Image *image.RGBA
+}
+
+// Clock сообщает, сколько прошло от начала воспроизведения.
+type Clock interface {
+	Elapsed() time.Duration
+}
+
+// RealClock идет вместе с настоящим временем, ускоренным в Speed раз
+// (ноль — 1). Отсчет начинается с первого вызова Elapsed.
+type RealClock struct {
+	Speed float64
+
+	mu    sync.Mutex
+	start time.Time
+}
+
+func (c *RealClock) Elapsed() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.start.IsZero() {
+		c.start = time.Now()
+	}
+	speed := c.Speed
+	if speed <= 0 {
+		speed = 1
+	}
+	return time.Duration(float64(time.Since(c.start)) * speed)
+}
+
+// ManualClock стоит, пока его не переставят: так проверка сама решает,
+// какой кадр видит детектор.
+type ManualClock struct {
+	mu sync.Mutex
+	t  time.Duration
+}
+
+func (c *ManualClock) Elapsed() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+// Set переставляет часы на t от начала.
+func (c *ManualClock) Set(t time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = t
+}
+
+// Advance переводит часы вперед на d.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t += d
+}
+
+// Sequence — ScreenSource без окна: отдает заранее снятые кадры, чтобы
+// детекторы можно было отлаживать и проверять без запущенной игры. Какой
+// кадр показывать, решает Clock: последний кадр, чье At не позже
+// Clock.Elapsed(). Без Clock каждый вызов Frame отдает следующий кадр.
+// После последнего кадра показывается последний, а с Loop — запись
+// начинается сначала.
+type Sequence struct {
+	Frames []RecordedFrame
+	Clock  Clock
+	Loop   bool
+
+	mu   sync.Mutex
+	next int
+}
+
+// NewStill возвращает Sequence из одного кадра img.
+func NewStill(img image.Image) *Sequence {
+	return &Sequence{Frames: []RecordedFrame{{Image: toRGBA(img)}}}
+}
+
+// LoadPNG загружает кадры из PNG-файлов, идущих друг за другом с интервалом
+// interval.
+func LoadPNG(interval time.Duration, paths ...string) (*Sequence, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("no frames")
+	}
+	s := &Sequence{}
+	for i, path := range paths {
+		img, err := readPNG(path)
+		if err != nil {
+			return nil, err
+		}
+		s.Frames = append(s.Frames, RecordedFrame{At: time.Duration(i) * interval, Image: img})
+	}
+	return s, nil
+}
+
+var frameNumber = regexp.MustCompile(`(\d+)\D*$`)
+
+// LoadDir загружает PNG-файлы каталога dir как пронумерованные кадры
+// (frame_1.png, frame_2.png, ..., frame_10.png) с интервалом interval.
+// Кадры упорядочиваются по последнему числу в имени, а не по алфавиту.
+func LoadDir(dir string, interval time.Duration) (*Sequence, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.png"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no PNG frames in %s", dir)
+	}
+	number := func(path string) int {
+		m := frameNumber.FindStringSubmatch(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+		if m == nil {
+			return -1
+		}
+		n, _ := strconv.Atoi(m[1])
+		return n
+	}
+	sort.SliceStable(paths, func(i, j int) bool { return number(paths[i]) < number(paths[j]) })
+	return LoadPNG(interval, paths...)
+}
+
+// LoadArchive загружает запись, сделанную Recorder.
+func LoadArchive(path string) (*Sequence, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	s := &Sequence{}
+	for _, f := range zr.File {
+		ms, err := strconv.ParseInt(strings.TrimSuffix(f.Name, ".png"), 10, 64)
+		if err != nil || !strings.HasSuffix(f.Name, ".png") {
+			return nil, fmt.Errorf("%s: unexpected entry %q", path, f.Name)
+		}
+		var origin image.Point
+		if f.Comment != "" {
+			if _, err := fmt.Sscanf(f.Comment, "%d,%d", &origin.X, &origin.Y); err != nil {
+				return nil, fmt.Errorf("%s: %s: bad origin %q", path, f.Name, f.Comment)
+			}
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		img, err := png.Decode(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, f.Name, err)
+		}
+		rgba := toRGBA(img)
+		rgba.Rect = rgba.Rect.Add(origin)
+		s.Frames = append(s.Frames, RecordedFrame{At: time.Duration(ms) * time.Millisecond, Image: rgba})
+	}
+	if len(s.Frames) == 0 {
+		return nil, fmt.Errorf("%s: no frames", path)
+	}
+	sort.SliceStable(s.Frames, func(i, j int) bool { return s.Frames[i].At < s.Frames[j].At })
+	return s, nil
+}
+
+// Frame возвращает текущий кадр, обрезанный до r; пустая r — кадр целиком.
+// Кадр общий для всех вызывающих и не должен меняться.
+func (s *Sequence) Frame(r image.Rectangle) (*image.RGBA, error) {
+	img, err := s.current()
+	if err != nil {
+		return nil, err
+	}
+	if r.Empty() {
+		return img, nil
+	}
+	if !r.Overlaps(img.Rect) {
+		return nil, fmt.Errorf("region %v is outside the frame %v", r, img.Rect)
+	}
+	return img.SubImage(r).(*image.RGBA), nil
+}
+
+func (s *Sequence) current() (*image.RGBA, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.Frames)
+	if n == 0 {
+		return nil, errors.New("no frames")
+	}
+	if s.Clock == nil {
+		i := s.next
+		if s.Loop {
+			i %= n
+		}
+		i = min(i, n-1)
+		s.next++
+		return s.Frames[i].Image, nil
+	}
+	t := s.Clock.Elapsed()
+	if last := s.Frames[n-1].At; s.Loop && last > 0 {
+		t %= last + s.interval()
+	}
+	i := sort.Search(n, func(i int) bool { return s.Frames[i].At > t })
+	return s.Frames[max(i-1, 0)].Image, nil
+}
+
+// interval (неэкспортируемая) оценивает, сколько показывается последний
+// кадр перед повтором: как средний промежуток между кадрами.
+func (s *Sequence) interval() time.Duration {
+	n := len(s.Frames)
+	if n < 2 {
+		return 0
+	}
+	return (s.Frames[n-1].At - s.Frames[0].At) / time.Duration(n-1)
+}
+
+// Recorder пишет снятые кадры в архив, который читает LoadArchive: zip,
+// где каждый кадр — PNG с именем из миллисекунд от начала записи,
+// а координаты его левого верхнего угла в окне — в комментарии файла.
+type Recorder struct {
+	mu    sync.Mutex
+	zw    *zip.Writer
+	c     io.Closer
+	start time.Time
+	last  int64
+}
+
+// CreateArchive создает архив записи path.
+func CreateArchive(path string) (*Recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{zw: zip.NewWriter(f), c: f, start: time.Now(), last: -1}, nil
+}
+
+// Add записывает кадр с текущим временем.
+func (r *Recorder) Add(frame *image.RGBA) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Имена в архиве не повторяются, даже если кадры пришли в одну миллисекунду.
+	ms := max(time.Since(r.start).Milliseconds(), r.last+1)
+	r.last = ms
+	w, err := r.zw.CreateHeader(&zip.FileHeader{
+		Name:    fmt.Sprintf("%09d.png", ms),
+		Comment: fmt.Sprintf("%d,%d", frame.Rect.Min.X, frame.Rect.Min.Y),
+		// PNG уже сжат.
+		Method: zip.Store,
+	})
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, frame)
+}
+
+// Close дописывает оглавление архива и закрывает файл.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err := r.zw.Close()
+	if cerr := r.c.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Recording — ScreenSource, которая отдает кадры Source и пишет каждый
+// в Recorder. Ошибка записи не мешает детекторам и только сообщается
+// в OnError, если он задан.
+type Recording struct {
+	Source   ScreenSource
+	Recorder *Recorder
+	OnError  func(error)
+}
+
+func (s Recording) Frame(r image.Rectangle) (*image.RGBA, error) {
+	frame, err := s.Source.Frame(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Recorder.Add(frame); err != nil && s.OnError != nil {
+		s.OnError(err)
+	}
+	return frame, nil
+}
+
+func readPNG(path string) (*image.RGBA, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return toRGBA(img), nil
+}
+
+// toRGBA (неэкспортируемая) приводит img к *image.RGBA с теми же границами.
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba
+	}
+	rgba := image.NewRGBA(img.Bounds())
+	draw.Draw(rgba, rgba.Rect, img, img.Bounds().Min, draw.Src)
+	return rgba
+}
@@ -0,0 +1,249 @@
+package screenfinder
+
+import (
+	"archive/zip"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var (
+	gray = color.RGBA{0x40, 0x40, 0x40, 0xff}
+	red  = color.RGBA{0xff, 0x00, 0x00, 0xff}
+)
+
+// solid (неэкспортируемая) возвращает кадр r, залитый c.
+func solid(r image.Rectangle, c color.RGBA) *image.RGBA {
+	img := image.NewRGBA(r)
+	paint(img, r, c)
+	return img
+}
+
+// paint (неэкспортируемая) заливает r на img цветом c.
+func paint(img *image.RGBA, r image.Rectangle, c color.RGBA) {
+	draw.Draw(img, r, &image.Uniform{C: c}, image.Point{}, draw.Src)
+}
+
+// stamp (неэкспортируемая) копирует src на img левым верхним углом в at.
+func stamp(img, src *image.RGBA, at image.Point) {
+	draw.Draw(img, src.Rect.Sub(src.Rect.Min).Add(at), src, src.Rect.Min, draw.Over)
+}
+
+// recording (неэкспортируемая) возвращает три кадра окна 200x120 с шагом
+// 100 мс: пустой, с красным квадратом 10x10 в (40,30) и с glyph в (120,60).
+func recording(glyph *image.RGBA) []*image.RGBA {
+	r := image.Rect(0, 0, 200, 120)
+	empty := solid(r, gray)
+	blob := solid(r, gray)
+	paint(blob, image.Rect(40, 30, 50, 40), red)
+	icon := solid(r, gray)
+	stamp(icon, glyph, image.Pt(120, 60))
+	return []*image.RGBA{empty, blob, icon}
+}
+
+// writePNG (неэкспортируемая) сохраняет img в path.
+func writePNG(t *testing.T, path string, img image.Image) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeArchive (неэкспортируемая) пишет кадры в архив формата Recorder
+// с заданным шагом, не завися от настоящего времени.
+func writeArchive(t *testing.T, path string, frames []*image.RGBA, step time.Duration) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	// Порядок в архиве не важен: LoadArchive сортирует по времени.
+	for i := len(frames) - 1; i >= 0; i-- {
+		w, err := zw.CreateHeader(&zip.FileHeader{
+			Name:    fmt.Sprintf("%09d.png", (time.Duration(i) * step).Milliseconds()),
+			Comment: fmt.Sprintf("%d,%d", frames[i].Rect.Min.X, frames[i].Rect.Min.Y),
+			Method:  zip.Store,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := png.Encode(w, frames[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFinderOnRecording(t *testing.T) {
+	glyph := noise(16, 16)
+	frames := recording(glyph)
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "session.zip")
+	writeArchive(t, archive, frames, 100*time.Millisecond)
+	// По алфавиту frame_10 и frame_11 шли бы раньше frame_9.
+	pngs := filepath.Join(dir, "frames")
+	if err := os.Mkdir(pngs, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for i, img := range frames {
+		writePNG(t, filepath.Join(pngs, fmt.Sprintf("frame_%d.png", 9+i)), img)
+	}
+
+	sources := []struct {
+		name string
+		load func() (*Sequence, error)
+	}{
+		{"archive", func() (*Sequence, error) { return LoadArchive(archive) }},
+		{"dir", func() (*Sequence, error) { return LoadDir(pngs, 100*time.Millisecond) }},
+	}
+	steps := []struct {
+		at      time.Duration
+		found   bool
+		pos     Coord
+		targets int
+		matches int
+	}{
+		{0, false, Coord{}, 0, 0},
+		{99 * time.Millisecond, false, Coord{}, 0, 0},
+		{100 * time.Millisecond, true, Coord{X: 45, Y: 35}, 1, 0},
+		{250 * time.Millisecond, true, Coord{X: 128, Y: 68}, 0, 1},
+		// После конца записи остается последний кадр.
+		{time.Hour, true, Coord{X: 128, Y: 68}, 0, 1},
+	}
+	for _, src := range sources {
+		t.Run(src.name, func(t *testing.T) {
+			seq, err := src.load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(seq.Frames) != len(frames) {
+				t.Fatalf("loaded %d frames, want %d", len(seq.Frames), len(frames))
+			}
+			tpl, err := NewTemplate("glyph", glyph)
+			if err != nil {
+				t.Fatal(err)
+			}
+			clock := &ManualClock{}
+			seq.Clock = clock
+			f := &Finder{
+				Source:      seq,
+				TargetColor: Color{R: 0xff},
+				Regions:     []Region{Rect(0, 0, 200, 120)},
+				Templates:   []*Template{tpl},
+			}
+			if err := f.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			for _, step := range steps {
+				clock.Set(step.at)
+				found, pos, err := f.Find()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if found != step.found || pos != step.pos {
+					t.Errorf("at %s: Find = %v %v, want %v %v", step.at, found, pos, step.found, step.pos)
+				}
+				frame, err := f.Frame()
+				if err != nil {
+					t.Fatal(err)
+				}
+				targets, err := f.TargetsIn(frame)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(targets) != step.targets {
+					t.Errorf("at %s: %d targets, want %d", step.at, len(targets), step.targets)
+				} else if len(targets) == 1 && (targets[0].Pixels != 100 || targets[0].Bounds != image.Rect(40, 30, 50, 40)) {
+					t.Errorf("at %s: target %+v, want the 10x10 square at (40,30)", step.at, targets[0])
+				}
+				matches := f.MatchesIn(frame)
+				if len(matches) != step.matches {
+					t.Errorf("at %s: %d matches, want %d", step.at, len(matches), step.matches)
+				} else if len(matches) == 1 && (matches[0].Bounds != image.Rect(120, 60, 136, 76) || matches[0].Score < 0.99) {
+					t.Errorf("at %s: match %+v, want glyph at (120,60)", step.at, matches[0])
+				}
+			}
+
+			// По кругу запись идет с периодом 300 мс: три кадра по 100.
+			seq.Loop = true
+			for _, step := range []struct {
+				at    time.Duration
+				found bool
+			}{{300 * time.Millisecond, false}, {450 * time.Millisecond, true}, {599 * time.Millisecond, true}, {600 * time.Millisecond, false}} {
+				clock.Set(step.at)
+				if found, _, err := f.Find(); err != nil || found != step.found {
+					t.Errorf("loop at %s: Find = %v, %v; want %v", step.at, found, err, step.found)
+				}
+			}
+		})
+	}
+}
+
+func TestSequenceWithoutClock(t *testing.T) {
+	frames := recording(noise(16, 16))
+	seq := &Sequence{}
+	for i, img := range frames {
+		seq.Frames = append(seq.Frames, RecordedFrame{At: time.Duration(i) * time.Second, Image: img})
+	}
+	f := &Finder{Source: seq, TargetColor: Color{R: 0xff}, Regions: []Region{Rect(0, 0, 200, 120)}}
+	// Каждый Find берет следующий кадр, после последнего — снова последний.
+	for i, want := range []bool{false, true, false, false} {
+		if found, _, err := f.Find(); err != nil || found != want {
+			t.Errorf("Find #%d = %v, %v; want %v", i, found, err, want)
+		}
+	}
+}
+
+func TestRecorderRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.zip")
+	rec, err := CreateArchive(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Кадр области окна, а не всего окна: начало координат сохраняется.
+	frame := noise(40, 30)
+	frame.Rect = frame.Rect.Add(image.Pt(100, 50))
+	src := Recording{Source: NewStill(frame), Recorder: rec, OnError: func(err error) { t.Error(err) }}
+	for i := 0; i < 3; i++ {
+		if _, err := src.Frame(image.Rectangle{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	seq, err := LoadArchive(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seq.Frames) != 3 {
+		t.Fatalf("archive holds %d frames, want 3", len(seq.Frames))
+	}
+	for i, rf := range seq.Frames {
+		if i > 0 && rf.At <= seq.Frames[i-1].At {
+			t.Errorf("frame %d at %s is not after %s", i, rf.At, seq.Frames[i-1].At)
+		}
+		if rf.Image.Rect != frame.Rect {
+			t.Errorf("frame %d bounds %v, want %v", i, rf.Image.Rect, frame.Rect)
+		}
+		if string(rf.Image.Pix) != string(frame.Pix) {
+			t.Errorf("frame %d pixels differ from the recorded frame", i)
+		}
+	}
+}
@@ -2,12 +2,15 @@ package screenfinder
 
 import (
 	"errors"
-	"syscall"
-	"unsafe"
+	"image"
+
+	"arduino-go-bot/platform"
 )
 
 type Color struct {
-	R, G, B uint8
+	R uint8 `json:"r"`
+	G uint8 `json:"g"`
+	B uint8 `json:"b"`
 }
 
 type Coord struct {
@@ -16,81 +19,130 @@ type Coord struct {
 
 type Finder struct {
 	PID         int
+	// Deprecated: используйте Window. SetWindow заполняет HWND для старого кода, который его читает; запись в поле ни на что не влияет.
 	HWND        uintptr
+	Window      platform.Window
 	Positions   []Coord
 	TargetColor Color
-}
-
-var (
-	user32      = syscall.NewLazyDLL("user32.dll")
-	gdi32       = syscall.NewLazyDLL("gdi32.dll")
-	enumWindows = user32.NewProc("EnumWindows")
-	getWindowThreadProcessId = user32.NewProc("GetWindowThreadProcessId")
-	getDC      = user32.NewProc("GetDC")
-	releaseDC  = user32.NewProc("ReleaseDC")
-	getPixel   = gdi32.NewProc("GetPixel")
-	getWindowRect = user32.NewProc("GetWindowRect")
-)
-
-type rect struct { Left, Top, Right, Bottom int32 }
-
-// findWindowByPID ищет главное окно процесса по PID (не потокобезопасен).
-func findWindowByPID(pid int) (hwnd uintptr, err error) {
-	var foundHwnd uintptr
-	cb := syscall.NewCallback(func(h syscall.Handle, lparam uintptr) uintptr {
-		var procID uint32
-		getWindowThreadProcessId.Call(uintptr(h), uintptr(unsafe.Pointer(&procID)))
-		if int(procID) == pid {
-			foundHwnd = uintptr(h)
-			return 0 // terminate enumeration
-		}
-		return 1 // continue
-	})
-	enumWindows.Call(cb, 0)
-	if foundHwnd != 0 {
-		return foundHwnd, nil
-	}
-	return 0, errors.New("window not found by PID")
+	// Windows ищет окно процесса; nil — platform.Current.
+	Windows platform.WindowFinder
+	// Rules — правила цвета цели; точка подходит, если подходит хоть под одно. Пусто — точное совпадение с TargetColor.
+	Rules []ColorRule
+	// Source снимает кадры для Find; nil — WindowSource над Window.
+	Source ScreenSource
+	// Regions — области, где цель ищется целиком, а не в отдельных точках; Blobs отсеивает найденные пятна по размеру.
+	Regions []Region
+	Blobs   BlobFilter
+	// Templates ищутся на кадре после Positions и Regions; at — центр лучшего совпадения.
+	Templates []*Template
 }
 
 // Вызвать только один раз из main.go!
-func (f *Finder) SetHWND() error {
-	hwnd, err := findWindowByPID(f.PID)
+func (f *Finder) SetWindow() error {
+	windows := f.Windows
+	if windows == nil { windows = platform.Current }
+	w, err := windows.FindWindow(f.PID)
 	if err != nil {
 		return err
 	}
-	f.HWND = hwnd
+	f.Window = w
+	if h, ok := w.(interface{ Handle() uintptr }); ok { f.HWND = h.Handle() }
 	return nil
 }
 
+// Deprecated: используйте SetWindow.
+func (f *Finder) SetHWND() error { return f.SetWindow() }
+
 func (f *Finder) TopLeft() (int32, int32, error) {
-	if f.HWND == 0 { return 0,0, errors.New("HWND is not set") }
-	var r rect
-	rv, _, _ := getWindowRect.Call(f.HWND, uintptr(unsafe.Pointer(&r)))
-	if rv == 0 { return 0,0, errors.New("GetWindowRect failed") }
-	return r.Left, r.Top, nil
+	if f.Window == nil { return 0,0, errors.New("window is not set") }
+	r, err := f.Window.Rect()
+	if err != nil { return 0,0, err }
+	return int32(r.Min.X), int32(r.Min.Y), nil
 }
 
 func (f *Finder) SetPositions(coords []Coord) { f.Positions = coords }
 
+// Validate проверяет Rules, Regions и Blobs, чтобы неверная настройка нашлась до запуска, а не ошибкой каждого Find.
+func (f *Finder) Validate() error {
+	if _, err := f.matcher(); err != nil { return err }
+	if err := f.validateRegions(); err != nil { return err }
+	return f.validateTemplates()
+}
+
+// Frame снимает одним захватом область, в которую попадают все Positions,
+// Regions и области Templates (без них или с шаблоном без области — все окно).
+// У окна область обрезается по его размеру.
+func (f *Finder) Frame() (*image.RGBA, error) {
+	r := Bounds(f.Positions)
+	for _, reg := range f.Regions { r = r.Union(reg.Bounds()) }
+	for _, t := range f.Templates {
+		if t.area().Empty() { r = image.Rectangle{}; break }
+		r = r.Union(t.area())
+	}
+	src := f.Source
+	if src == nil {
+		if f.Window == nil { return nil, errors.New("window is not set. Call SetWindow() first") }
+		src = WindowSource{Window: f.Window}
+		if !r.Empty() {
+			wr, err := f.Window.Rect()
+			if err != nil { return nil, err }
+			if r = r.Intersect(image.Rectangle{Max: wr.Size()}); r.Empty() { return nil, errors.New("search area is outside the window") }
+		}
+	}
+	return src.Frame(r)
+}
+
+// Find ищет цвет цели в Positions, затем в Regions, затем Templates на одном
+// кадре; в Regions at — центр самой крупной цели, у Templates — центр лучшего
+// совпадения. Если снять область окна целиком не вышло, точки Positions
+// читаются по одной, как в FindPixels.
 func (f *Finder) Find() (found bool, at Coord, err error) {
-	if f.HWND == 0 {
-		return false, Coord{}, errors.New("HWND is not set. Call SetHWND() first")
+	frame, err := f.Frame()
+	if err != nil {
+		if f.Source != nil || f.Window == nil || len(f.Regions) > 0 || len(f.Templates) > 0 { return false, Coord{}, err }
+		return f.FindPixels()
 	}
-	hdc, _, _ := getDC.Call(f.HWND)
-	if hdc == 0 {
-		return false, Coord{}, errors.New("getDC failed")
+	return f.FindIn(frame)
+}
+
+// FindIn ищет цель на готовом кадре, как Find; точки за его границами
+// не совпадают. Ошибка — неверное правило в Rules.
+func (f *Finder) FindIn(frame *image.RGBA) (bool, Coord, error) {
+	match, err := f.matcher()
+	if err != nil { return false, Coord{}, err }
+	for _, pos := range f.Positions {
+		p := image.Pt(int(pos.X), int(pos.Y))
+		if !p.In(frame.Rect) { continue }
+		c := frame.RGBAAt(p.X, p.Y)
+		if match(Color{R: c.R, G: c.G, B: c.B}) { return true, pos, nil }
 	}
-	defer releaseDC.Call(f.HWND, hdc)
+	targets, err := f.TargetsIn(frame)
+	if err != nil { return false, Coord{}, err }
+	if len(targets) > 0 { return true, targets[0].Centroid, nil }
+	if m := f.MatchesIn(frame); len(m) > 0 { return true, m[0].At, nil }
+	return false, Coord{}, nil
+}
 
+// FindPixels — прежний путь: каждая точка читается из окна отдельным
+// запросом. Нужен, когда кадр не снимается, и для сравнения скорости.
+func (f *Finder) FindPixels() (found bool, at Coord, err error) {
+	if f.Window == nil {
+		return false, Coord{}, errors.New("window is not set. Call SetWindow() first")
+	}
+	match, err := f.matcher()
+	if err != nil { return false, Coord{}, err }
+	misses := 0
 	for _, pos := range f.Positions {
-		colorRef, _, _ := getPixel.Call(hdc, uintptr(pos.X), uintptr(pos.Y))
-		r := uint8(colorRef & 0xFF)
-		g := uint8((colorRef >> 8) & 0xFF)
-		b := uint8((colorRef >> 16) & 0xFF)
-		if r == f.TargetColor.R && g == f.TargetColor.G && b == f.TargetColor.B {
+		c, perr := f.Window.Pixel(image.Pt(int(pos.X), int(pos.Y)))
+		if perr != nil {
+			// Точка могла оказаться за видимой частью окна; ошибка — только если не прочиталась ни одна.
+			misses, err = misses+1, perr
+			continue
+		}
+		if match(Color{R: c.R, G: c.G, B: c.B}) {
 			return true, pos, nil
 		}
 	}
-	return false, Coord{}, nil
+	if misses < len(f.Positions) { err = nil }
+	return false, Coord{}, err
 }
@@ -0,0 +1,67 @@
+package screenfinder
+
+import (
+	"errors"
+	"image"
+
+	"arduino-go-bot/platform"
+)
+
+// ScreenSource снимает кадры, на которых работают детекторы. Один кадр —
+// один захват (BitBlt окна на Windows, GetImage на X11) вместо чтения
+// каждой точки отдельно.
+type ScreenSource interface {
+	// Frame снимает область r в координатах окна; пустая r — все окно.
+	// Границы кадра совпадают с r, поэтому точки читаются из него в тех же
+	// координатах, что и Positions.
+	Frame(r image.Rectangle) (*image.RGBA, error)
+}
+
+// WindowSource снимает клиентскую область окна.
+type WindowSource struct {
+	Window platform.Window
+}
+
+func (s WindowSource) Frame(r image.Rectangle) (*image.RGBA, error) {
+	if s.Window == nil {
+		return nil, errors.New("window is not set")
+	}
+	if r.Empty() {
+		wr, err := s.Window.Rect()
+		if err != nil {
+			return nil, err
+		}
+		r = image.Rectangle{Max: wr.Size()}
+	}
+	return s.Window.Capture(r)
+}
+
+// DesktopSource снимает рабочий стол; координаты кадра — координаты
+// рабочего стола. Screen nil — platform.Current.
+type DesktopSource struct {
+	Screen platform.Screen
+}
+
+func (s DesktopSource) Frame(r image.Rectangle) (*image.RGBA, error) {
+	screen := s.Screen
+	if screen == nil {
+		screen = platform.Current
+	}
+	if r.Empty() {
+		d, err := screen.Desktop()
+		if err != nil {
+			return nil, err
+		}
+		r = d
+	}
+	return screen.Capture(r)
+}
+
+// Bounds возвращает наименьший прямоугольник, содержащий все точки.
+func Bounds(points []Coord) image.Rectangle {
+	var r image.Rectangle
+	for _, p := range points {
+		r = r.Union(image.Rect(int(p.X), int(p.Y), int(p.X)+1, int(p.Y)+1))
+	}
+	return r
+}
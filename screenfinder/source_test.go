@@ -0,0 +1,183 @@
+package screenfinder
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"testing"
+
+	"arduino-go-bot/platform"
+)
+
+// fakeWindow (неэкспортируемый) — окно в памяти: отдает точки и кадры
+// из img и считает запросы к себе, как считались бы вызовы GetPixel
+// и BitBlt у настоящего окна.
+type fakeWindow struct {
+	img      *image.RGBA
+	pixels   int
+	captures int
+}
+
+func (w *fakeWindow) Rect() (image.Rectangle, error) { return w.img.Rect, nil }
+
+func (w *fakeWindow) Pixel(p image.Point) (color.RGBA, error) {
+	w.pixels++
+	if !p.In(w.img.Rect) {
+		return color.RGBA{}, fmt.Errorf("point %v is outside the window", p)
+	}
+	return w.img.RGBAAt(p.X, p.Y), nil
+}
+
+func (w *fakeWindow) Capture(r image.Rectangle) (*image.RGBA, error) {
+	w.captures++
+	if !r.In(w.img.Rect) {
+		return nil, fmt.Errorf("area %v is outside the window", r)
+	}
+	frame := image.NewRGBA(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		copy(frame.Pix[frame.PixOffset(r.Min.X, y):], w.img.Pix[w.img.PixOffset(r.Min.X, y):w.img.PixOffset(r.Max.X, y)])
+	}
+	return frame, nil
+}
+
+// noise (неэкспортируемая) заполняет кадр w×h воспроизводимым шумом.
+func noise(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	seed := uint32(1)
+	for i := range img.Pix {
+		seed = seed*1664525 + 1013904223
+		img.Pix[i] = uint8(seed >> 24)
+	}
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 0xff
+	}
+	return img
+}
+
+// grid (неэкспортируемая) раскладывает n точек ровной сеткой по size.
+func grid(size image.Point, n int) []Coord {
+	cols := 1
+	for cols*cols < n {
+		cols++
+	}
+	rows := (n + cols - 1) / cols
+	coords := make([]Coord, 0, n)
+	for i := 0; i < n; i++ {
+		x := (i%cols*2 + 1) * size.X / (cols * 2)
+		y := (i/cols*2 + 1) * size.Y / (rows * 2)
+		coords = append(coords, Coord{X: int32(x), Y: int32(y)})
+	}
+	return coords
+}
+
+func TestFindMatchesFindPixels(t *testing.T) {
+	w := &fakeWindow{img: noise(320, 240)}
+	f := &Finder{Window: w, Positions: grid(w.img.Rect.Size(), 64)}
+	for _, i := range []int{0, 17, 63} {
+		c := w.img.RGBAAt(int(f.Positions[i].X), int(f.Positions[i].Y))
+		f.TargetColor = Color{R: c.R, G: c.G, B: c.B}
+		found, at, err := f.Find()
+		if err != nil {
+			t.Fatal(err)
+		}
+		foundPixels, atPixels, err := f.FindPixels()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != foundPixels || at != atPixels {
+			t.Errorf("point %d: Find = %v %v, FindPixels = %v %v", i, found, at, foundPixels, atPixels)
+		}
+	}
+	w.pixels, w.captures = 0, 0
+	f.Find()
+	if w.captures != 1 || w.pixels != 0 {
+		t.Errorf("Find made %d captures and %d pixel reads, want one capture", w.captures, w.pixels)
+	}
+}
+
+// desktopWindow (неэкспортируемый) выдает рабочий стол за окно, чтобы
+// сравнить оба пути на настоящих запросах к системе.
+type desktopWindow struct {
+	screen platform.Screen
+	rect   image.Rectangle
+}
+
+func (w desktopWindow) Rect() (image.Rectangle, error) { return w.rect, nil }
+
+func (w desktopWindow) Pixel(p image.Point) (color.RGBA, error) {
+	return w.screen.Pixel(p.Add(w.rect.Min))
+}
+
+func (w desktopWindow) Capture(r image.Rectangle) (*image.RGBA, error) {
+	frame, err := w.screen.Capture(r.Add(w.rect.Min))
+	if err != nil {
+		return nil, err
+	}
+	frame.Rect = r
+	return frame, nil
+}
+
+// benchmarkFind (неэкспортируемая) ищет в n точках окна w цвет, который
+// там не встречается, так что каждый Find проверяет все точки. Запросы
+// к окну на один Find попадают в отчет.
+func benchmarkFind(b *testing.B, w platform.Window, n int, find func(*Finder) (bool, Coord, error)) {
+	r, err := w.Rect()
+	if err != nil {
+		b.Fatal(err)
+	}
+	counted := &countingWindow{Window: w}
+	f := &Finder{Window: counted, Positions: grid(r.Size(), n), TargetColor: Color{R: 255, G: 254, B: 255}}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := find(f); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(counted.pixels)/float64(b.N), "pixel-calls/op")
+	b.ReportMetric(float64(counted.captures)/float64(b.N), "captures/op")
+}
+
+// countingWindow (неэкспортируемый) считает запросы к окну.
+type countingWindow struct {
+	platform.Window
+	pixels, captures int
+}
+
+func (w *countingWindow) Pixel(p image.Point) (color.RGBA, error) {
+	w.pixels++
+	return w.Window.Pixel(p)
+}
+
+func (w *countingWindow) Capture(r image.Rectangle) (*image.RGBA, error) {
+	w.captures++
+	return w.Window.Capture(r)
+}
+
+func runFindBenchmarks(b *testing.B, w platform.Window) {
+	for _, n := range []int{4, 16, 64, 256} {
+		b.Run(fmt.Sprintf("pixels/%d", n), func(b *testing.B) {
+			benchmarkFind(b, w, n, (*Finder).FindPixels)
+		})
+		b.Run(fmt.Sprintf("frame/%d", n), func(b *testing.B) {
+			benchmarkFind(b, w, n, (*Finder).Find)
+		})
+	}
+}
+
+// BenchmarkFind сравнивает пути на рабочем столе этой системы: каждое
+// чтение точки там — отдельный запрос (GetPixel, GetImage 1x1), кадр —
+// один. Без дисплея пропускается; окно игры меряет cmd/screenbench.
+func BenchmarkFind(b *testing.B) {
+	d, err := platform.Current.Desktop()
+	if err != nil {
+		b.Skipf("no desktop to capture: %v", err)
+	}
+	runFindBenchmarks(b, desktopWindow{screen: platform.Current, rect: d})
+}
+
+// BenchmarkFindInMemory — те же пути на окне в памяти, где запрос ничего
+// не стоит: остается только работа самого screenfinder, в том числе
+// копирование кадра.
+func BenchmarkFindInMemory(b *testing.B) {
+	runFindBenchmarks(b, &fakeWindow{img: noise(1280, 720)})
+}
@@ -0,0 +1,444 @@
+package screenfinder
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// DefaultThreshold — порог совпадения шаблона, если он не задан.
+const DefaultThreshold = 0.9
+
+// coarseSlack — насколько ниже порога может быть оценка на уменьшенном кадре,
+// чтобы место еще проверялось в полном размере: уменьшение размывает
+// мелкие детали, и оценка там ниже.
+const coarseSlack = 0.2
+
+// maxCandidates — сколько лучших мест уменьшенного кадра уточняется.
+const maxCandidates = 64
+
+// Template — образец (табличка с именем монстра, иконка, кнопка диалога),
+// который ищется на кадре нормированной взаимной корреляцией яркости.
+// Прозрачные точки PNG (альфа меньше половины) в сравнении не участвуют,
+// поэтому фон вокруг фигуры может быть любым.
+type Template struct {
+	Name string
+	// Region — где искать; пустая — весь кадр.
+	Region Region
+	// Threshold — наименьшая оценка совпадения от -1 до 1; ноль — DefaultThreshold.
+	Threshold float64
+	// Coarse — во сколько раз уменьшать кадр и шаблон для грубого поиска,
+	// после которого найденные места уточняются в полном размере. 0 или 1 —
+	// сразу искать в полном размере. 2–4 ускоряют поиск в 4–16 раз, но мелкий
+	// или тонкий шаблон на уменьшенном кадре может потеряться.
+	Coarse int
+
+	full *tplane
+	size image.Point
+	// mu охраняет coarse: Find зовут из нескольких горутин.
+	mu     sync.Mutex
+	coarse map[int]*tplane
+}
+
+// Match — найденное место шаблона. At — центр, по нему стоит кликать;
+// Bounds — весь прямоугольник шаблона на кадре; Score — оценка совпадения.
+type Match struct {
+	Template string
+	At       Coord
+	Bounds   image.Rectangle
+	Score    float64
+}
+
+// TemplateSpec — шаблон в config.json:
+//
+//	{"file": "nameplate.png", "region": {"min": {"X": 0, "Y": 0}, "max": {"X": 1920, "Y": 540}}, "threshold": 0.85, "coarse": 2}
+//
+// File — PNG, путь относительно каталога конфига.
+type TemplateSpec struct {
+	File      string  `json:"file"`
+	Region    Region  `json:"region,omitzero"`
+	Threshold float64 `json:"threshold,omitempty"`
+	Coarse    int     `json:"coarse,omitempty"`
+}
+
+// Load загружает шаблон; dir — каталог конфига.
+func (s TemplateSpec) Load(dir string) (*Template, error) {
+	path := s.File
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	t, err := LoadTemplate(path)
+	if err != nil {
+		return nil, err
+	}
+	t.Region, t.Threshold, t.Coarse = s.Region, s.Threshold, s.Coarse
+	return t, t.validate()
+}
+
+// LoadTemplate загружает шаблон из PNG.
+func LoadTemplate(path string) (*Template, error) {
+	img, err := readPNG(path)
+	if err != nil {
+		return nil, err
+	}
+	t, err := NewTemplate(filepath.Base(path), img)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return t, nil
+}
+
+// NewTemplate делает шаблон из изображения.
+func NewTemplate(name string, img *image.RGBA) (*Template, error) {
+	r := img.Rect
+	w, h := r.Dx(), r.Dy()
+	gray := make([]float64, w*h)
+	opaque := make([]bool, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := img.RGBAAt(r.Min.X+x, r.Min.Y+y)
+			gray[y*w+x] = luma(c.R, c.G, c.B)
+			opaque[y*w+x] = c.A >= 128
+		}
+	}
+	full, err := newTplane(gray, opaque, w, h)
+	if err != nil {
+		return nil, err
+	}
+	return &Template{Name: name, full: full, size: image.Pt(w, h), coarse: make(map[int]*tplane)}, nil
+}
+
+func (t *Template) validate() error {
+	if t.Threshold < -1 || t.Threshold > 1 {
+		return fmt.Errorf("template %s: threshold %g is outside -1..1", t.Name, t.Threshold)
+	}
+	if t.Coarse < 0 {
+		return fmt.Errorf("template %s: negative coarse factor %d", t.Name, t.Coarse)
+	}
+	if len(t.Region.Polygon) > 0 || t.Region.Bounds() != (image.Rectangle{}) {
+		return t.Region.validate()
+	}
+	return nil
+}
+
+func (t *Template) threshold() float64 {
+	if t.Threshold == 0 {
+		return DefaultThreshold
+	}
+	return t.Threshold
+}
+
+// area (неэкспортируемая) возвращает прямоугольник поиска; пустой — весь кадр.
+func (t *Template) area() image.Rectangle { return t.Region.Bounds() }
+
+// Match ищет шаблон на кадре и возвращает все места с оценкой не ниже
+// порога, от лучшего к худшему. Места, перекрывающие лучшее больше чем
+// наполовину по каждой оси, отбрасываются. У многоугольной Region учитывается
+// только центр совпадения.
+func (t *Template) Match(frame *image.RGBA) []Match {
+	area := frame.Rect
+	if r := t.area(); !r.Empty() {
+		area = area.Intersect(r)
+	}
+	if area.Dx() < t.size.X || area.Dy() < t.size.Y {
+		return nil
+	}
+	img := newPlane(frame, area)
+	threshold := t.threshold()
+
+	var found []Match
+	add := func(u, v int, score float64) {
+		if score < threshold {
+			return
+		}
+		corner := area.Min.Add(image.Pt(u, v))
+		at := Coord{X: int32(corner.X + t.size.X/2), Y: int32(corner.Y + t.size.Y/2)}
+		if len(t.Region.Polygon) > 0 && !t.Region.Contains(int(at.X), int(at.Y)) {
+			return
+		}
+		found = append(found, Match{Template: t.Name, At: at, Bounds: image.Rectangle{Min: corner, Max: corner.Add(t.size)}, Score: score})
+	}
+
+	if ct := t.coarsePlane(); ct != nil {
+		k := t.Coarse
+		small := img.shrink(k)
+		for _, c := range candidates(small, ct, threshold-coarseSlack) {
+			// Уточнение: лучшее место полного размера рядом с грубым.
+			bu, bv, best := 0, 0, math.Inf(-1)
+			for v := max(c.Y*k-k, 0); v <= min(c.Y*k+k, img.h-t.size.Y); v++ {
+				for u := max(c.X*k-k, 0); u <= min(c.X*k+k, img.w-t.size.X); u++ {
+					if s := ncc(img, t.full, u, v); s > best {
+						bu, bv, best = u, v, s
+					}
+				}
+			}
+			add(bu, bv, best)
+		}
+	} else {
+		for _, c := range candidates(img, t.full, threshold) {
+			add(c.X, c.Y, ncc(img, t.full, c.X, c.Y))
+		}
+	}
+
+	sort.SliceStable(found, func(i, j int) bool { return found[i].Score > found[j].Score })
+	var kept []Match
+	for _, m := range found {
+		overlaps := false
+		for _, k := range kept {
+			d := m.Bounds.Min.Sub(k.Bounds.Min)
+			if abs(d.X)*2 < t.size.X && abs(d.Y)*2 < t.size.Y {
+				overlaps = true
+				break
+			}
+		}
+		if !overlaps {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
+
+// coarsePlane (неэкспортируемая) возвращает уменьшенный в Coarse раз шаблон
+// или nil, если грубый поиск выключен или шаблон после уменьшения слишком
+// мал и однороден, чтобы по нему искать.
+func (t *Template) coarsePlane() *tplane {
+	k := t.Coarse
+	if k <= 1 || t.size.X/k < 3 || t.size.Y/k < 3 {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if ct, ok := t.coarse[k]; ok {
+		return ct
+	}
+	ct := t.full.shrink(k)
+	t.coarse[k] = ct
+	return ct
+}
+
+// MatchesIn ищет на кадре все Templates и возвращает совпадения от лучшего
+// к худшему.
+func (f *Finder) MatchesIn(frame *image.RGBA) []Match {
+	var all []Match
+	for _, t := range f.Templates {
+		all = append(all, t.Match(frame)...)
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Score > all[j].Score })
+	return all
+}
+
+// Matches снимает кадр и ищет на нем Templates.
+func (f *Finder) Matches() ([]Match, error) {
+	frame, err := f.Frame()
+	if err != nil {
+		return nil, err
+	}
+	return f.MatchesIn(frame), nil
+}
+
+// validateTemplates (неэкспортируемая) проверяет Templates.
+func (f *Finder) validateTemplates() error {
+	for _, t := range f.Templates {
+		if t == nil || t.full == nil {
+			return errors.New("template is not loaded")
+		}
+		if err := t.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// luma (неэкспортируемая) возвращает яркость цвета по BT.601.
+func luma(r, g, b uint8) float64 { return 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b) }
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// plane — яркость области кадра.
+type plane struct {
+	w, h int
+	v    []float64
+}
+
+func newPlane(frame *image.RGBA, r image.Rectangle) *plane {
+	p := &plane{w: r.Dx(), h: r.Dy(), v: make([]float64, r.Dx()*r.Dy())}
+	for y := 0; y < p.h; y++ {
+		for x := 0; x < p.w; x++ {
+			c := frame.RGBAAt(r.Min.X+x, r.Min.Y+y)
+			p.v[y*p.w+x] = luma(c.R, c.G, c.B)
+		}
+	}
+	return p
+}
+
+// shrink (неэкспортируемая) уменьшает плоскость в k раз усреднением
+// блоков k×k; неполные блоки у края отбрасываются.
+func (p *plane) shrink(k int) *plane {
+	s := &plane{w: p.w / k, h: p.h / k}
+	s.v = make([]float64, s.w*s.h)
+	for y := 0; y < s.h; y++ {
+		for x := 0; x < s.w; x++ {
+			var sum float64
+			for dy := 0; dy < k; dy++ {
+				for dx := 0; dx < k; dx++ {
+					sum += p.v[(y*k+dy)*p.w+x*k+dx]
+				}
+			}
+			s.v[y*s.w+x] = sum / float64(k*k)
+		}
+	}
+	return s
+}
+
+// tpoint — непрозрачная точка шаблона и ее яркость за вычетом средней.
+type tpoint struct {
+	x, y int
+	t    float64
+}
+
+// tplane — шаблон, подготовленный к корреляции. ss — сумма квадратов t.
+type tplane struct {
+	w, h   int
+	gray   []float64
+	opaque []bool
+	points []tpoint
+	ss     float64
+}
+
+func newTplane(gray []float64, opaque []bool, w, h int) (*tplane, error) {
+	tp := &tplane{w: w, h: h, gray: gray, opaque: opaque}
+	var sum float64
+	for i, ok := range opaque {
+		if ok {
+			tp.points = append(tp.points, tpoint{x: i % w, y: i / w, t: gray[i]})
+			sum += gray[i]
+		}
+	}
+	if len(tp.points) < 2 {
+		return nil, errors.New("template has fewer than 2 opaque pixels")
+	}
+	mean := sum / float64(len(tp.points))
+	for i := range tp.points {
+		tp.points[i].t -= mean
+		tp.ss += tp.points[i].t * tp.points[i].t
+	}
+	if tp.ss < 1e-6*float64(len(tp.points)) {
+		return nil, errors.New("template is a single flat color; use a color rule instead")
+	}
+	return tp, nil
+}
+
+// shrink (неэкспортируемая) уменьшает шаблон в k раз; точка уменьшенного
+// шаблона непрозрачна, если непрозрачна хотя бы половина ее блока, и ее
+// яркость — средняя по непрозрачным точкам блока. nil — после уменьшения
+// по шаблону искать нельзя.
+func (tp *tplane) shrink(k int) *tplane {
+	w, h := tp.w/k, tp.h/k
+	gray := make([]float64, w*h)
+	opaque := make([]bool, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var sum float64
+			n := 0
+			for dy := 0; dy < k; dy++ {
+				for dx := 0; dx < k; dx++ {
+					if i := (y*k+dy)*tp.w + x*k + dx; tp.opaque[i] {
+						sum += tp.gray[i]
+						n++
+					}
+				}
+			}
+			if n*2 >= k*k {
+				gray[y*w+x], opaque[y*w+x] = sum/float64(n), true
+			}
+		}
+	}
+	s, err := newTplane(gray, opaque, w, h)
+	if err != nil {
+		return nil
+	}
+	return s
+}
+
+// ncc (неэкспортируемая) возвращает нормированную взаимную корреляцию
+// шаблона tp с img при левом верхнем угле шаблона в (u, v): 1 — совпадение
+// с точностью до яркости и контраста, 0 — нет сходства. На однородном
+// участке кадра корреляция не определена и считается нулем.
+func ncc(img *plane, tp *tplane, u, v int) float64 {
+	var si, sii, sit float64
+	for _, p := range tp.points {
+		x := img.v[(v+p.y)*img.w+u+p.x]
+		si += x
+		sii += x * x
+		sit += x * p.t
+	}
+	n := float64(len(tp.points))
+	varI := sii - si*si/n
+	if varI < 1e-6*n {
+		return 0
+	}
+	return sit / math.Sqrt(varI*tp.ss)
+}
+
+// candidates (неэкспортируемая) возвращает локальные максимумы корреляции
+// не ниже floor, не больше maxCandidates лучших.
+func candidates(img *plane, tp *tplane, floor float64) []image.Point {
+	w, h := img.w-tp.w+1, img.h-tp.h+1
+	if w <= 0 || h <= 0 {
+		return nil
+	}
+	scores := make([]float64, w*h)
+	for v := 0; v < h; v++ {
+		for u := 0; u < w; u++ {
+			scores[v*w+u] = ncc(img, tp, u, v)
+		}
+	}
+	type scored struct {
+		p image.Point
+		s float64
+	}
+	var peaks []scored
+	for v := 0; v < h; v++ {
+		for u := 0; u < w; u++ {
+			s := scores[v*w+u]
+			if s < floor {
+				continue
+			}
+			peak := true
+			for dv := -1; dv <= 1 && peak; dv++ {
+				for du := -1; du <= 1; du++ {
+					nu, nv := u+du, v+dv
+					if nu < 0 || nv < 0 || nu >= w || nv >= h || (du == 0 && dv == 0) {
+						continue
+					}
+					// Из равных соседей пиком считается первый по порядку обхода.
+					if n := scores[nv*w+nu]; n > s || n == s && nv*w+nu < v*w+u {
+						peak = false
+						break
+					}
+				}
+			}
+			if peak {
+				peaks = append(peaks, scored{image.Pt(u, v), s})
+			}
+		}
+	}
+	sort.SliceStable(peaks, func(i, j int) bool { return peaks[i].s > peaks[j].s })
+	if len(peaks) > maxCandidates {
+		peaks = peaks[:maxCandidates]
+	}
+	out := make([]image.Point, len(peaks))
+	for i, p := range peaks {
+		out[i] = p.p
+	}
+	return out
+}
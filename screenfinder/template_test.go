@@ -0,0 +1,207 @@
+package screenfinder
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// glyph (неэкспортируемая) рисует шаблон w×h с плавным узором; с round
+// точки вне вписанного круга прозрачны.
+func glyph(w, h int, round bool) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	cx, cy, rad := float64(w-1)/2, float64(h-1)/2, float64(min(w, h))/2
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if round && math.Hypot(float64(x)-cx, float64(y)-cy) > rad {
+				continue
+			}
+			l := 128 + 100*math.Sin(float64(x)/3)*math.Cos(float64(y)/4+float64(x)/7)
+			img.SetRGBA(x, y, color.RGBA{uint8(l), uint8(255 - l), 90, 0xff})
+		}
+	}
+	return img
+}
+
+// boundsOf (неэкспортируемая) возвращает Bounds совпадений.
+func boundsOf(matches []Match) map[image.Rectangle]bool {
+	out := make(map[image.Rectangle]bool)
+	for _, m := range matches {
+		out[m.Bounds] = true
+	}
+	return out
+}
+
+func TestMaskedTemplate(t *testing.T) {
+	g := glyph(24, 24, true)
+	frame := noise(200, 150)
+	at := image.Pt(70, 40)
+	// Прозрачные углы шаблона оставляют шум фона на месте.
+	stamp(frame, g, at)
+	want := image.Rectangle{Min: at, Max: at.Add(g.Rect.Size())}
+
+	masked, err := NewTemplate("masked", g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches := masked.Match(frame)
+	if len(matches) != 1 || matches[0].Bounds != want || matches[0].Score < 0.99 {
+		t.Fatalf("masked template matches %+v, want one at %v", matches, want)
+	}
+	if c := (Coord{X: int32(at.X + 12), Y: int32(at.Y + 12)}); matches[0].At != c {
+		t.Errorf("match center %v, want %v", matches[0].At, c)
+	}
+
+	// Тот же шаблон с черными непрозрачными углами сравнивает их с шумом.
+	opaque := image.NewRGBA(g.Rect)
+	for i := 0; i < len(g.Pix); i += 4 {
+		copy(opaque.Pix[i:i+4], g.Pix[i:i+4])
+		opaque.Pix[i+3] = 0xff
+	}
+	full, err := NewTemplate("opaque", opaque)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := full.Match(frame); len(m) != 0 {
+		t.Errorf("template without a mask matched the noisy corners: %+v", m)
+	}
+
+	// На шуме без фигуры совпадений нет.
+	if m := masked.Match(noise(200, 150)); len(m) != 0 {
+		t.Errorf("masked template matched plain noise: %+v", m)
+	}
+}
+
+func TestTemplateCoarseMatchesFull(t *testing.T) {
+	g := glyph(24, 24, false)
+	frame := noise(240, 160)
+	// Нечетные места не совпадают с блоками уменьшенного кадра.
+	places := []image.Point{{31, 17}, {100, 60}, {181, 121}}
+	want := make(map[image.Rectangle]bool)
+	for _, p := range places {
+		stamp(frame, g, p)
+		want[image.Rectangle{Min: p, Max: p.Add(g.Rect.Size())}] = true
+	}
+	for _, coarse := range []int{0, 2, 3} {
+		tpl, err := NewTemplate("glyph", g)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tpl.Coarse = coarse
+		matches := tpl.Match(frame)
+		got := boundsOf(matches)
+		if len(matches) != len(places) || len(got) != len(want) {
+			t.Errorf("coarse %d: %d matches %v, want %v", coarse, len(matches), got, want)
+			continue
+		}
+		for r := range want {
+			if !got[r] {
+				t.Errorf("coarse %d: no match at %v", coarse, r)
+			}
+		}
+		for _, m := range matches {
+			if m.Score < 0.99 {
+				t.Errorf("coarse %d: score %.3f at %v", coarse, m.Score, m.Bounds)
+			}
+		}
+	}
+}
+
+func TestTemplateRegion(t *testing.T) {
+	g := glyph(24, 24, false)
+	frame := noise(240, 160)
+	stamp(frame, g, image.Pt(20, 20))
+	stamp(frame, g, image.Pt(180, 100))
+	tpl, err := NewTemplate("glyph", g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl.Region = Rect(120, 60, 240, 160)
+	matches := tpl.Match(frame)
+	if len(matches) != 1 || matches[0].Bounds.Min != image.Pt(180, 100) {
+		t.Errorf("matches in region %+v, want only the one at (180,100)", matches)
+	}
+	// У многоугольника решает центр совпадения.
+	tpl.Region = Region{Polygon: []Coord{{0, 0}, {80, 0}, {0, 80}}}
+	matches = tpl.Match(frame)
+	if len(matches) != 1 || matches[0].Bounds.Min != image.Pt(20, 20) {
+		t.Errorf("matches in polygon %+v, want only the one at (20,20)", matches)
+	}
+}
+
+func TestTemplateOverlapSuppression(t *testing.T) {
+	// Вертикальные полосы с периодом 4: шаблон 16x8 совпадает с полосой
+	// 32x8 точно в каждом сдвиге, кратном 4.
+	stripes := func(w, h int) *image.RGBA {
+		img := image.NewRGBA(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				l := uint8(40)
+				if x%4 < 2 {
+					l = 220
+				}
+				img.SetRGBA(x, y, color.RGBA{l, l, l, 0xff})
+			}
+		}
+		return img
+	}
+	frame := solid(image.Rect(0, 0, 80, 40), gray)
+	stamp(frame, stripes(32, 8), image.Pt(10, 10))
+	tpl, err := NewTemplate("stripes", stripes(16, 8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches := tpl.Match(frame)
+	// Из точных совпадений в 10, 14, ..., 26 остаются те, что перекрывают
+	// уже оставленные не больше чем наполовину.
+	want := map[image.Rectangle]bool{
+		image.Rect(10, 10, 26, 18): true,
+		image.Rect(18, 10, 34, 18): true,
+		image.Rect(26, 10, 42, 18): true,
+	}
+	got := boundsOf(matches)
+	if len(matches) != len(want) {
+		t.Fatalf("matches %v, want %v", got, want)
+	}
+	for r := range want {
+		if !got[r] {
+			t.Errorf("no match at %v; got %v", r, got)
+		}
+	}
+	for i, a := range matches {
+		for _, b := range matches[i+1:] {
+			d := a.Bounds.Min.Sub(b.Bounds.Min)
+			if abs(d.X)*2 < 16 && abs(d.Y)*2 < 8 {
+				t.Errorf("%v and %v overlap by more than half", a.Bounds, b.Bounds)
+			}
+		}
+	}
+}
+
+func TestNewTemplateErrors(t *testing.T) {
+	if _, err := NewTemplate("flat", solid(image.Rect(0, 0, 8, 8), red)); err == nil {
+		t.Error("NewTemplate accepted a flat template")
+	}
+	if _, err := NewTemplate("clear", image.NewRGBA(image.Rect(0, 0, 8, 8))); err == nil {
+		t.Error("NewTemplate accepted a fully transparent template")
+	}
+	for _, bad := range []func(*Template){
+		func(t *Template) { t.Threshold = 1.5 },
+		func(t *Template) { t.Coarse = -1 },
+		func(t *Template) { t.Region = Rect(5, 5, 5, 10) },
+		func(t *Template) { t.Region = Region{Polygon: []Coord{{0, 0}, {5, 5}}} },
+	} {
+		tpl, err := NewTemplate("glyph", glyph(8, 8, false))
+		if err != nil {
+			t.Fatal(err)
+		}
+		bad(tpl)
+		if err := (&Finder{Templates: []*Template{tpl}}).Validate(); err == nil {
+			t.Errorf("Validate accepted threshold %g, coarse %d, region %v", tpl.Threshold, tpl.Coarse, tpl.Region)
+		}
+	}
+	if err := (&Finder{Templates: []*Template{{Name: "unloaded"}}}).Validate(); err == nil {
+		t.Error("Validate accepted a template that was never loaded")
+	}
+}
@@ -1,19 +1,25 @@
 package ui
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync/atomic"
-	"syscall"
-	"unsafe"
 	"time"
 
 	"arduino-go-bot/arduinobot"
+	"arduino-go-bot/arduinobot/keys"
+	"arduino-go-bot/arduinobot/trace"
 	"arduino-go-bot/logic"
+	"arduino-go-bot/platform"
 	"arduino-go-bot/screenfinder"
+	"arduino-go-bot/uinput"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
@@ -27,114 +33,54 @@ type Config struct {
 	ColorR          int                  `json:"colorR"`
 	ColorG          int                  `json:"colorG"`
 	ColorB          int                  `json:"colorB"`
+	// ColorRules loosen the exact colorR/G/B match, e.g. [{"match": "channel", "tolerance": 12}]; see screenfinder.ColorRule.
+	ColorRules []screenfinder.ColorRule `json:"colorRules,omitempty"`
+	// Regions are scanned whole for blobs of the target color, e.g. [{"min": {"X": 600, "Y": 300}, "max": {"X": 1320, "Y": 800}}]; the bot clicks the largest blob that passes Blobs.
+	Regions []screenfinder.Region `json:"regions,omitempty"`
+	Blobs   screenfinder.BlobFilter `json:"blobs,omitzero"`
+	// Templates are PNG images next to config.json searched on screen when no color point or region matched; see screenfinder.TemplateSpec.
+	Templates []screenfinder.TemplateSpec `json:"templates,omitempty"`
 	Hotkey          string               `json:"hotkey"`
 	DelayMs         int                  `json:"delayMs"`
 	DelayMsJitter   int                  `json:"delayMsJitter"`
 	DelayF2Ms       int                  `json:"delayF2Ms"`
 	DelayF2MsJitter int                  `json:"delayF2MsJitter"`
+	AttackKey       string               `json:"attackKey"`
+	TeleportKey     string               `json:"teleportKey"`
+	Arduino         ArduinoConfig        `json:"arduino"`
+	// Input is "arduino" (default) or "uinput" to drive a local Linux client through a virtual keyboard and mouse.
+	Input string `json:"input,omitempty"`
 }
 
-const configPath = "config.json"
-
-// WinAPI bits for picking color/point and hotkey
-var (
-	user32                 = syscall.NewLazyDLL("user32.dll")
-	gdi32                  = syscall.NewLazyDLL("gdi32.dll")
-	procGetCursorPos       = user32.NewProc("GetCursorPos")
-	procGetDC              = user32.NewProc("GetDC")
-	procReleaseDC          = user32.NewProc("ReleaseDC")
-	procGetPixel           = gdi32.NewProc("GetPixel")
-	procRegisterHotKey     = user32.NewProc("RegisterHotKey")
-	procUnregisterHotKey   = user32.NewProc("UnregisterHotKey")
-	procGetMessageW        = user32.NewProc("GetMessageW")
-	procCreateToolhelpSnap = syscall.NewLazyDLL("kernel32.dll").NewProc("CreateToolhelp32Snapshot")
-	procProcess32First     = syscall.NewLazyDLL("kernel32.dll").NewProc("Process32FirstW")
-	procProcess32Next      = syscall.NewLazyDLL("kernel32.dll").NewProc("Process32NextW")
-	procCloseHandle        = syscall.NewLazyDLL("kernel32.dll").NewProc("CloseHandle")
-)
-
-type point struct{ X, Y int32 }
-
-type processEntry32 struct {
-	dwSize              uint32
-	cntUsage            uint32
-	th32ProcessID       uint32
-	th32DefaultHeapID   uintptr
-	th32ModuleID        uint32
-	cntThreads          uint32
-	th32ParentProcessID uint32
-	pcPriClassBase      int32
-	dwFlags             uint32
-	szExeFile           [260]uint16
+// ArduinoConfig selects the board: an explicit port wins, otherwise the first
+// USB device matching serialNumber (if set) and one of the VID/PID pairs.
+// A port of the form tcp://host:port reaches a board behind cmd/arduinobridge
+// on another machine, authenticated with bridgeKey.
+type ArduinoConfig struct {
+	Port         string             `json:"port,omitempty"`
+	BridgeKey    string             `json:"bridgeKey,omitempty"`
+	SerialNumber string             `json:"serialNumber,omitempty"`
+	Devices      []arduinobot.USBID `json:"devices,omitempty"`
+	BaudRate     int                `json:"baudRate"`
+	// MouseCurve is filled by "Calibrate mouse"; MouseTolerance is how many pixels MouseMove may miss by (0 = don't check).
+	// Calibration turns the check on with defaultMouseTolerance if it was off.
+	MouseCurve     arduinobot.Curve `json:"mouseCurve,omitempty"`
+	MouseTolerance int              `json:"mouseTolerance"`
+	// TraceFile, if set, records all serial traffic of a run there; read it with cmd/tracecat.
+	TraceFile string `json:"traceFile,omitempty"`
 }
 
-const (
-	TH32CS_SNAPPROCESS = 0x00000002
-	MOD_ALT            = 0x0001
-	MOD_CONTROL        = 0x0002
-	MOD_SHIFT          = 0x0004
-)
-
-func getCursorPos() (point, error) {
-	var p point
-	r, _, e := procGetCursorPos.Call(uintptr(unsafe.Pointer(&p)))
-	if r == 0 {
-		return p, e
-	}
-	return p, nil
+func (a ArduinoConfig) controllerConfig() arduinobot.Config {
+	return arduinobot.Config{Port: a.Port, BridgeKey: a.BridgeKey, SerialNumber: a.SerialNumber, Devices: a.Devices, BaudRate: a.BaudRate, ReadTimeout: 2 * time.Second, ReconnectWait: 5 * time.Second, Heartbeat: 10 * time.Second, Curve: a.MouseCurve, Tolerance: a.MouseTolerance}
 }
 
-func getScreenPixel(x, y int32) (r, g, b uint8, err error) {
-	hdc, _, _ := procGetDC.Call(0)
-	if hdc == 0 {
-		return 0, 0, 0, fmt.Errorf("failed to get screen DC")
-	}
-	defer procReleaseDC.Call(0, hdc)
-	clr, _, _ := procGetPixel.Call(hdc, uintptr(x), uintptr(y))
-	return uint8(clr & 0xFF), uint8((clr >> 8) & 0xFF), uint8((clr >> 16) & 0xFF), nil
-}
+const configPath = "config.json"
 
-func findProcessIDByName(name string) int {
-	hsnap, _, _ := procCreateToolhelpSnap.Call(TH32CS_SNAPPROCESS, 0)
-	if hsnap == 0 {
-		return 0
-	}
-	defer procCloseHandle.Call(hsnap)
-	var e processEntry32
-	e.dwSize = uint32(unsafe.Sizeof(e))
-	r, _, _ := procProcess32First.Call(hsnap, uintptr(unsafe.Pointer(&e)))
-	for r != 0 {
-		exe := syscall.UTF16ToString(e.szExeFile[:])
-		if strings.EqualFold(exe, name) {
-			return int(e.th32ProcessID)
-		}
-		r, _, _ = procProcess32Next.Call(hsnap, uintptr(unsafe.Pointer(&e)))
-	}
-	return 0
-}
+// statsInterval is how often the Arduino link statistics are refreshed.
+const statsInterval = 5 * time.Second
 
-func parseHotkey(s string) (mod, vk uint32) {
-	s = strings.TrimSpace(strings.ToLower(s))
-	if strings.Contains(s, "ctrl") {
-		mod |= MOD_CONTROL
-	}
-	if strings.Contains(s, "shift") {
-		mod |= MOD_SHIFT
-	}
-	if strings.Contains(s, "alt") {
-		mod |= MOD_ALT
-	}
-	// default to "S"
-	vk = 0x53
-	parts := strings.Split(s, "+")
-	if len(parts) > 0 {
-		last := strings.TrimSpace(parts[len(parts)-1])
-		if len(last) == 1 {
-			vk = uint32(strings.ToUpper(last)[0])
-		}
-	}
-	return
-}
+// defaultMouseTolerance is the MouseMove check enabled by a successful calibration.
+const defaultMouseTolerance = 2
 
 func loadConfig() *Config {
 	cfg := &Config{
@@ -148,10 +94,14 @@ func loadConfig() *Config {
 		DelayMsJitter:   50,
 		DelayF2Ms:       2500,
 		DelayF2MsJitter: 200,
+		AttackKey:       "F1",
+		TeleportKey:     "F2",
+		Arduino:         ArduinoConfig{Devices: []arduinobot.USBID{{VID: "2341", PID: "8036"}}, BaudRate: 115200},
 	}
 	b, err := os.ReadFile(configPath)
 	if err != nil { return cfg }
 	_ = json.Unmarshal(b, cfg)
+	if err := cfg.Arduino.MouseCurve.Validate(); err != nil { log.Printf("Ignoring the saved mouse curve, please calibrate again: %v", err); cfg.Arduino.MouseCurve = nil }
 	return cfg
 }
 
@@ -180,18 +130,8 @@ func parseInt(e *widget.Entry, def int) int {
 }
 
 func listProcessesWithPID() map[string]int {
-	res := map[string]int{}
-	hsnap, _, _ := procCreateToolhelpSnap.Call(TH32CS_SNAPPROCESS, 0)
-	if hsnap == 0 { return res }
-	defer procCloseHandle.Call(hsnap)
-	var e processEntry32
-	e.dwSize = uint32(unsafe.Sizeof(e))
-	r, _, _ := procProcess32First.Call(hsnap, uintptr(unsafe.Pointer(&e)))
-	for r != 0 {
-		name := syscall.UTF16ToString(e.szExeFile[:])
-		res[name] = int(e.th32ProcessID)
-		r, _, _ = procProcess32Next.Call(hsnap, uintptr(unsafe.Pointer(&e)))
-	}
+	res, err := platform.Current.Processes()
+	if err != nil { return map[string]int{} }
 	return res
 }
 
@@ -229,50 +169,43 @@ func Run() {
 	hotkeyEntry := widget.NewEntry(); hotkeyEntry.SetText(cfg.Hotkey)
 
 	status := widget.NewLabel("Status: Stopped")
+	health := widget.NewLabel("")
 
 	var stopCh chan struct{}
+	var closeInput func()
 	var running atomic.Bool
-	var hotkeyID uint32 = 1
-	var hotkeyRegistered bool
+	var unbindHotkey func()
 
 	startBtn := widget.NewButton("Start", nil)
 
 	bindHotkeyBtn := widget.NewButton("Bind Hotkey", func() {
-		mod, vk := parseHotkey(hotkeyEntry.Text)
-		if hotkeyRegistered { procUnregisterHotKey.Call(0, uintptr(hotkeyID)); hotkeyRegistered=false }
-		r, _, _ := procRegisterHotKey.Call(0, uintptr(hotkeyID), uintptr(mod), uintptr(vk))
-		if r == 0 { status.SetText("Status: Failed to bind hotkey"); return }
-		hotkeyRegistered = true
-		status.SetText("Status: Hotkey bound")
-		go func(){
-			// Simple GetMessage loop to receive WM_HOTKEY (0x0312)
-			type MSG struct { hwnd uintptr; message uint32; wParam uintptr; lParam uintptr; time uint32; pt struct{X,Y int32} }
-			var m MSG
-			for hotkeyRegistered {
-				rv, _, _ := procGetMessageW.Call(uintptr(unsafe.Pointer(&m)), 0, 0, 0)
-				if rv == ^uintptr(0) { break }
-				if m.message == 0x0312 {
-					if running.Load() {
-						if stopCh != nil { close(stopCh) }
-						running.Store(false)
-						status.SetText("Status: Stopped")
-					} else {
-						startBtn.OnTapped()
-					}
+		if unbindHotkey != nil { unbindHotkey(); unbindHotkey = nil }
+		unbind, err := platform.Current.RegisterHotkey(hotkeyEntry.Text, func() {
+			fyne.Do(func() {
+				if running.Load() {
+					if stopCh != nil { close(stopCh) }
+					if closeInput != nil { go closeInput() }
+					running.Store(false)
+					status.SetText("Status: Stopped")
+				} else {
+					startBtn.OnTapped()
 				}
-			}
-		}()
+			})
+		})
+		if err != nil { status.SetText(fmt.Sprintf("Status: Failed to bind hotkey - %v", err)); return }
+		unbindHotkey = unbind
+		status.SetText("Status: Hotkey bound")
 	})
 
 	pickPointBtn := widget.NewButton("Pick Point", func() {
-		p, err := getCursorPos(); if err!=nil { status.SetText("Status: Failed to get cursor position"); return }
+		p, err := platform.Current.CursorPosition(); if err!=nil { status.SetText("Status: Failed to get cursor position"); return }
 		xEntry.SetText(fmt.Sprintf("%d", p.X)); yEntry.SetText(fmt.Sprintf("%d", p.Y)); status.SetText("Status: Point captured")
 	})
 
 	pickColorBtn := widget.NewButton("Pick Color", func() {
-		p, err := getCursorPos(); if err!=nil { status.SetText("Status: Failed to get cursor position"); return }
-		r,g,b, err := getScreenPixel(p.X, p.Y); if err!=nil { status.SetText("Status: Failed to read pixel color"); return }
-		rEntry.SetText(fmt.Sprintf("%d", r)); gEntry.SetText(fmt.Sprintf("%d", g)); bEntry.SetText(fmt.Sprintf("%d", b)); status.SetText("Status: Color captured")
+		p, err := platform.Current.CursorPosition(); if err!=nil { status.SetText("Status: Failed to get cursor position"); return }
+		c, err := platform.Current.Pixel(p); if err!=nil { status.SetText("Status: Failed to read pixel color"); return }
+		rEntry.SetText(fmt.Sprintf("%d", c.R)); gEntry.SetText(fmt.Sprintf("%d", c.G)); bEntry.SetText(fmt.Sprintf("%d", c.B)); status.SetText("Status: Color captured")
 	})
 
 	startBtn.OnTapped = func() {
@@ -290,16 +223,58 @@ func Run() {
 
 		cfg.ProcessName = pn; cfg.Points = []screenfinder.Coord{{X:x,Y:y}}; cfg.ColorR, cfg.ColorG, cfg.ColorB = r,g,b; cfg.DelayMs = delay; cfg.DelayMsJitter = delayJ; cfg.DelayF2Ms = delayF2; cfg.DelayF2MsJitter = delayF2J; cfg.Hotkey = hotkeyEntry.Text; _=saveConfig(cfg)
 
-		controller, err := arduinobot.NewController(arduinobot.Config{VID:"2341", PID:"8036", BaudRate:115200, ReadTimeout: 2*1e9})
-		if err != nil { status.SetText(fmt.Sprintf("Status: Arduino error - %v", err)); return }
-
-		finder := &screenfinder.Finder{PID: pid, Positions: []screenfinder.Coord{{X:x,Y:y}}, TargetColor: screenfinder.Color{R:uint8(r), G:uint8(g), B:uint8(b)}}
-		if err := finder.SetHWND(); err != nil { status.SetText("Status: Game window not found."); controller.Close(); return }
+		finder := &screenfinder.Finder{PID: pid, Positions: []screenfinder.Coord{{X:x,Y:y}}, TargetColor: screenfinder.Color{R:uint8(r), G:uint8(g), B:uint8(b)}, Rules: cfg.ColorRules, Regions: cfg.Regions, Blobs: cfg.Blobs}
+		for _, spec := range cfg.Templates { t, err := spec.Load(filepath.Dir(configPath)); if err != nil { status.SetText(fmt.Sprintf("Status: Bad template - %v", err)); return }; finder.Templates = append(finder.Templates, t) }
+		if err := finder.Validate(); err != nil { status.SetText(fmt.Sprintf("Status: Bad search settings - %v", err)); return }
+		if err := finder.SetWindow(); err != nil { status.SetText("Status: Game window not found."); return }
+
+		attackKey, err := keys.Parse(cfg.AttackKey)
+		if err != nil { status.SetText(fmt.Sprintf("Status: Bad attack key - %v", err)); return }
+		teleportKey, err := keys.Parse(cfg.TeleportKey)
+		if err != nil { status.SetText(fmt.Sprintf("Status: Bad teleport key - %v", err)); return }
+
+		var driver logic.InputDriver
+		if cfg.Input == "uinput" {
+			dev, err := uinput.Open(uinput.Config{})
+			if err != nil { status.SetText(fmt.Sprintf("Status: Failed to create virtual input - %v", err)); return }
+			driver, closeInput = dev, func() { _ = dev.Close() }
+		} else {
+			config := cfg.Arduino.controllerConfig()
+			if cfg.Arduino.TraceFile != "" {
+				rec, err := trace.Create(cfg.Arduino.TraceFile)
+				if err != nil { status.SetText(fmt.Sprintf("Status: Failed to start trace - %v", err)); return }
+				config.Trace = rec
+			}
+			sup := arduinobot.NewSupervisor(config)
+			events, _ := sup.Subscribe()
+			go func() {
+				ticker := time.NewTicker(statsInterval)
+				defer ticker.Stop()
+				for {
+					select {
+					case ev, ok := <-events:
+						// The channel is closed when the supervisor stops.
+						if !ok { return }
+						text := fmt.Sprintf("Status: Running, Arduino %s", ev.State)
+						if ev.Err != nil { text += fmt.Sprintf(" - %v", ev.Err) }
+						if ev.State == arduinobot.StateClosed { continue }
+						fyne.Do(func() { if running.Load() { status.SetText(text) } })
+					case <-ticker.C:
+						text := "Link: " + sup.Controller().Stats().String()
+						fyne.Do(func() { health.SetText(text) })
+					}
+				}
+			}()
+			driver, closeInput = sup.Controller(), func() {
+				sup.Close()
+				if config.Trace != nil { _ = config.Trace.Close() }
+			}
+		}
 
 		stopCh = make(chan struct{})
 		go logic.RunBotLoop(
-			controller,
-			arduinobot.Config{VID:"2341", PID:"8036", BaudRate:115200},
+			driver,
+			logic.Keys{Attack: attackKey, Teleport: teleportKey},
 			finder,
 			stopCh,
 			time.Duration(delay)*time.Millisecond,
@@ -310,7 +285,48 @@ func Run() {
 		running.Store(true); status.SetText("Status: Running")
 	}
 
-	stopBtn := widget.NewButton("Stop", func(){ if !running.Load(){return}; close(stopCh); running.Store(false); status.SetText("Status: Stopped") })
+	calibrateBtn := widget.NewButton("Calibrate mouse", func() {
+		if running.Load() { status.SetText("Status: Stop the bot before calibrating"); return }
+		status.SetText("Status: Calibrating mouse, don't touch it...")
+		go func() {
+			text := "Status: Mouse calibrated"
+			controller, err := arduinobot.NewController(cfg.Arduino.controllerConfig())
+			if err == nil {
+				var curve arduinobot.Curve
+				curve, err = controller.Calibrate(context.Background(), nil)
+				controller.Close()
+				if err == nil {
+					cfg.Arduino.MouseCurve = curve
+					if cfg.Arduino.MouseTolerance == 0 { cfg.Arduino.MouseTolerance = defaultMouseTolerance }
+					_ = saveConfig(cfg)
+				}
+			}
+			if err != nil { text = fmt.Sprintf("Status: Calibration failed - %v", err) }
+			if errors.Is(err, arduinobot.ErrUnsupported) { text = "Status: Mouse calibration needs protocol v2 firmware; this board only speaks v1" }
+			fyne.Do(func() { status.SetText(text) })
+		}()
+	})
+
+	selfTestBtn := widget.NewButton("Self-test", func() {
+		if running.Load() { status.SetText("Status: Stop the bot before the self-test"); return }
+		if cfg.Input == "uinput" { status.SetText("Status: Self-test needs the Arduino"); return }
+		status.SetText("Status: Testing the Arduino...")
+		go func() {
+			var text string
+			controller, err := arduinobot.NewController(cfg.Arduino.controllerConfig())
+			if err == nil {
+				var report arduinobot.SelfTestReport
+				report, _ = controller.SelfTest()
+				controller.Close()
+				text = "Status: " + report.String()
+			} else {
+				text = fmt.Sprintf("Status: Self-test failed - %v", err)
+			}
+			fyne.Do(func() { status.SetText(text) })
+		}()
+	})
+
+	stopBtn := widget.NewButton("Stop", func(){ if !running.Load(){return}; close(stopCh); go closeInput(); running.Store(false); status.SetText("Status: Stopped") })
 	saveBtn := widget.NewButton("Save", func(){ cfg.ProcessName = processSelect.Selected; cfg.Points = []screenfinder.Coord{{X:int32(parseInt(xEntry,0)), Y:int32(parseInt(yEntry,0))}}; cfg.ColorR=parseInt(rEntry,0); cfg.ColorG=parseInt(gEntry,0); cfg.ColorB=parseInt(bEntry,0); cfg.DelayMs=parseInt(delayEntry,300); cfg.DelayMsJitter=parseInt(delayJitterEntry,50); cfg.DelayF2Ms=parseInt(delayF2Entry,2500); cfg.DelayF2MsJitter=parseInt(delayF2JitterEntry,200); cfg.Hotkey=hotkeyEntry.Text; _=saveConfig(cfg); status.SetText("Status: Settings saved") })
 
 	form := container.NewVBox(
@@ -327,8 +343,9 @@ func Run() {
 		container.NewHBox(delayEntry, delayJitterEntry),
 		widget.NewLabel("Delay after F2 (ms) and jitter (ms):"),
 		container.NewHBox(delayF2Entry, delayF2JitterEntry),
-		container.NewHBox(startBtn, stopBtn, saveBtn),
+		container.NewHBox(startBtn, stopBtn, saveBtn, calibrateBtn, selfTestBtn),
 		status,
+		health,
 	)
 
 	w.SetContent(form)
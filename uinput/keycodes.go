@@ -0,0 +1,82 @@
+package uinput
+
+import (
+	"fmt"
+
+	"arduino-go-bot/arduinobot/keys"
+)
+
+// keyLeftShift — KEY_LEFTSHIFT из input-event-codes.h.
+const keyLeftShift uint16 = 42
+
+// special — служебные клавиши keys и их коды Linux.
+var special = map[keys.Key]uint16{
+	keys.LeftCtrl: 29, keys.LeftShift: 42, keys.LeftAlt: 56, keys.LeftGUI: 125,
+	keys.RightCtrl: 97, keys.RightShift: 54, keys.RightAlt: 100, keys.RightGUI: 126,
+
+	keys.Enter: 28, keys.Esc: 1, keys.Backspace: 14, keys.Tab: 15, keys.CapsLock: 58,
+	keys.PrintScreen: 99, keys.ScrollLock: 70, keys.Pause: 119,
+	keys.Insert: 110, keys.Home: 102, keys.PageUp: 104, keys.Delete: 111, keys.End: 107,
+	keys.PageDown: 109, keys.Right: 106, keys.Left: 105, keys.Down: 108, keys.Up: 103,
+	keys.Menu: 127,
+
+	keys.F1: 59, keys.F2: 60, keys.F3: 61, keys.F4: 62, keys.F5: 63, keys.F6: 64,
+	keys.F7: 65, keys.F8: 66, keys.F9: 67, keys.F10: 68, keys.F11: 87, keys.F12: 88,
+
+	keys.NumLock: 69, keys.KPSlash: 98, keys.KPAsterisk: 55, keys.KPMinus: 74,
+	keys.KPPlus: 78, keys.KPEnter: 96, keys.KPDot: 83,
+	keys.KP1: 79, keys.KP2: 80, keys.KP3: 81, keys.KP4: 75, keys.KP5: 76,
+	keys.KP6: 77, keys.KP7: 71, keys.KP8: 72, keys.KP9: 73, keys.KP0: 82,
+}
+
+// printable — символы американской раскладки без Shift.
+var printable = map[rune]uint16{
+	'1': 2, '2': 3, '3': 4, '4': 5, '5': 6, '6': 7, '7': 8, '8': 9, '9': 10, '0': 11,
+	'-': 12, '=': 13, '[': 26, ']': 27, ';': 39, '\'': 40, '`': 41, '\\': 43,
+	',': 51, '.': 52, '/': 53, ' ': 57, '\n': 28, '\t': 15,
+	'q': 16, 'w': 17, 'e': 18, 'r': 19, 't': 20, 'y': 21, 'u': 22, 'i': 23, 'o': 24, 'p': 25,
+	'a': 30, 's': 31, 'd': 32, 'f': 33, 'g': 34, 'h': 35, 'j': 36, 'k': 37, 'l': 38,
+	'z': 44, 'x': 45, 'c': 46, 'v': 47, 'b': 48, 'n': 49, 'm': 50,
+}
+
+// shifted — символы, которые набираются с Shift, и их клавиша без него.
+var shifted = map[rune]rune{
+	'!': '1', '@': '2', '#': '3', '$': '4', '%': '5', '^': '6', '&': '7', '*': '8', '(': '9', ')': '0',
+	'_': '-', '+': '=', '{': '[', '}': ']', ':': ';', '"': '\'', '~': '`', '|': '\\',
+	'<': ',', '>': '.', '?': '/',
+}
+
+// keyCode возвращает код Linux для k и нужен ли к нему Shift.
+func keyCode(k keys.Key) (code uint16, shift bool, err error) {
+	if c, ok := special[k]; ok {
+		return c, false, nil
+	}
+	if k >= keys.F13 && k <= keys.F24 {
+		return 183 + uint16(k-keys.F13), false, nil
+	}
+	r := rune(k)
+	if r >= 'A' && r <= 'Z' {
+		r, shift = r-'A'+'a', true
+	} else if base, ok := shifted[r]; ok {
+		r, shift = base, true
+	}
+	if c, ok := printable[r]; ok {
+		return c, shift, nil
+	}
+	return 0, false, fmt.Errorf("key %v: %w", k, ErrNoKeyCode)
+}
+
+// allKeyCodes — все коды, которые может послать клавиатура Device.
+func allKeyCodes() []uint16 {
+	var out []uint16
+	for _, c := range special {
+		out = append(out, c)
+	}
+	for _, c := range printable {
+		out = append(out, c)
+	}
+	for k := keys.F13; k <= keys.F24; k++ {
+		out = append(out, 183+uint16(k-keys.F13))
+	}
+	return out
+}
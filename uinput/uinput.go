@@ -0,0 +1,322 @@
+// Package uinput создает виртуальные клавиатуру и мышь через /dev/uinput —
+// замену плате Arduino, когда игра запущена на той же машине под Linux.
+// Device умеет то же, что нужно боту от arduinobot.Controller: нажимать
+// клавиши keys.Key, набирать текст, ставить курсор в точку рабочего стола,
+// нажимать кнопки и крутить колесо.
+//
+// Клавиши раскладываются по американской раскладке, как это делает
+// библиотека Keyboard на плате: символ, которому нужен Shift, нажимается
+// вместе с ним.
+package uinput
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"arduino-go-bot/arduinobot/keys"
+	"arduino-go-bot/arduinobot/wire"
+	"arduino-go-bot/platform"
+)
+
+// Типы событий evdev.
+const (
+	EvSyn uint16 = 0x00
+	EvKey uint16 = 0x01
+	EvRel uint16 = 0x02
+	EvAbs uint16 = 0x03
+)
+
+// Коды событий evdev, которые посылает Device.
+const (
+	SynReport uint16 = 0
+	RelWheel  uint16 = 0x08
+	AbsX      uint16 = 0x00
+	AbsY      uint16 = 0x01
+	BtnLeft   uint16 = 0x110
+	BtnRight  uint16 = 0x111
+	BtnMiddle uint16 = 0x112
+)
+
+// Кнопки мыши — те же номера, что у Mouse.h и arduinobot.
+const (
+	MouseLeft   = 1
+	MouseRight  = 2
+	MouseMiddle = 4
+)
+
+var buttons = map[int]uint16{MouseLeft: BtnLeft, MouseRight: BtnRight, MouseMiddle: BtnMiddle}
+
+// Event — struct input_event. Device пишет события без времени: его
+// проставляет ядро, и оно видно в событиях, прочитанных из /dev/input/event*.
+type Event struct {
+	Time  time.Time
+	Type  uint16
+	Code  uint16
+	Value int32
+}
+
+// timevalSize — размер struct timeval: два long.
+const timevalSize = 2 * strconv.IntSize / 8
+
+// EventSize — размер struct input_event на этой архитектуре.
+const EventSize = timevalSize + 8
+
+func (e Event) encode(b []byte) {
+	clear(b[:timevalSize])
+	binary.NativeEndian.PutUint16(b[timevalSize:], e.Type)
+	binary.NativeEndian.PutUint16(b[timevalSize+2:], e.Code)
+	binary.NativeEndian.PutUint32(b[timevalSize+4:], uint32(e.Value))
+}
+
+// ReadEvent читает одно событие evdev из r, например из /dev/input/eventN
+// устройства, созданного Open.
+func ReadEvent(r io.Reader) (Event, error) {
+	var b [EventSize]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return Event{}, err
+	}
+	long := func(off int) int64 {
+		if timevalSize == 16 {
+			return int64(binary.NativeEndian.Uint64(b[off:]))
+		}
+		return int64(int32(binary.NativeEndian.Uint32(b[off:])))
+	}
+	return Event{
+		Time:  time.Unix(long(0), long(timevalSize/2)*int64(time.Microsecond)),
+		Type:  binary.NativeEndian.Uint16(b[timevalSize:]),
+		Code:  binary.NativeEndian.Uint16(b[timevalSize+2:]),
+		Value: int32(binary.NativeEndian.Uint32(b[timevalSize+4:])),
+	}, nil
+}
+
+// ErrNoKeyCode — у клавиши или символа нет кода в американской раскладке.
+var ErrNoKeyCode = errors.New("no Linux key code")
+
+// Config настраивает Device.
+type Config struct {
+	// Name — имя устройства, как его покажут evtest и xinput.
+	// Пусто — "arduino-go-bot".
+	Name string
+	// Desktop — границы рабочего стола, на который отображается абсолютная
+	// ось мыши. Пусто — platform.Current.Desktop().
+	Desktop image.Rectangle
+}
+
+// Device — виртуальные клавиатура и мышь. Методы безопасны для
+// одновременного вызова из нескольких горутин.
+type Device struct {
+	config Config
+	kbd    io.WriteCloser
+	ptr    io.WriteCloser
+	paths  []string
+
+	mu      sync.Mutex
+	closed  bool
+	keyDown map[keys.Key]struct{}
+	btnDown map[int]struct{}
+}
+
+func newDevice(config Config, kbd, ptr io.WriteCloser, paths []string) *Device {
+	return &Device{
+		config:  config,
+		kbd:     kbd,
+		ptr:     ptr,
+		paths:   paths,
+		keyDown: make(map[keys.Key]struct{}),
+		btnDown: make(map[int]struct{}),
+	}
+}
+
+// EventPaths возвращает узлы /dev/input/event* клавиатуры и мыши: из них
+// можно прочитать посланные события через ReadEvent.
+func (d *Device) EventPaths() []string { return append([]string(nil), d.paths...) }
+
+// Close отпускает все удерживаемые клавиши и кнопки и удаляет устройства.
+func (d *Device) Close() error {
+	err := d.ReleaseAllCtx(context.Background())
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return nil
+	}
+	d.closed = true
+	return errors.Join(err, d.kbd.Close(), d.ptr.Close())
+}
+
+// emit пишет события и SYN_REPORT за ними одной записью.
+func (d *Device) emit(ctx context.Context, w io.Writer, events ...Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	events = append(events, Event{Type: EvSyn, Code: SynReport})
+	b := make([]byte, len(events)*EventSize)
+	for i, e := range events {
+		e.encode(b[i*EventSize:])
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return errors.New("uinput device is closed")
+	}
+	if _, err := w.Write(b); err != nil {
+		return fmt.Errorf("uinput write: %w", err)
+	}
+	return nil
+}
+
+// KeyDownCtx нажимает клавишу и держит ее до KeyUpCtx.
+func (d *Device) KeyDownCtx(ctx context.Context, k keys.Key) error {
+	code, shift, err := keyCode(k)
+	if err != nil {
+		return err
+	}
+	var events []Event
+	if shift {
+		events = append(events, Event{Type: EvKey, Code: keyLeftShift, Value: 1})
+	}
+	events = append(events, Event{Type: EvKey, Code: code, Value: 1})
+	if err := d.emit(ctx, d.kbd, events...); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	d.keyDown[k] = struct{}{}
+	d.mu.Unlock()
+	return nil
+}
+
+// KeyUpCtx отпускает клавишу, а с ней и Shift, нажатый KeyDownCtx.
+func (d *Device) KeyUpCtx(ctx context.Context, k keys.Key) error {
+	code, shift, err := keyCode(k)
+	if err != nil {
+		return err
+	}
+	events := []Event{{Type: EvKey, Code: code, Value: 0}}
+	if shift {
+		events = append(events, Event{Type: EvKey, Code: keyLeftShift, Value: 0})
+	}
+	if err := d.emit(ctx, d.kbd, events...); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	delete(d.keyDown, k)
+	d.mu.Unlock()
+	return nil
+}
+
+// KeyCtx нажимает и отпускает клавишу.
+func (d *Device) KeyCtx(ctx context.Context, k keys.Key) error {
+	if err := d.KeyDownCtx(ctx, k); err != nil {
+		return err
+	}
+	return d.KeyUpCtx(context.WithoutCancel(ctx), k)
+}
+
+// TextCtx набирает text. Символы вне американской раскладки дают
+// ErrNoKeyCode до того, как будет нажата хоть одна клавиша.
+func (d *Device) TextCtx(ctx context.Context, text string) error {
+	for _, r := range text {
+		// Коды от 0x80 — служебные клавиши, а не символы.
+		if r >= 0x80 {
+			return fmt.Errorf("character %q: %w", r, ErrNoKeyCode)
+		}
+		if _, _, err := keyCode(keys.Key(r)); err != nil {
+			return err
+		}
+	}
+	for _, r := range text {
+		if err := d.KeyCtx(ctx, keys.Key(r)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MouseMoveCtx ставит курсор в точку x,y рабочего стола через абсолютную
+// ось мыши.
+func (d *Device) MouseMoveCtx(ctx context.Context, x, y int) error {
+	desktop := d.config.Desktop
+	if desktop.Empty() {
+		var err error
+		if desktop, err = platform.Current.Desktop(); err != nil {
+			return fmt.Errorf("failed to get desktop bounds: %w", err)
+		}
+	}
+	ax, ay := wire.ToAbs(desktop, image.Pt(x, y))
+	return d.emit(ctx, d.ptr,
+		Event{Type: EvAbs, Code: AbsX, Value: int32(ax)},
+		Event{Type: EvAbs, Code: AbsY, Value: int32(ay)})
+}
+
+// MouseDownCtx нажимает кнопку мыши (MouseLeft, MouseRight, MouseMiddle).
+func (d *Device) MouseDownCtx(ctx context.Context, button int) error {
+	return d.button(ctx, button, 1)
+}
+
+// MouseUpCtx отпускает кнопку мыши.
+func (d *Device) MouseUpCtx(ctx context.Context, button int) error {
+	return d.button(ctx, button, 0)
+}
+
+// MouseClickCtx нажимает и отпускает кнопку мыши.
+func (d *Device) MouseClickCtx(ctx context.Context, button int) error {
+	if err := d.MouseDownCtx(ctx, button); err != nil {
+		return err
+	}
+	return d.MouseUpCtx(context.WithoutCancel(ctx), button)
+}
+
+func (d *Device) button(ctx context.Context, button int, value int32) error {
+	code, ok := buttons[button]
+	if !ok {
+		return fmt.Errorf("unknown mouse button %d", button)
+	}
+	if err := d.emit(ctx, d.ptr, Event{Type: EvKey, Code: code, Value: value}); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	if value != 0 {
+		d.btnDown[button] = struct{}{}
+	} else {
+		delete(d.btnDown, button)
+	}
+	d.mu.Unlock()
+	return nil
+}
+
+// MouseWheelCtx крутит колесо на amount щелчков; положительное — вверх.
+func (d *Device) MouseWheelCtx(ctx context.Context, amount int) error {
+	return d.emit(ctx, d.ptr, Event{Type: EvRel, Code: RelWheel, Value: int32(amount)})
+}
+
+// ReleaseAllCtx отпускает все удерживаемые клавиши и кнопки. Отпускание
+// продолжается после первой ошибки; возвращаются все ошибки вместе.
+func (d *Device) ReleaseAllCtx(ctx context.Context) error {
+	d.mu.Lock()
+	var ks []keys.Key
+	for k := range d.keyDown {
+		ks = append(ks, k)
+	}
+	var bs []int
+	for b := range d.btnDown {
+		bs = append(bs, b)
+	}
+	d.mu.Unlock()
+	sort.Slice(ks, func(i, j int) bool { return ks[i] < ks[j] })
+	sort.Ints(bs)
+	var errs []error
+	for _, k := range ks {
+		errs = append(errs, d.KeyUpCtx(ctx, k))
+	}
+	for _, b := range bs {
+		errs = append(errs, d.MouseUpCtx(ctx, b))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,158 @@
+package uinput
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+	"unsafe"
+
+	"arduino-go-bot/arduinobot/wire"
+	"golang.org/x/sys/unix"
+)
+
+// Запросы ioctl из linux/uinput.h.
+const (
+	uiDevCreate  = 0x5501
+	uiDevDestroy = 0x5502
+	uiDevSetup   = 0x405c5503 // _IOW('U', 3, struct uinput_setup)
+	uiAbsSetup   = 0x401c5504 // _IOW('U', 4, struct uinput_abs_setup)
+	uiSetEvBit   = 0x40045564
+	uiSetKeyBit  = 0x40045565
+	uiSetRelBit  = 0x40045566
+	uiSetAbsBit  = 0x40045567
+	busVirtual   = 0x06
+	sysnameLen   = 64
+)
+
+// uiGetSysname — UI_GET_SYSNAME(len): _IOC(_IOC_READ, 'U', 44, len).
+const uiGetSysname = 2<<30 | sysnameLen<<16 | 'U'<<8 | 44
+
+// deviceSettle — сколько ждать после создания, пока устройство подхватят
+// udev и графический сервер; события до этого теряются.
+const deviceSettle = 300 * time.Millisecond
+
+type uinputSetup struct {
+	Bustype, Vendor, Product, Version uint16
+	Name                              [80]byte
+	FFEffectsMax                      uint32
+}
+
+type absSetup struct {
+	Code uint16
+	_    uint16
+	// struct input_absinfo
+	Value, Minimum, Maximum, Fuzz, Flat, Resolution int32
+}
+
+// Open создает виртуальные клавиатуру и мышь. Нужны доступ на запись
+// к /dev/uinput (root или группа input/uinput, в зависимости от
+// дистрибутива) и загруженный модуль ядра uinput.
+func Open(config Config) (*Device, error) {
+	if config.Name == "" {
+		config.Name = "arduino-go-bot"
+	}
+	kbd, err := create(config.Name+" keyboard", func(f *os.File) error {
+		if err := ioctl(f, uiSetEvBit, uintptr(EvKey)); err != nil {
+			return err
+		}
+		for _, c := range allKeyCodes() {
+			if err := ioctl(f, uiSetKeyBit, uintptr(c)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	ptr, err := create(config.Name+" mouse", func(f *os.File) error {
+		for _, ev := range []uint16{EvKey, EvRel, EvAbs} {
+			if err := ioctl(f, uiSetEvBit, uintptr(ev)); err != nil {
+				return err
+			}
+		}
+		for _, b := range []uint16{BtnLeft, BtnRight, BtnMiddle} {
+			if err := ioctl(f, uiSetKeyBit, uintptr(b)); err != nil {
+				return err
+			}
+		}
+		if err := ioctl(f, uiSetRelBit, uintptr(RelWheel)); err != nil {
+			return err
+		}
+		// Абсолютные оси на весь рабочий стол — как у USB-планшета QEMU.
+		for _, axis := range []uint16{AbsX, AbsY} {
+			if err := ioctl(f, uiSetAbsBit, uintptr(axis)); err != nil {
+				return err
+			}
+			s := absSetup{Code: axis, Maximum: wire.AbsMax}
+			if err := ioctl(f, uiAbsSetup, uintptr(unsafe.Pointer(&s))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		kbd.Close()
+		return nil, err
+	}
+	time.Sleep(deviceSettle)
+	return newDevice(config, kbd, ptr, append(kbd.paths, ptr.paths...)), nil
+}
+
+// uidev — одно устройство uinput; Close удаляет его из системы.
+type uidev struct {
+	*os.File
+	paths []string
+}
+
+func (d *uidev) Close() error {
+	return errors.Join(ioctl(d.File, uiDevDestroy, 0), d.File.Close())
+}
+
+// create открывает /dev/uinput, описывает возможности устройства через
+// setup и создает его.
+func create(name string, setup func(f *os.File) error) (*uidev, error) {
+	f, err := os.OpenFile("/dev/uinput", os.O_WRONLY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("uinput: %w", err)
+	}
+	if err := setup(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("uinput %s: %w", name, err)
+	}
+	s := uinputSetup{Bustype: busVirtual, Version: 1}
+	copy(s.Name[:len(s.Name)-1], name)
+	if err := ioctl(f, uiDevSetup, uintptr(unsafe.Pointer(&s))); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("uinput %s: UI_DEV_SETUP: %w", name, err)
+	}
+	if err := ioctl(f, uiDevCreate, 0); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("uinput %s: UI_DEV_CREATE: %w", name, err)
+	}
+	return &uidev{File: f, paths: eventPaths(f)}, nil
+}
+
+// eventPaths находит узлы /dev/input/event* созданного устройства.
+func eventPaths(f *os.File) []string {
+	var buf [sysnameLen]byte
+	if ioctl(f, uiGetSysname, uintptr(unsafe.Pointer(&buf[0]))) != nil {
+		return nil
+	}
+	sys := unix.ByteSliceToString(buf[:])
+	nodes, _ := filepath.Glob(filepath.Join("/sys/devices/virtual/input", sys, "event*"))
+	var out []string
+	for _, n := range nodes {
+		out = append(out, filepath.Join("/dev/input", filepath.Base(n)))
+	}
+	return out
+}
+
+func ioctl(f *os.File, req, arg uintptr) error {
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, f.Fd(), req, arg); errno != 0 {
+		return errno
+	}
+	return nil
+}
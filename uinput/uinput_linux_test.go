@@ -0,0 +1,83 @@
+package uinput
+
+import (
+	"context"
+	"errors"
+	"image"
+	"io/fs"
+	"os"
+	"testing"
+	"time"
+
+	"arduino-go-bot/arduinobot/keys"
+)
+
+// readEvents (неэкспортируемая) читает события из узла evdev, пока не
+// наберет n событий, кроме EV_SYN.
+func readEvents(t *testing.T, f *os.File, n int) []Event {
+	t.Helper()
+	f.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var out []Event
+	for len(out) < n {
+		e, err := ReadEvent(f)
+		if err != nil {
+			t.Fatalf("reading %s: %v", f.Name(), err)
+		}
+		if e.Type != EvSyn {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func TestDeviceEvdev(t *testing.T) {
+	d, err := Open(Config{Name: "arduino-go-bot test", Desktop: image.Rect(0, 0, 1920, 1080)})
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+		t.Skipf("uinput unavailable: %v", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	paths := d.EventPaths()
+	if len(paths) != 2 {
+		t.Skipf("event nodes %v: want one keyboard and one mouse", paths)
+	}
+	nodes := make([]*os.File, len(paths))
+	for i, p := range paths {
+		if nodes[i], err = os.Open(p); err != nil {
+			t.Skipf("cannot read events back: %v", err)
+		}
+		defer nodes[i].Close()
+	}
+
+	start := time.Now()
+	if err := d.KeyCtx(context.Background(), keys.Key('Q')); err != nil {
+		t.Fatal(err)
+	}
+	got := readEvents(t, nodes[0], 4)
+	want := []Event{key(keyLeftShift, 1), key(16, 1), key(16, 0), key(keyLeftShift, 0)}
+	for i := range want {
+		if got[i].Type != want[i].Type || got[i].Code != want[i].Code || got[i].Value != want[i].Value {
+			t.Errorf("keyboard event %d = %+v, want %+v", i, got[i], want[i])
+		}
+		// Время проставляет ядро.
+		if got[i].Time.Before(start.Add(-time.Second)) {
+			t.Errorf("keyboard event %d has time %v, before the test started", i, got[i].Time)
+		}
+	}
+
+	if err := d.MouseWheelCtx(context.Background(), 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.MouseClickCtx(context.Background(), MouseLeft); err != nil {
+		t.Fatal(err)
+	}
+	got = readEvents(t, nodes[1], 3)
+	want = []Event{{Type: EvRel, Code: RelWheel, Value: 3}, key(BtnLeft, 1), key(BtnLeft, 0)}
+	for i := range want {
+		if got[i].Type != want[i].Type || got[i].Code != want[i].Code || got[i].Value != want[i].Value {
+			t.Errorf("mouse event %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
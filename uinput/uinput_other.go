@@ -0,0 +1,14 @@
+//go:build !linux
+
+package uinput
+
+import (
+	"fmt"
+
+	"arduino-go-bot/platform"
+)
+
+// Open есть только под Linux.
+func Open(Config) (*Device, error) {
+	return nil, fmt.Errorf("uinput: %w", platform.ErrUnsupported)
+}
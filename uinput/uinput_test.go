@@ -0,0 +1,105 @@
+package uinput
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"arduino-go-bot/arduinobot/keys"
+	"arduino-go-bot/arduinobot/wire"
+)
+
+// sink — буфер вместо /dev/uinput.
+type sink struct{ bytes.Buffer }
+
+func (*sink) Close() error { return nil }
+
+// events (неэкспортируемая) читает из r все записанные события через ReadEvent.
+// Время Device не пишет, поэтому оно сбрасывается.
+func events(t *testing.T, r io.Reader) []Event {
+	t.Helper()
+	var out []Event
+	for {
+		e, err := ReadEvent(r)
+		if err == io.EOF {
+			return out
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.Time = time.Time{}
+		out = append(out, e)
+	}
+}
+
+func key(code uint16, value int32) Event { return Event{Type: EvKey, Code: code, Value: value} }
+
+var syn = Event{Type: EvSyn, Code: SynReport}
+
+func TestDeviceEvents(t *testing.T) {
+	var kbd, ptr sink
+	desktop := image.Rect(-1920, 0, 1920, 1080)
+	d := newDevice(Config{Desktop: desktop}, &kbd, &ptr, nil)
+	ctx := context.Background()
+
+	if err := d.TextCtx(ctx, "a!"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.KeyCtx(ctx, keys.F1); err != nil {
+		t.Fatal(err)
+	}
+	want := []Event{
+		key(30, 1), syn, key(30, 0), syn,
+		key(keyLeftShift, 1), key(2, 1), syn, key(2, 0), key(keyLeftShift, 0), syn,
+		key(59, 1), syn, key(59, 0), syn,
+	}
+	if got := events(t, &kbd); !reflect.DeepEqual(got, want) {
+		t.Errorf("keyboard events:\n got %v\nwant %v", got, want)
+	}
+
+	if err := d.MouseMoveCtx(ctx, 0, 5000); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.MouseWheelCtx(ctx, -2); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.MouseDownCtx(ctx, MouseRight); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ax, ay := wire.ToAbs(desktop, image.Pt(0, 5000))
+	want = []Event{
+		{Type: EvAbs, Code: AbsX, Value: int32(ax)}, {Type: EvAbs, Code: AbsY, Value: int32(ay)}, syn,
+		{Type: EvRel, Code: RelWheel, Value: -2}, syn,
+		key(BtnRight, 1), syn,
+		key(BtnRight, 0), syn, // Close отпускает кнопку
+	}
+	if got := events(t, &ptr); !reflect.DeepEqual(got, want) {
+		t.Errorf("mouse events:\n got %v\nwant %v", got, want)
+	}
+}
+
+func TestDeviceErrors(t *testing.T) {
+	var kbd, ptr sink
+	d := newDevice(Config{}, &kbd, &ptr, nil)
+	if err := d.TextCtx(context.Background(), "oké"); !errors.Is(err, ErrNoKeyCode) {
+		t.Errorf("TextCtx with a non-US character = %v, want ErrNoKeyCode", err)
+	}
+	if kbd.Len() != 0 {
+		t.Error("TextCtx pressed keys before rejecting the text")
+	}
+	if err := d.MouseDownCtx(context.Background(), 3); err == nil {
+		t.Error("MouseDownCtx accepted an unknown button")
+	}
+	d.Close()
+	if err := d.KeyCtx(context.Background(), 'a'); err == nil {
+		t.Error("KeyCtx succeeded on a closed device")
+	}
+}